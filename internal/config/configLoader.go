@@ -29,6 +29,8 @@ type security struct {
 	TlsVersion               string `toml:"min_tls_version"`
 
 	AllowedOrigins []string `toml:"allowed_origins"`
+
+	RequireAdmin2FA bool `toml:"require_admin_2fa"`
 }
 
 func (c *Config) LoadConfig() {
@@ -0,0 +1,513 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// APIError is the body of every non-2xx /api/v1 response, wrapped as
+// {"error": {...}}.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// AbortWithAPIError writes an APIError and stops the handler chain.
+func AbortWithAPIError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{Code: code, Message: message}})
+}
+
+func apiInternalError(c *gin.Context) {
+	AbortWithAPIError(c, http.StatusInternalServerError, "internal_error", "An internal error occurred. Please try again.")
+}
+
+// apiList writes a page of results. nextCursor is nil on the last page.
+func apiList(c *gin.Context, data any, nextCursor any) {
+	c.JSON(http.StatusOK, gin.H{
+		"data":        data,
+		"next_cursor": nextCursor,
+	})
+}
+
+func bindPagination(c *gin.Context) (Pagination, bool) {
+	var pagination Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return pagination, false
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 20
+	}
+	return pagination, true
+}
+
+func bindPaginationUpdates(c *gin.Context) (PaginationUpdates, time.Time, bool) {
+	var pagination PaginationUpdates
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return pagination, time.Time{}, false
+	}
+
+	before, err := parseBeforeCursor(pagination.Before)
+	if err != nil {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_pagination", "`before` must be an RFC 3339 timestamp.")
+		return pagination, time.Time{}, false
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 10
+	}
+	return pagination, before, true
+}
+
+func idCursor(count, limit, lastID int) any {
+	if count < limit {
+		return nil
+	}
+	return lastID
+}
+
+func timeCursor(count, limit int, last time.Time) any {
+	if count < limit {
+		return nil
+	}
+	return last.Format(time.RFC3339Nano)
+}
+
+func APIJobTypes(c *gin.Context) {
+	jobTypes, err := listJobTypes(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Job Types [SQL]: Error while querying job_types table `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	visible := make([]jobType, 0, len(jobTypes))
+	for _, jt := range jobTypes {
+		canView, err := canAccessJobType(c, fmt.Sprint(jt.ID), false)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("API Job Types [SQL]: Error while checking access to job type {ID: %d} `%v`", jt.ID, err))
+			apiInternalError(c)
+			return
+		}
+		if canView {
+			visible = append(visible, jt)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": visible})
+}
+
+// apiVisibleJobType loads the job type from the :id param and answers 404 when
+// it is missing or the user cannot see it.
+func apiVisibleJobType(c *gin.Context) (jobType, bool) {
+	id := c.Param("id")
+
+	var jt jobType
+	if err := jt.findJobTypeByID(c, id); err != nil {
+		AbortWithAPIError(c, http.StatusNotFound, "not_found", "Job type not found.")
+		return jt, false
+	}
+
+	canView, err := canAccessJobType(c, id, false)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Job Type [SQL]: Error while checking access to job type {ID: %s} `%v`", id, err))
+		apiInternalError(c)
+		return jt, false
+	}
+	if !canView {
+		AbortWithAPIError(c, http.StatusNotFound, "not_found", "Job type not found.")
+		return jt, false
+	}
+
+	return jt, true
+}
+
+func APIJobType(c *gin.Context) {
+	jt, ok := apiVisibleJobType(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jt})
+}
+
+func APICustomFields(c *gin.Context) {
+	jt, ok := apiVisibleJobType(c)
+	if !ok {
+		return
+	}
+
+	customFields := CustomFieldDefList{}
+	customFields.fetchCurrentCustomFields(c, fmt.Sprint(jt.ID))
+
+	c.JSON(http.StatusOK, gin.H{"data": customFields})
+}
+
+func APIJobStatuses(c *gin.Context) {
+	jt, ok := apiVisibleJobType(c)
+	if !ok {
+		return
+	}
+
+	statuses, err := fetchJobStatuses(c, fmt.Sprint(jt.ID))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Job Statuses [SQL]: Error while querying status_workflow `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": emptyIfNil(statuses)})
+}
+
+func APIJobs(c *gin.Context) {
+	jt, ok := apiVisibleJobType(c)
+	if !ok {
+		return
+	}
+
+	pagination, ok := bindPagination(c)
+	if !ok {
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, fmt.Sprint(jt.ID))
+
+	filter := jobFilter{JobTypeID: fmt.Sprint(jt.ID)}
+	if msg := filter.parse(c.Request.URL.Query(), customFieldDefs); msg != "" {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_filter", msg)
+		return
+	}
+
+	jobs, err := listJobs(c, filter, pagination)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Jobs [SQL]: Error while querying items `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	apiList(c, emptyIfNil(jobs), filter.apiNextCursor(jobs, pagination.Limit))
+}
+
+// APIMyJobs lists the jobs assigned to the caller.
+func APIMyJobs(c *gin.Context) {
+	pagination, ok := bindPagination(c)
+	if !ok {
+		return
+	}
+
+	filter := jobFilter{AssignedUserID: currentUserID(c)}
+	if msg := filter.parse(c.Request.URL.Query(), nil); msg != "" {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_filter", msg)
+		return
+	}
+
+	jobs, err := listJobs(c, filter, pagination)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API My Jobs [SQL]: Error while querying items `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	apiList(c, emptyIfNil(jobs), filter.apiNextCursor(jobs, pagination.Limit))
+}
+
+func APISearchJobs(c *gin.Context) {
+	jobQuery := c.Query("q")
+	if jobQuery == "" {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_query", "`q` is required.")
+		return
+	}
+
+	jobs, err := searchJobs(c, jobQuery)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Search Jobs [SQL]: Error while querying jobs table `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": emptyIfNil(jobs)})
+}
+
+func APIJob(c *gin.Context) {
+	job, err := findJobDetail(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			AbortWithAPIError(c, http.StatusNotFound, "not_found", "Job not found.")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("API Job [SQL]: Error while querying `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
+func APIJobUpdates(c *gin.Context) {
+	jobID := c.Param("id")
+
+	canView, err := canAccessJob(c, jobID, false)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Job Updates [SQL]: Error while checking access to job %s `%v`", jobID, err))
+		apiInternalError(c)
+		return
+	}
+	if !canView {
+		AbortWithAPIError(c, http.StatusNotFound, "not_found", "Job not found.")
+		return
+	}
+
+	pagination, before, ok := bindPaginationUpdates(c)
+	if !ok {
+		return
+	}
+
+	jobUpdates, err := listJobUpdates(c, jobID, before, pagination.Limit)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Job Updates [SQL]: Error while querying items `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	var nextCursor any
+	if len(jobUpdates) > 0 {
+		nextCursor = timeCursor(len(jobUpdates), pagination.Limit, jobUpdates[len(jobUpdates)-1].CreatedAt)
+	}
+
+	apiList(c, emptyIfNil(jobUpdates), nextCursor)
+}
+
+type apiJobUpdateRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+}
+
+func APICreateJobUpdate(c *gin.Context) {
+	jobID := c.Param("id")
+
+	var req apiJobUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Create Job Update [SQL]: Error while checking access to job %s `%v`", jobID, err))
+		apiInternalError(c)
+		return
+	}
+	if !canEdit {
+		AbortWithAPIError(c, http.StatusNotFound, "not_found", "Job not found.")
+		return
+	}
+
+	content, err := json.Marshal(gin.H{
+		"title":       req.Title,
+		"description": req.Description,
+	})
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Create Job Update [Marshal]: Error while marshaling job update `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	jobUpdate, err := insertJobUpdate(c, jobID, currentUserID(c), content)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Create Job Update [SQL]: Error while inserting into job_updates `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": jobUpdate})
+}
+
+func APIContacts(c *gin.Context) {
+	pagination, ok := bindPagination(c)
+	if !ok {
+		return
+	}
+
+	contacts, err := listContacts(c, pagination, c.Query("q"))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Contacts [SQL]: Failed to fetch contacts: %v", err))
+		apiInternalError(c)
+		return
+	}
+
+	var nextCursor any
+	if len(contacts) > 0 {
+		nextCursor = idCursor(len(contacts), pagination.Limit, contacts[len(contacts)-1].ID)
+	}
+
+	apiList(c, emptyIfNil(contacts), nextCursor)
+}
+
+func APIContact(c *gin.Context) {
+	contact, err := findContact(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			AbortWithAPIError(c, http.StatusNotFound, "not_found", "Contact not found.")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("API Contact [SQL]: Error while querying `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": contact})
+}
+
+type apiContactRequest struct {
+	Name         string         `json:"name" binding:"required"`
+	Email        string         `json:"email"`
+	Phone        string         `json:"phone"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+func APICreateContact(c *gin.Context) {
+	var req apiContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "contact")
+	customFields, fieldErrors := customFieldDefs.validate(c, customFieldFormValues(req.CustomFields))
+	if len(fieldErrors) > 0 {
+		AbortWithAPIError(c, http.StatusUnprocessableEntity, "invalid_custom_fields", customFieldDefs.errorMessage(fieldErrors))
+		return
+	}
+
+	duplicates, err := findDuplicateContacts(c, 0, req.Email, req.Phone)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Create Contact [SQL]: Error while looking for duplicates `%v`", err))
+		apiInternalError(c)
+		return
+	}
+	if existing, taken := emailTaken(duplicates, req.Email); taken {
+		AbortWithAPIError(c, http.StatusConflict, "duplicate_contact", fmt.Sprintf("Contact %d already uses this email.", existing.ID))
+		return
+	}
+
+	contact, err := insertContact(c, req.Name, req.Email, req.Phone, customFields)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Create Contact [SQL]: Error to create a new contact `%v`", err))
+		AbortWithAPIError(c, http.StatusUnprocessableEntity, "save_failed", "Failed to save contact.")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": contact})
+}
+
+func APIFinanceTransactions(c *gin.Context) {
+	pagination, before, ok := bindPaginationUpdates(c)
+	if !ok {
+		return
+	}
+
+	finances, err := listFinances(c, before, pagination.Limit)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Finance Transactions [SQL]: Error querying financial_transactions table `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	var nextCursor any
+	if len(finances) > 0 {
+		nextCursor = timeCursor(len(finances), pagination.Limit, finances[len(finances)-1].CreatedAt)
+	}
+
+	apiList(c, emptyIfNil(finances), nextCursor)
+}
+
+type apiFinanceRequest struct {
+	Description     string           `json:"description" binding:"required"`
+	Amount          *decimal.Decimal `json:"amount" binding:"required"`
+	Type            string           `json:"type" binding:"required,oneof=income expense"`
+	TransactionDate string           `json:"transaction_date"`
+	RelatedJobID    *int             `json:"related_job_id"`
+}
+
+func APICreateFinanceTransaction(c *gin.Context) {
+	var req apiFinanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	transactionDate := time.Now()
+	if req.TransactionDate != "" {
+		parsedDate, err := time.Parse("2006-01-02", req.TransactionDate)
+		if err != nil {
+			AbortWithAPIError(c, http.StatusBadRequest, "invalid_body", "Invalid date format. Use YYYY-MM-DD.")
+			return
+		}
+		transactionDate = parsedDate
+	}
+
+	var relatedJobID string
+	if req.RelatedJobID != nil {
+		relatedJobID = fmt.Sprint(*req.RelatedJobID)
+	}
+
+	record, err := insertFinancialRecord(c, req.Description, *req.Amount, req.Type, transactionDate, relatedJobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Create Finance Transaction [SQL]: Error while inserting record into financial_transactions `%v`", err))
+		AbortWithAPIError(c, http.StatusUnprocessableEntity, "save_failed", "Failed to save the financial record.")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": record})
+}
+
+func APIUsers(c *gin.Context) {
+	pagination, ok := bindPagination(c)
+	if !ok {
+		return
+	}
+
+	users, err := listUsers(c, pagination, c.Query("q"))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Users [SQL]: Error while searching users on database `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	var nextCursor any
+	if len(users) > 0 {
+		nextCursor = idCursor(len(users), pagination.Limit, users[len(users)-1].ID)
+	}
+
+	apiList(c, emptyIfNil(users), nextCursor)
+}
+
+func APIUser(c *gin.Context) {
+	var user Users
+	if err := user.findUserByID(c, c.Param("id")); err != nil {
+		AbortWithAPIError(c, http.StatusNotFound, "not_found", "User not found.")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// emptyIfNil keeps empty lists as [] rather than null in responses.
+func emptyIfNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
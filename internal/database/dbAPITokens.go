@@ -0,0 +1,311 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// apiTokenPrefix marks Momentum tokens so they are easy to spot in
+	// scripts and secret scanners.
+	apiTokenPrefix = "mtm_"
+
+	// last_used_at is only written once per interval so busy scripts don't
+	// turn every request into a write.
+	apiTokenTouchInterval = time.Minute
+)
+
+// apiTokenLifetimes are the expiry choices offered when creating a token.
+var apiTokenLifetimes = []int{7, 30, 90, 365}
+
+var errInvalidAPIToken = errors.New("invalid, expired or revoked API token")
+
+type APIToken struct {
+	ID         int
+	UserID     int
+	Username   string
+	Name       string
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+func (t APIToken) IsExpired() bool {
+	return t.ExpiresAt.Before(time.Now())
+}
+
+func (t APIToken) IsActive() bool {
+	return !t.RevokedAt.Valid && !t.IsExpired()
+}
+
+func generateAPIToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// AuthenticateAPIToken accepts a bearer token in place of the session cookies.
+// It sets the same context keys as the cookie flow, plus "apiTokenScopes",
+// which narrows the role's permissions down to the token's scopes.
+func AuthenticateAPIToken(c *gin.Context, token string) error {
+	var tokenID int
+	var userID int
+	var username, role string
+	var scopes []string
+	var lastUsedAt sql.NullTime
+
+	query := `
+	SELECT t.id, t.scopes, t.last_used_at, u.id, u.username, u.role
+	FROM api_tokens t
+	JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND t.expires_at > NOW()`
+
+	err := conn.QueryRow(c.Request.Context(), query, hashToken(token)).Scan(&tokenID, &scopes, &lastUsedAt, &userID, &username, &role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errInvalidAPIToken
+		}
+		return err
+	}
+
+	if !lastUsedAt.Valid || time.Since(lastUsedAt.Time) > apiTokenTouchInterval {
+		_, err = conn.Exec(c.Request.Context(), `UPDATE api_tokens SET last_used_at = NOW() WHERE id = $1`, tokenID)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Authenticate API Token [SQL]: Error while updating last_used_at for token %d `%v`", tokenID, err))
+		}
+	}
+
+	c.Set("username", username)
+	c.Set("role", role)
+	c.Set("userID", strconv.Itoa(userID))
+	c.Set("apiTokenScopes", scopes)
+
+	return nil
+}
+
+func authenticatedByAPIToken(c *gin.Context) bool {
+	_, ok := c.Get("apiTokenScopes")
+	return ok
+}
+
+const apiTokenSelectQuery = `
+	SELECT t.id, t.user_id, u.username, t.name, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.revoked_at, t.created_at
+	FROM api_tokens t
+	JOIN users u ON u.id = t.user_id`
+
+func listAPITokens(c *gin.Context, userID string) ([]APIToken, error) {
+	var rows pgx.Rows
+	var err error
+	if userID == "" {
+		rows, err = conn.Query(c.Request.Context(), apiTokenSelectQuery+` ORDER BY t.revoked_at IS NOT NULL, t.created_at DESC`)
+	} else {
+		rows, err = conn.Query(c.Request.Context(), apiTokenSelectQuery+` WHERE t.user_id = $1 ORDER BY t.revoked_at IS NOT NULL, t.created_at DESC`, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Username, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func findAPIToken(c *gin.Context, id string) (APIToken, error) {
+	var t APIToken
+	err := conn.QueryRow(c.Request.Context(), apiTokenSelectQuery+` WHERE t.id = $1`, id).Scan(&t.ID, &t.UserID, &t.Username, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt)
+	return t, err
+}
+
+// grantablePermissions are the permissions a user may put on their own
+// tokens: exactly those of their role.
+func grantablePermissions(c *gin.Context) ([]Permission, error) {
+	all, err := listPermissions(c)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := rolePermissions(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []Permission
+	for _, p := range all {
+		if granted[p.Name] {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions, nil
+}
+
+func APITokenList(c *gin.Context) {
+	tokens, err := listAPITokens(c, currentUserID(c))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Token List [SQL]: Error while querying api_tokens `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "apiTokenRows.html", gin.H{
+		"Tokens": tokens,
+	})
+}
+
+func CreateAPIToken(c *gin.Context) {
+	name := c.PostForm("name")
+	scopes := c.PostFormArray("scopes")
+	lifetime, _ := strconv.Atoi(c.PostForm("expires_in_days"))
+
+	renderError := func(message string) {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	if authenticatedByAPIToken(c) {
+		logger.LogToLogFile(c, fmt.Sprintf("Create API Token: User %s tried to create a token with a token", currentUserID(c)))
+		renderError("Error: API tokens cannot create other tokens.")
+		return
+	}
+
+	if name == "" {
+		renderError("Error: Name cannot be empty.")
+		return
+	}
+
+	if !slices.Contains(apiTokenLifetimes, lifetime) {
+		renderError("Error: Choose how long the token is valid.")
+		return
+	}
+
+	if len(scopes) == 0 {
+		renderError("Error: Choose at least one permission.")
+		return
+	}
+
+	granted, err := rolePermissions(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create API Token [SQL]: Error while loading role permissions `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	for _, scope := range scopes {
+		if !granted[scope] {
+			logger.LogToLogFile(c, fmt.Sprintf("Create API Token: User %s cannot grant `%s`", currentUserID(c), scope))
+			renderError(fmt.Sprintf("Error: Your role does not grant `%s`.", scope))
+			return
+		}
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create API Token: %v", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, lifetime)
+	query := `INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = conn.Exec(c.Request.Context(), query, currentUserID(c), name, token[:len(apiTokenPrefix)+6], hashToken(token), scopes, expiresAt)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create API Token [SQL]: Error while inserting into api_tokens `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	c.Header("HX-Trigger", "apiTokensChanged")
+	c.HTML(http.StatusOK, "apiTokenCreated.html", gin.H{
+		"Token":     token,
+		"ExpiresAt": expiresAt,
+	})
+}
+
+func revokeAPIToken(c *gin.Context, id string, userID string) (int64, error) {
+	query := `UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	args := []any{id}
+	if userID != "" {
+		query += ` AND user_id = $2`
+		args = append(args, userID)
+	}
+
+	cmdTag, err := conn.Exec(c.Request.Context(), query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return cmdTag.RowsAffected(), nil
+}
+
+// RevokeAPIToken revokes one of the logged-in user's own tokens.
+func RevokeAPIToken(c *gin.Context) {
+	renderRevoked(c, currentUserID(c), "apiTokenRows.html")
+}
+
+// AdminRevokeAPIToken revokes any user's token.
+func AdminRevokeAPIToken(c *gin.Context) {
+	renderRevoked(c, "", "adminTokenRows.html")
+}
+
+func renderRevoked(c *gin.Context, userID, template string) {
+	id := c.Param("id")
+
+	revoked, err := revokeAPIToken(c, id, userID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Revoke API Token [SQL]: Error while revoking token %s `%v`", id, err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+	if revoked == 0 {
+		c.String(http.StatusNotFound, "Token not found or already revoked.")
+		return
+	}
+
+	token, err := findAPIToken(c, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Revoke API Token [SQL]: Token %s not found after revoking `%v`", id, err))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	logger.LogToLogFile(c, fmt.Sprintf("Revoke API Token: Token %s (%s) of user %s revoked", token.Prefix, token.Name, token.Username))
+	c.HTML(http.StatusOK, template, gin.H{
+		"Tokens": []APIToken{token},
+	})
+}
+
+func AdminAPITokenList(c *gin.Context) {
+	tokens, err := listAPITokens(c, "")
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Admin API Token List [SQL]: Error while querying api_tokens `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "adminTokens.html", gin.H{
+		"Tokens": tokens,
+	})
+}
@@ -2,28 +2,18 @@ package database
 
 import (
 	"Momentum/internal/logger"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-func UserList(c *gin.Context) {
-	var pagination Pagination
-	if err := c.ShouldBindQuery(&pagination); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("User List [Bind Query]: Error while binding query to pagination struct `%v`", err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	if pagination.Limit <= 0 || pagination.Limit > 50 {
-		pagination.Limit = 10
-	}
-
-	searchQuery := c.Query("q")
-
+func listUsers(c *gin.Context, pagination Pagination, searchQuery string) ([]Users, error) {
 	query := `
-        SELECT id, username, role, full_name, location_contact, work_phone, home_phone, created_at, updated_at 
+        SELECT id, username, role, full_name, location_contact, work_phone, home_phone, totp_enabled, created_at, updated_at 
         FROM users 
         WHERE id > $1 AND (username ILIKE '%' || $3 || '%' OR full_name ILIKE '%' || $3 || '%')
         ORDER BY id ASC 
@@ -31,23 +21,39 @@ func UserList(c *gin.Context) {
 
 	rows, err := conn.Query(c.Request.Context(), query, pagination.After, pagination.Limit, searchQuery)
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("User List [SQL]: Error while searching users on database `%v`", err))
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var users []Users
 	for rows.Next() {
 		var user Users
-		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.FullName, &user.LocationContact, &user.WorkPhone, &user.HomePhone, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("User List [SQL Row Scan]: Error while scanning rows `%v`", err))
-			return
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.FullName, &user.LocationContact, &user.WorkPhone, &user.HomePhone, &user.TOTPEnabled, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, err
 		}
 		users = append(users, user)
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("User List [SQL Row Scan]: Error while iterating rows `%v`", err))
+	return users, rows.Err()
+}
+
+func UserList(c *gin.Context) {
+	var pagination Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("User List [Bind Query]: Error while binding query to pagination struct `%v`", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 10
+	}
+
+	searchQuery := c.Query("q")
+
+	users, err := listUsers(c, pagination, searchQuery)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("User List [SQL]: Error while searching users on database `%v`", err))
 		c.String(http.StatusInternalServerError, "Error reading user list.")
 		return
 	}
@@ -73,21 +79,49 @@ func EditUserDB(c *gin.Context) {
 	workPhone := c.PostForm("work_phone")
 	homePhone := c.PostForm("home_phone")
 
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "user")
+	_, customFields, fieldErrors := customFieldDefs.submit(c)
+	if len(fieldErrors) > 0 {
+		c.Header("HX-Retarget", "#edit-user-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": customFieldDefs.errorMessage(fieldErrors),
+		})
+		return
+	}
+
 	query := `
-		UPDATE users SET full_name = $1, role = $2, location_contact = $3, work_phone = $4, home_phone = $5  WHERE id = $6;
+		UPDATE users u SET full_name = $1, role = $2, location_contact = $3, work_phone = $4, home_phone = $5,
+		    custom_fields = (u.custom_fields - $8::text[]) || $7
+		FROM (SELECT id, role FROM users WHERE id = $6) old
+		WHERE u.id = old.id
+		RETURNING old.role;
 	`
 
-	cmdTag, err := conn.Exec(c.Request.Context(), query, fullName, role, locationContact, workPhone, homePhone, id)
+	var previousRole string
+	err := conn.QueryRow(c.Request.Context(), query, fullName, role, locationContact, workPhone, homePhone, id, customFields, customFieldDefs.names()).Scan(&previousRole)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.LogToLogFile(c, "Edit User DB [SQL]: Error user not found on database")
+			c.String(http.StatusNotFound, "Error user not found")
+			return
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			logger.LogToLogFile(c, fmt.Sprintf("Edit User DB [SQL]: The role `%s` does not exist", role))
+			c.String(http.StatusUnprocessableEntity, "Invalid role.")
+			return
+		}
 		logger.LogToLogFile(c, fmt.Sprintf("Edit User DB [SQL]: Error while updating database `%v`", err))
 		c.String(http.StatusInternalServerError, "Error saving changes.")
 		return
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		logger.LogToLogFile(c, "Edit User DB [SQL]: Error user not found on database")
-		c.String(http.StatusNotFound, "Error user not found")
-		return
+	if previousRole != role {
+		if err := revokeUserSessions(c.Request.Context(), id); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Edit User DB [SQL]: Error while revoking sessions after role change `%v`", err))
+		}
 	}
 
 	var updatedUser Users
@@ -117,7 +151,42 @@ func EditUserPage(c *gin.Context) {
 		return
 	}
 
+	roles, err := listRoles(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit User Page [SQL]: Error while querying roles `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "user")
+
 	c.HTML(http.StatusOK, "editUser.html", gin.H{
-		"User": user,
+		"User":              user,
+		"Roles":             roles,
+		"CustomFieldInputs": customFieldDefs.inputs(c, customFieldFormValues(user.CustomFields), nil),
 	})
 }
+
+func UnlockUser(c *gin.Context) {
+	id := c.Param("id")
+
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1 RETURNING username`
+	var username string
+	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.LogToLogFile(c, "Unlock User [SQL]: Error user not found on database")
+			c.String(http.StatusNotFound, "Error user not found")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Unlock User [SQL]: Error while updating database `%v`", err))
+		c.String(http.StatusInternalServerError, "Error saving changes.")
+		return
+	}
+
+	adminName, _ := c.Get("username")
+	logger.LogToLogFile(c, fmt.Sprintf("Unlock User: User %s unlocked by %v", username, adminName))
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div id="lock-status" class="success">Account unlocked.</div>`))
+}
@@ -0,0 +1,419 @@
+package database
+
+import (
+	"Momentum/internal/ical"
+	"Momentum/internal/logger"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// calendarFeedPrefix marks calendar feed tokens, which only open a feed,
+	// apart from API tokens.
+	calendarFeedPrefix = "mtc_"
+
+	// The feed covers appointments this far back and ahead.
+	calendarFeedPast   = 30 * 24 * time.Hour
+	calendarFeedFuture = 365 * 24 * time.Hour
+)
+
+// CalendarDay is one day of the calendar page with the appointments on it
+// and the open jobs due that day.
+type CalendarDay struct {
+	Date         time.Time
+	InRange      bool // false for days of the month before or after
+	IsToday      bool
+	Appointments []JobAppointment
+	DueJobs      []Job
+}
+
+// CalendarFeedLink is the secret link of a user's calendar feed. The token
+// itself is only shown when the link is made.
+type CalendarFeedLink struct {
+	Prefix     string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
+// calendarRange is the days the calendar page shows: the week (Monday to
+// Sunday) of date, or the weeks covering its month. first and last are the
+// days of the week or month itself.
+func calendarRange(view string, date time.Time) (from, to, first, last time.Time) {
+	startOfWeek := func(t time.Time) time.Time {
+		return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	}
+
+	if view == "month" {
+		first = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.Local)
+		last = first.AddDate(0, 1, -1)
+	} else {
+		first = startOfWeek(date)
+		last = first.AddDate(0, 0, 6)
+	}
+	from = startOfWeek(first)
+	to = startOfWeek(last).AddDate(0, 0, 7)
+	return from, to, first, last
+}
+
+// listCalendarAppointments returns the appointments overlapping [from, to)
+// on jobs the user can see, of one technician or of everyone when userID is
+// empty.
+func listCalendarAppointments(c *gin.Context, from, to time.Time, userID string) ([]JobAppointment, error) {
+	query := `
+	SELECT a.id, a.job_id, a.user_id, u.username, a.starts_at, a.ends_at, a.notes, a.updated_at,
+	    j.ticket_id, j.title, j.status,
+	    ` + appointmentConflictSQL + `
+	FROM job_appointments a
+	JOIN jobs j ON j.id = a.job_id
+	JOIN users u ON u.id = a.user_id
+	WHERE a.starts_at < $2 AND a.ends_at > $1
+	    AND job_type_access(j.job_type_id, $3, false, $5)
+	    AND ($4::int IS NULL OR a.user_id = $4::int)
+	ORDER BY a.starts_at, a.id`
+
+	rows, err := conn.Query(c.Request.Context(), query, from, to, currentUserID(c), nullIfEmpty(userID), accessAllJobTypes(c))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var appointments []JobAppointment
+	for rows.Next() {
+		var a JobAppointment
+		if err := rows.Scan(&a.ID, &a.JobID, &a.UserID, &a.UserName, &a.StartsAt, &a.EndsAt, &a.Notes, &a.UpdatedAt, &a.Ticket, &a.Title, &a.Status, &a.Conflict); err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, a)
+	}
+	return appointments, rows.Err()
+}
+
+// listDueJobs returns the open jobs the user can see that are due between
+// from and to, both included, assigned to userID unless it is empty.
+func listDueJobs(c *gin.Context, from, to time.Time, userID string) ([]Job, error) {
+	query := `
+	SELECT j.id, j.ticket_id, j.title, j.status, j.priority, j.due_date::text, COALESCE(job_overdue(j), '')
+	FROM jobs j
+	WHERE j.due_date BETWEEN $1::date AND $2::date
+	    AND j.resolved_at IS NULL
+	    AND job_type_access(j.job_type_id, $3, false, $5)
+	    AND ($4::int IS NULL OR j.assigned_to_user_id = $4::int)
+	ORDER BY j.due_date, j.id`
+
+	rows, err := conn.Query(c.Request.Context(), query, from.Format("2006-01-02"), to.Format("2006-01-02"), currentUserID(c), nullIfEmpty(userID), accessAllJobTypes(c))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		if err := rows.Scan(&job.ID, &job.Ticket, &job.Title, &job.Status, &job.Priority, &job.DueDate, &job.Overdue); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// calendarWeeks lays out the days from from until to in weeks, each day with
+// the appointments overlapping it and the jobs due on it.
+func calendarWeeks(from, to, first, last time.Time, appointments []JobAppointment, dueJobs []Job) [][]CalendarDay {
+	today := time.Now().Format("2006-01-02")
+
+	var weeks [][]CalendarDay
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 7) {
+		week := make([]CalendarDay, 7)
+		for i := range week {
+			date := day.AddDate(0, 0, i)
+			next := date.AddDate(0, 0, 1)
+			d := CalendarDay{
+				Date:    date,
+				InRange: !date.Before(first) && !date.After(last),
+				IsToday: date.Format("2006-01-02") == today,
+			}
+			for _, a := range appointments {
+				if a.StartsAt.Before(next) && a.EndsAt.After(date) {
+					d.Appointments = append(d.Appointments, a)
+				}
+			}
+			for _, job := range dueJobs {
+				if job.DueDate != nil && *job.DueDate == date.Format("2006-01-02") {
+					d.DueJobs = append(d.DueJobs, job)
+				}
+			}
+			week[i] = d
+		}
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+// CalendarPage shows the appointments and due dates of a week or a month,
+// of everyone or of one technician.
+func CalendarPage(c *gin.Context) {
+	view := c.DefaultQuery("view", "week")
+	if view != "month" {
+		view = "week"
+	}
+
+	date := time.Now()
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.String(http.StatusBadRequest, "`date` must be a date (YYYY-MM-DD).")
+			return
+		}
+		date = parsed
+	}
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+
+	userID := c.Query("user")
+	if userID != "" && !isID(userID) {
+		c.String(http.StatusBadRequest, "`user` must be a user ID.")
+		return
+	}
+
+	from, to, first, last := calendarRange(view, date)
+
+	appointments, err := listCalendarAppointments(c, from, to, userID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Calendar Page [SQL]: Error while querying job_appointments `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	dueJobs, err := listDueJobs(c, from, to.AddDate(0, 0, -1), userID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Calendar Page [SQL]: Error while querying due jobs `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	conflicts := 0
+	for _, a := range appointments {
+		if a.Conflict {
+			conflicts++
+		}
+	}
+
+	pageURL := func(view string, date time.Time) string {
+		query := url.Values{"view": {view}, "date": {date.Format("2006-01-02")}}
+		if userID != "" {
+			query.Set("user", userID)
+		}
+		return "/calendar?" + query.Encode()
+	}
+
+	title := "Week of " + first.Format("02 Jan 2006")
+	prev, next := first.AddDate(0, 0, -7), first.AddDate(0, 0, 7)
+	if view == "month" {
+		title = first.Format("January 2006")
+		prev, next = first.AddDate(0, -1, 0), first.AddDate(0, 1, 0)
+	}
+
+	c.HTML(http.StatusOK, "calendar.html", gin.H{
+		"Title":        title,
+		"View":         view,
+		"Date":         date.Format("2006-01-02"),
+		"Weeks":        calendarWeeks(from, to, first, last, appointments, dueJobs),
+		"Technician":   newReferencePicker("calendar_user", "user", "user", "Everyone", markSelected(referenceChoicesByID(c, "user", []string{userID}), []string{userID})),
+		"Conflicts":    conflicts,
+		"PrevURL":      pageURL(view, prev),
+		"NextURL":      pageURL(view, next),
+		"TodayURL":     pageURL(view, time.Now()),
+		"WeekURL":      pageURL("week", date),
+		"MonthURL":     pageURL("month", date),
+		"MineURL":      "/calendar?" + url.Values{"view": {view}, "date": {date.Format("2006-01-02")}, "user": {currentUserID(c)}}.Encode(),
+		"SelectedUser": userID,
+	})
+}
+
+func generateCalendarFeedToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate calendar feed token: %w", err)
+	}
+
+	return calendarFeedPrefix + base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// findCalendarFeed returns the user's calendar feed, nil when they have none.
+func findCalendarFeed(c *gin.Context, userID string) (*CalendarFeedLink, error) {
+	var feed CalendarFeedLink
+	query := `SELECT token_prefix, created_at, last_used_at FROM calendar_feeds WHERE user_id = $1`
+	err := conn.QueryRow(c.Request.Context(), query, userID).Scan(&feed.Prefix, &feed.CreatedAt, &feed.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// renderCalendarFeedError shows an error above the calendar feed section of
+// the profile page, leaving its buttons in place.
+func renderCalendarFeedError(c *gin.Context, message string) {
+	c.Header("HX-Retarget", "#calendar-feed-feedback")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+		"Message": message,
+	})
+}
+
+func renderCalendarFeed(c *gin.Context, feedURL string) {
+	feed, err := findCalendarFeed(c, currentUserID(c))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Calendar Feed [SQL]: Error while querying calendar_feeds `%v`", err))
+		renderCalendarFeedError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "calendarFeed.html", gin.H{
+		"CalendarFeed": feed,
+		"FeedURL":      feedURL,
+	})
+}
+
+// CreateCalendarFeed makes a new secret link to the user's calendar feed.
+// It replaces the old link, which stops working.
+func CreateCalendarFeed(c *gin.Context) {
+	if authenticatedByAPIToken(c) {
+		logger.LogToLogFile(c, fmt.Sprintf("Create Calendar Feed: User %s tried to create a feed link with a token", currentUserID(c)))
+		renderCalendarFeedError(c, "Error: API tokens cannot create calendar feed links.")
+		return
+	}
+
+	token, err := generateCalendarFeedToken()
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create Calendar Feed: %v", err))
+		renderCalendarFeedError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	query := `
+	INSERT INTO calendar_feeds (user_id, token_prefix, token_hash) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE
+	SET token_prefix = EXCLUDED.token_prefix, token_hash = EXCLUDED.token_hash, created_at = NOW(), last_used_at = NULL`
+	_, err = conn.Exec(c.Request.Context(), query, currentUserID(c), token[:len(calendarFeedPrefix)+6], hashToken(token))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create Calendar Feed [SQL]: Error while inserting into calendar_feeds `%v`", err))
+		renderCalendarFeedError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	renderCalendarFeed(c, "https://"+c.Request.Host+"/calendar/feed/"+token+".ics")
+}
+
+// DeleteCalendarFeed turns the user's calendar feed off.
+func DeleteCalendarFeed(c *gin.Context) {
+	_, err := conn.Exec(c.Request.Context(), `DELETE FROM calendar_feeds WHERE user_id = $1`, currentUserID(c))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Calendar Feed [SQL]: Error while deleting from calendar_feeds `%v`", err))
+		renderCalendarFeedError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	renderCalendarFeed(c, "")
+}
+
+// authenticateCalendarFeed finds the user of a calendar feed token and sets
+// the same context keys as logging in, so the feed only shows what the user
+// could see in Momentum.
+func authenticateCalendarFeed(c *gin.Context, token string) error {
+	var userID int
+	var username, role string
+	var lastUsedAt sql.NullTime
+
+	query := `
+	SELECT u.id, u.username, u.role, f.last_used_at
+	FROM calendar_feeds f
+	JOIN users u ON u.id = f.user_id
+	WHERE f.token_hash = $1`
+
+	if err := conn.QueryRow(c.Request.Context(), query, hashToken(token)).Scan(&userID, &username, &role, &lastUsedAt); err != nil {
+		return err
+	}
+
+	if !lastUsedAt.Valid || time.Since(lastUsedAt.Time) > apiTokenTouchInterval {
+		_, err := conn.Exec(c.Request.Context(), `UPDATE calendar_feeds SET last_used_at = NOW() WHERE user_id = $1`, userID)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Calendar Feed [SQL]: Error while updating last_used_at for user %d `%v`", userID, err))
+		}
+	}
+
+	c.Set("username", username)
+	c.Set("role", role)
+	c.Set("userID", strconv.Itoa(userID))
+	return nil
+}
+
+// CalendarFeed serves a user's appointments as an iCalendar feed that phone
+// and desktop calendars subscribe to. Calendar apps cannot log in, so the
+// secret token in the URL stands in for the session.
+func CalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	if err := authenticateCalendarFeed(c, token); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			logger.LogToLogFile(c, fmt.Sprintf("Calendar Feed [SQL]: Error while querying calendar_feeds `%v`", err))
+			c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+			return
+		}
+		c.String(http.StatusNotFound, "Calendar feed not found")
+		return
+	}
+
+	if !HasPermission(c, "jobs.view") {
+		logger.LogToLogFile(c, fmt.Sprintf("Calendar Feed: User %s lacks jobs.view", currentUserID(c)))
+		c.String(http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	now := time.Now()
+	appointments, err := listCalendarAppointments(c, now.Add(-calendarFeedPast), now.Add(calendarFeedFuture), currentUserID(c))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Calendar Feed [SQL]: Error while querying job_appointments `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	baseURL := "https://" + c.Request.Host
+	cal := ical.Calendar{Name: "Momentum – " + c.GetString("username")}
+	for _, a := range appointments {
+		description := "Status: " + a.Status
+		if a.Notes != "" {
+			description += "\n\n" + a.Notes
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         fmt.Sprintf("appointment-%d@%s", a.ID, c.Request.Host),
+			Stamp:       a.UpdatedAt,
+			Start:       a.StartsAt,
+			End:         a.EndsAt,
+			Summary:     a.Ticket + " " + a.Title,
+			Description: description,
+			URL:         fmt.Sprintf("%s/jobs/%d", baseURL, a.JobID),
+		})
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="momentum.ics"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	if err := cal.Write(c.Writer); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Calendar Feed: Error while writing the feed `%v`", err))
+	}
+}
@@ -2,92 +2,612 @@ package database
 
 import (
 	"Momentum/internal/logger"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Contact struct {
-	ID        int
-	Name      string
-	Email     string
-	Phone     string
-	CreatedAt time.Time
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	Email        string         `json:"email"`
+	Phone        string         `json:"phone"`
+	CustomFields map[string]any `json:"custom_fields"`
+	CreatedAt    time.Time      `json:"created_at"`
 }
 
-func SearchContact(c *gin.Context) {
-	contactQuery := c.Query("q_contact")
-	if contactQuery == "" {
-		return
+// ContactJob is a job a contact takes part in, either as its primary contact
+// or through job_contacts.
+type ContactJob struct {
+	JobID       int
+	Title       string
+	Ticket      string
+	Status      string
+	JobTypeName string
+	Role        string
+}
+
+func (cj ContactJob) RoleLabel() string {
+	if cj.Role == "primary" {
+		return "Primary Contact"
+	}
+	return JobContact{Role: cj.Role}.RoleLabel()
+}
+
+const contactColumns = `id, name, COALESCE(email, ''), COALESCE(phone, ''), custom_fields, created_at`
+
+func scanContacts(rows pgx.Rows) ([]Contact, error) {
+	defer rows.Close()
+
+	var contacts []Contact
+	for rows.Next() {
+		var contact Contact
+		if err := rows.Scan(&contact.ID, &contact.Name, &contact.Email, &contact.Phone, &contact.CustomFields, &contact.CreatedAt); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
 	}
 
+	return contacts, rows.Err()
+}
+
+func searchContacts(c *gin.Context, contactQuery string) ([]Contact, error) {
 	searchValue := "%" + contactQuery + "%"
-	query := `SELECT id, name, email, phone FROM contacts WHERE name ILIKE $1 OR email ILIKE $1 ORDER BY name LIMIT 10;`
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE name ILIKE $1 OR email ILIKE $1 ORDER BY name LIMIT 10;`
 
 	rows, err := conn.Query(c.Request.Context(), query, searchValue)
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Search Contact [SQL]: Failed to fetch contacts: %v", err))
-		c.HTML(http.StatusOK, "addJobModal.html", gin.H{
-			"Error": "An internal error occurred while searching contact. Please try again.",
-		})
-		return
+		return nil, err
+	}
+
+	return scanContacts(rows)
+}
+
+// listContacts returns one page of contacts by ID, optionally narrowed down
+// to names, emails or phones matching searchQuery.
+func listContacts(c *gin.Context, pagination Pagination, searchQuery string) ([]Contact, error) {
+	query := `
+	SELECT ` + contactColumns + `
+	FROM contacts
+	WHERE id > $1 AND (name ILIKE '%' || $3 || '%' OR email ILIKE '%' || $3 || '%' OR phone ILIKE '%' || $3 || '%')
+	ORDER BY id ASC
+	LIMIT $2`
+
+	rows, err := conn.Query(c.Request.Context(), query, pagination.After, pagination.Limit, searchQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanContacts(rows)
+}
+
+func findContact(c *gin.Context, id string) (Contact, error) {
+	var contact Contact
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE id = $1`
+	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&contact.ID, &contact.Name, &contact.Email, &contact.Phone, &contact.CustomFields, &contact.CreatedAt)
+	return contact, err
+}
+
+// findDuplicateContacts returns the contacts other than excludeID that share
+// the email (ignoring case) or the phone number (ignoring everything but
+// digits).
+func findDuplicateContacts(c *gin.Context, excludeID int, email, phone string) ([]Contact, error) {
+	query := `
+	SELECT ` + contactColumns + `
+	FROM contacts
+	WHERE id <> $1 AND (
+	    ($2 <> '' AND LOWER(email) = LOWER($2))
+	    OR (regexp_replace($3, '\D', '', 'g') <> ''
+	        AND regexp_replace(phone, '\D', '', 'g') = regexp_replace($3, '\D', '', 'g'))
+	)
+	ORDER BY name
+	LIMIT 10`
+
+	rows, err := conn.Query(c.Request.Context(), query, excludeID, email, phone)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanContacts(rows)
+}
+
+// emailTaken reports whether one of the duplicates already uses email, which
+// the UNIQUE constraint on contacts.email would reject.
+func emailTaken(duplicates []Contact, email string) (Contact, bool) {
+	for _, d := range duplicates {
+		if email != "" && strings.EqualFold(d.Email, email) {
+			return d, true
+		}
+	}
+	return Contact{}, false
+}
+
+func insertContact(c *gin.Context, name, email, phone string, customFields map[string]any) (Contact, error) {
+	var contact Contact
+	query := `INSERT INTO contacts (name, email, phone, custom_fields) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4) RETURNING ` + contactColumns
+	err := conn.QueryRow(c.Request.Context(), query, name, email, phone, customFields).Scan(&contact.ID, &contact.Name, &contact.Email, &contact.Phone, &contact.CustomFields, &contact.CreatedAt)
+	return contact, err
+}
+
+// listContactJobs returns the jobs the contact takes part in that the
+// logged-in user can see, once per role.
+func listContactJobs(c *gin.Context, contactID string) ([]ContactJob, error) {
+	query := `
+	SELECT j.id, j.title, j.ticket_id, j.status, jt.name, r.role
+	FROM (
+	    SELECT id AS job_id, 'primary' AS role FROM jobs WHERE primary_contact_id = $1
+	    UNION ALL
+	    SELECT job_id, role FROM job_contacts WHERE contact_id = $1
+	) r
+	JOIN jobs j ON j.id = r.job_id
+	JOIN job_types jt ON jt.id = j.job_type_id
+	WHERE job_type_access(j.job_type_id, $2, false, $3)
+	ORDER BY j.created_at DESC, r.role`
+
+	rows, err := conn.Query(c.Request.Context(), query, contactID, currentUserID(c), accessAllJobTypes(c))
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
-	var contacts []Contact
+	var jobs []ContactJob
 	for rows.Next() {
-		var contact Contact
-		if err := rows.Scan(&contact.ID, &contact.Name, &contact.Email, &contact.Phone); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Search Contact [SQL Row Scan]: Failed to scan row: %v", err))
-			c.HTML(http.StatusOK, "addJobModal.html", gin.H{
-				"Error": "An internal error occurred while searching contact. Please try again.",
-			})
-			return
+		var job ContactJob
+		if err := rows.Scan(&job.JobID, &job.Title, &job.Ticket, &job.Status, &job.JobTypeName, &job.Role); err != nil {
+			return nil, err
 		}
-		contacts = append(contacts, contact)
+		jobs = append(jobs, job)
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Search Contact [SQL Row Scan]: Error while iterating rows `%v`", err))
+	return jobs, rows.Err()
+}
+
+// listContactTransactions returns the financial transactions of the jobs the
+// contact takes part in.
+func listContactTransactions(c *gin.Context, contactID string) ([]Finance, error) {
+	query := `
+	SELECT ft.id, ft.description, ft.amount, ft.type, ft.transaction_date, ft.related_job_id, ft.created_at
+	FROM financial_transactions ft
+	JOIN jobs j ON j.id = ft.related_job_id
+	WHERE (j.primary_contact_id = $1 OR EXISTS (
+	        SELECT 1 FROM job_contacts jc WHERE jc.job_id = j.id AND jc.contact_id = $1
+	    ))
+	    AND job_type_access(j.job_type_id, $2, false, $3)
+	ORDER BY ft.transaction_date DESC, ft.id DESC`
+
+	rows, err := conn.Query(c.Request.Context(), query, contactID, currentUserID(c), accessAllJobTypes(c))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var finances []Finance
+	for rows.Next() {
+		var record Finance
+		if err := rows.Scan(&record.ID, &record.Description, &record.Amount, &record.Type, &record.TransactionDate, &record.RelatedJobID, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		finances = append(finances, record)
+	}
+
+	return finances, rows.Err()
+}
+
+func SearchContact(c *gin.Context) {
+	contactQuery := c.Query("q_contact")
+	if contactQuery == "" {
+		return
+	}
+
+	contacts, err := searchContacts(c, contactQuery)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Search Contact [SQL]: Failed to fetch contacts: %v", err))
 		c.HTML(http.StatusOK, "addJobModal.html", gin.H{
 			"Error": "An internal error occurred while searching contact. Please try again.",
 		})
 		return
 	}
 
+	// The job contacts picker of the edit modal and _referencePicker.html
+	// reuse these results.
 	c.HTML(http.StatusOK, "_contactSearchResults.html", gin.H{
-		"Contacts": contacts,
+		"Contacts":      contacts,
+		"ForJobContact": c.Query("for") == "job_contact",
+		"Picker":        c.Query("picker"),
+	})
+}
+
+func ContactList(c *gin.Context) {
+	var pagination Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Contact List [Bind Query]: Error while binding query to pagination struct `%v`", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 20
+	}
+
+	searchQuery := c.Query("q")
+
+	contacts, err := listContacts(c, pagination, searchQuery)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Contact List [SQL]: Error while querying contacts table `%v`", err))
+		c.String(http.StatusInternalServerError, "Error reading contact list.")
+		return
+	}
+
+	var nextCursor int
+	if len(contacts) == pagination.Limit {
+		nextCursor = contacts[len(contacts)-1].ID
+	}
+
+	c.HTML(http.StatusOK, "contactListRows.html", gin.H{
+		"Contacts":    contacts,
+		"NextCursor":  nextCursor,
+		"SearchQuery": searchQuery,
+	})
+}
+
+func ContactView(c *gin.Context) {
+	id := c.Param("id")
+
+	contact, err := findContact(c, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Contact View [SQL]: Contact {ID: %s} not found `%v`", id, err))
+		c.String(http.StatusNotFound, "Contact not found")
+		return
+	}
+
+	jobs, err := listContactJobs(c, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Contact View [SQL]: Error while querying jobs of contact %s `%v`", id, err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	var transactions []Finance
+	canViewFinance := HasPermission(c, "finance.view")
+	if canViewFinance {
+		transactions, err = listContactTransactions(c, id)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Contact View [SQL]: Error while querying transactions of contact %s `%v`", id, err))
+			c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+			return
+		}
+	}
+
+	duplicates, err := findDuplicateContacts(c, contact.ID, contact.Email, contact.Phone)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Contact View [SQL]: Error while looking for duplicates of contact %s `%v`", id, err))
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "contact")
+
+	c.HTML(http.StatusOK, "viewContact.html", gin.H{
+		"Contact":        contact,
+		"CustomFields":   customFieldDefs.display(c, contact.CustomFields),
+		"Jobs":           jobs,
+		"Transactions":   transactions,
+		"CanViewFinance": canViewFinance,
+		"Duplicates":     duplicates,
+		"CanEdit":        HasPermission(c, "contacts.write"),
+		"CanDelete":      HasPermission(c, "contacts.delete"),
 	})
 }
 
 func HandleNewContactModal(c *gin.Context) {
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "contact")
+
 	c.HTML(http.StatusOK, "addContactModal.html", gin.H{
 		"FormData": gin.H{
 			"name":  "",
 			"email": "",
 			"phone": "",
 		},
+		"CustomFieldInputs": customFieldDefs.inputs(c, nil, nil),
 	})
 }
 
 func CreateContact(c *gin.Context) {
 	name := c.PostForm("name")
-	email := c.PostForm("email")
-	phone := c.PostForm("phone")
-	var newContact Contact
+	email := strings.TrimSpace(c.PostForm("email"))
+	phone := strings.TrimSpace(c.PostForm("phone"))
 
-	query := `INSERT INTO contacts (name, email, phone) VALUES ($1, $2, $3) RETURNING id, name, email`
-	err := conn.QueryRow(c.Request.Context(), query, name, email, phone).Scan(&newContact.ID, &newContact.Name, &newContact.Email)
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "contact")
+	customFieldValues, customFields, fieldErrors := customFieldDefs.submit(c)
 
+	renderForm := func(status int, message string, duplicates []Contact) {
+		c.HTML(status, "addContactModal.html", gin.H{
+			"FormData": gin.H{
+				"name":  name,
+				"email": email,
+				"phone": phone,
+			},
+			"CustomFieldInputs": customFieldDefs.inputs(c, customFieldValues, fieldErrors),
+			"Duplicates":        duplicates,
+			"Error":             message,
+		})
+	}
+
+	if len(fieldErrors) > 0 {
+		renderForm(http.StatusUnprocessableEntity, "Please correct the highlighted fields.", nil)
+		return
+	}
+
+	duplicates, err := findDuplicateContacts(c, 0, email, phone)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create Contact [SQL]: Error while looking for duplicates `%v`", err))
+		renderForm(http.StatusUnprocessableEntity, "Failed to save contact. Please try again.", nil)
+		return
+	}
+
+	if existing, taken := emailTaken(duplicates, email); taken {
+		renderForm(http.StatusUnprocessableEntity, fmt.Sprintf("%s already uses this email.", existing.Name), duplicates)
+		return
+	}
+
+	// A shared phone number is allowed, but only once the user has seen the
+	// other contacts.
+	if len(duplicates) > 0 && c.PostForm("confirm_duplicate") != "true" {
+		renderForm(http.StatusUnprocessableEntity, "Contacts with the same phone number already exist. Create it anyway?", duplicates)
+		return
+	}
+
+	_, err = insertContact(c, name, email, phone, customFields)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("Create Contact [SQL]: Error to create a new contact `%v`", err))
-		c.HTML(http.StatusUnprocessableEntity, "addContactModal.html", gin.H{
-			"Error": "Failed to save contact. Please try again.",
-		})
+		renderForm(http.StatusUnprocessableEntity, "Failed to save contact. Please try again.", nil)
 		return
 	}
 
 	c.Data(http.StatusOK, "text/html; charset=utf-8", nil)
 }
+
+func EditContactModal(c *gin.Context) {
+	id := c.Param("id")
+
+	contact, err := findContact(c, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Contact Modal [SQL]: Contact {ID: %s} not found `%v`", id, err))
+		c.String(http.StatusNotFound, "Contact not found")
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "contact")
+
+	c.HTML(http.StatusOK, "editContactModal.html", gin.H{
+		"Contact":           contact,
+		"CustomFieldInputs": customFieldDefs.inputs(c, customFieldFormValues(contact.CustomFields), nil),
+	})
+}
+
+// UpdateContact saves the contact's details and defined custom fields. Keys
+// no definition covers are kept as they are.
+func UpdateContact(c *gin.Context) {
+	id := c.Param("id")
+	name := c.PostForm("name")
+	email := strings.TrimSpace(c.PostForm("email"))
+	phone := strings.TrimSpace(c.PostForm("phone"))
+
+	renderError := func(message string) {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	contactID, err := strconv.Atoi(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid contact ID")
+		return
+	}
+
+	if name == "" {
+		renderError("Name cannot be empty.")
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "contact")
+
+	_, customFields, fieldErrors := customFieldDefs.submit(c)
+	if len(fieldErrors) > 0 {
+		renderError(customFieldDefs.errorMessage(fieldErrors))
+		return
+	}
+
+	duplicates, err := findDuplicateContacts(c, contactID, email, phone)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Contact [SQL]: Error while looking for duplicates `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	if existing, taken := emailTaken(duplicates, email); taken {
+		renderError(fmt.Sprintf("%s already uses this email. Merge the contacts instead.", existing.Name))
+		return
+	}
+
+	query := `
+	UPDATE contacts
+	SET name = $2, email = NULLIF($3, ''), phone = NULLIF($4, ''), custom_fields = (custom_fields - $6::text[]) || $5
+	WHERE id = $1`
+
+	cmdTag, err := conn.Exec(c.Request.Context(), query, contactID, name, email, phone, customFields, customFieldDefs.names())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Contact [SQL]: Error while updating contact %s `%v`", id, err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	if cmdTag.RowsAffected() == 0 {
+		renderError("Contact not found.")
+		return
+	}
+
+	c.Header("HX-Redirect", "/contacts/"+id)
+	c.Status(http.StatusOK)
+}
+
+// contactReferenceTables are the tables whose custom fields can hold contact
+// IDs, each with the definitions that apply to one of its rows r.
+var contactReferenceTables = []struct{ table, definitions string }{
+	{"jobs", "(SELECT custom_field_definitions FROM job_types WHERE id = r.job_type_id)"},
+	{"contacts", "(SELECT definitions FROM entity_custom_fields WHERE entity = 'contact')"},
+	{"users", "(SELECT definitions FROM entity_custom_fields WHERE entity = 'user')"},
+}
+
+// contactFieldReferences selects the id and field_name of every row of table
+// whose contact custom field holds the contact ID given as placeholder.
+func contactFieldReferences(table, definitions, placeholder string) string {
+	return fmt.Sprintf(`
+	SELECT r.id, d->>'field_name' AS field_name
+	FROM %s r
+	CROSS JOIN LATERAL jsonb_array_elements(COALESCE(%s, '[]'::jsonb)) d
+	WHERE d->>'field_type' = 'contact' AND r.custom_fields->>(d->>'field_name') = %s::text`, table, definitions, placeholder)
+}
+
+// MergeContact folds the duplicate_id contact into the contact of the URL:
+// its jobs, job links and the contact custom fields naming it move over,
+// missing details and custom fields are copied, and the duplicate is deleted.
+func MergeContact(c *gin.Context) {
+	id := c.Param("id")
+	duplicateID := c.PostForm("duplicate_id")
+
+	renderError := func(message string) {
+		c.Header("HX-Retarget", "#contact-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	if duplicateID == "" || duplicateID == id {
+		renderError("Choose another contact to merge into this one.")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Merge Contact [SQL]: Error while starting transaction `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var locked int
+	err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM (SELECT id FROM contacts WHERE id IN ($1, $2) FOR UPDATE) c`, id, duplicateID).Scan(&locked)
+	if err != nil || locked != 2 {
+		logger.LogToLogFile(c, fmt.Sprintf("Merge Contact [SQL]: Contacts %s and %s not found `%v`", id, duplicateID, err))
+		renderError("Contact not found.")
+		return
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE jobs SET primary_contact_id = $1 WHERE primary_contact_id = $2`, id, duplicateID)
+	if err == nil {
+		_, err = tx.Exec(ctx, `
+		INSERT INTO job_contacts (job_id, contact_id, role)
+		SELECT job_id, $1, role FROM job_contacts WHERE contact_id = $2
+		ON CONFLICT (job_id, contact_id, role) DO NOTHING`, id, duplicateID)
+	}
+	for _, ref := range contactReferenceTables {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+		WITH refs AS (%s)
+		UPDATE %s r
+		SET custom_fields = r.custom_fields || (SELECT jsonb_object_agg(field_name, $2::int) FROM refs WHERE refs.id = r.id)
+		WHERE r.id IN (SELECT id FROM refs)`, contactFieldReferences(ref.table, ref.definitions, "$1"), ref.table), duplicateID, id)
+	}
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Merge Contact [SQL]: Error while moving jobs of contact %s to %s `%v`", duplicateID, id, err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	// The duplicate goes first so its email is free to copy over.
+	var email, phone *string
+	var customFields map[string]any
+	err = tx.QueryRow(ctx, `DELETE FROM contacts WHERE id = $1 RETURNING email, phone, custom_fields`, duplicateID).Scan(&email, &phone, &customFields)
+	if err == nil {
+		_, err = tx.Exec(ctx, `
+		UPDATE contacts
+		SET email = COALESCE(email, $2), phone = COALESCE(phone, $3), custom_fields = $4::jsonb || custom_fields
+		WHERE id = $1`, id, email, phone, customFields)
+	}
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Merge Contact [SQL]: Error while merging contact %s into %s `%v`", duplicateID, id, err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Merge Contact [SQL]: Error while committing transaction `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	logger.LogToLogFile(c, fmt.Sprintf("Merge Contact: Contact %s merged into %s", duplicateID, id))
+	c.Header("HX-Redirect", "/contacts/"+id)
+	c.Status(http.StatusOK)
+}
+
+// DeleteContact deletes a contact no job or contact custom field refers to.
+// Contacts still in use have to be merged into another one instead.
+func DeleteContact(c *gin.Context) {
+	id := c.Param("id")
+
+	renderError := func(message string) {
+		c.Header("HX-Retarget", "#contact-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	query := `
+	DELETE FROM contacts
+	WHERE id = $1
+	    AND NOT EXISTS (SELECT 1 FROM jobs WHERE primary_contact_id = $1)
+	    AND NOT EXISTS (SELECT 1 FROM job_contacts WHERE contact_id = $1)`
+	for _, ref := range contactReferenceTables {
+		query += "\n\t    AND NOT EXISTS (" + contactFieldReferences(ref.table, ref.definitions, "$2") + ")"
+	}
+
+	cmdTag, err := conn.Exec(c.Request.Context(), query, id, id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "22P02" {
+			c.String(http.StatusBadRequest, "Invalid contact ID")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Contact [SQL]: Error while deleting contact %s `%v`", id, err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		if _, err := findContact(c, id); errors.Is(err, pgx.ErrNoRows) {
+			renderError("Contact not found.")
+			return
+		}
+		renderError("This contact is still on jobs or named in custom fields. Merge it into another contact instead.")
+		return
+	}
+
+	logger.LogToLogFile(c, fmt.Sprintf("Delete Contact: Contact %s deleted", id))
+	c.Header("HX-Redirect", "/contacts")
+	c.Status(http.StatusOK)
+}
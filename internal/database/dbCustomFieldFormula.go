@@ -0,0 +1,250 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	errFormulaMissingValue = errors.New("a value the formula needs is missing")
+	errFormulaDivByZero    = errors.New("division by zero")
+)
+
+// formulaLookup returns the value of a field a formula refers to and whether
+// it is an amount of money.
+type formulaLookup func(name string) (decimal.Decimal, bool, error)
+
+// formulaParser evaluates the formula of a computed field while reading it:
+// numbers, {field_name} references, + - * / and parentheses.
+type formulaParser struct {
+	src      string
+	pos      int
+	lookup   formulaLookup
+	currency bool
+}
+
+// evalFormula works out a formula. The result is money when any field it
+// refers to is.
+func evalFormula(formula string, lookup formulaLookup) (decimal.Decimal, bool, error) {
+	p := &formulaParser{src: formula, lookup: lookup}
+	result, err := p.expr()
+	if err != nil {
+		return decimal.Zero, false, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return decimal.Zero, false, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos+1)
+	}
+	return result, p.currency, nil
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *formulaParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *formulaParser) expr() (decimal.Decimal, error) {
+	left, err := p.term()
+	if err != nil {
+		return left, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return left, err
+		}
+		if op == '+' {
+			left = left.Add(right)
+		} else {
+			left = left.Sub(right)
+		}
+	}
+}
+
+func (p *formulaParser) term() (decimal.Decimal, error) {
+	left, err := p.factor()
+	if err != nil {
+		return left, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return left, err
+		}
+		if op == '*' {
+			left = left.Mul(right)
+		} else if right.IsZero() {
+			return left, errFormulaDivByZero
+		} else {
+			left = left.Div(right)
+		}
+	}
+}
+
+func (p *formulaParser) factor() (decimal.Decimal, error) {
+	switch c := p.peek(); {
+	case c == '-':
+		p.pos++
+		value, err := p.factor()
+		return value.Neg(), err
+	case c == '(':
+		p.pos++
+		value, err := p.expr()
+		if err != nil {
+			return value, err
+		}
+		if p.peek() != ')' {
+			return value, fmt.Errorf("missing ')' at position %d", p.pos+1)
+		}
+		p.pos++
+		return value, nil
+	case c == '{':
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 0 {
+			return decimal.Zero, fmt.Errorf("missing '}' at position %d", p.pos+1)
+		}
+		name := strings.TrimSpace(p.src[p.pos+1 : p.pos+end])
+		p.pos += end + 1
+		value, currency, err := p.lookup(name)
+		if currency {
+			p.currency = true
+		}
+		return value, err
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		return decimal.NewFromString(p.src[start:p.pos])
+	case c == 0:
+		return decimal.Zero, errors.New("unexpected end of formula")
+	default:
+		return decimal.Zero, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+	}
+}
+
+// checkFormula says what is wrong with the formula of the computed field
+// name, or returns "" when it only refers to other number, currency or
+// computed fields and reads correctly.
+func (defs CustomFieldDefList) checkFormula(name, formula string) string {
+	if strings.TrimSpace(formula) == "" {
+		return "Error: Computed fields need a formula."
+	}
+
+	_, _, err := evalFormula(formula, func(ref string) (decimal.Decimal, bool, error) {
+		def, ok := defs.find(ref)
+		if !ok || ref == name {
+			return decimal.Zero, false, fmt.Errorf("{%s} is not another field", ref)
+		}
+		switch def.FieldType {
+		case "number", "computed":
+			return decimal.NewFromInt(1), false, nil
+		case "currency":
+			return decimal.NewFromInt(1), true, nil
+		}
+		return decimal.Zero, false, fmt.Errorf("{%s} is not a number, currency or computed field", ref)
+	})
+	if err != nil {
+		return fmt.Sprintf("Error: Formula: %v.", err)
+	}
+
+	// compute never fills fields that need each other, so refuse a formula
+	// that leads back to its own field through other computed fields.
+	seen := map[string]bool{}
+	var leadsBack func(formula string) (string, bool)
+	leadsBack = func(formula string) (string, bool) {
+		for _, ref := range formulaReferences(formula) {
+			def, ok := defs.find(ref)
+			if !ok || def.FieldType != "computed" || seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if slices.Contains(formulaReferences(def.Formula), name) {
+				return ref, true
+			}
+			if _, ok := leadsBack(def.Formula); ok {
+				return ref, true
+			}
+		}
+		return "", false
+	}
+	if ref, ok := leadsBack(formula); ok {
+		return fmt.Sprintf("Error: Formula: {%s} already depends on this field.", ref)
+	}
+	return ""
+}
+
+// formulaReferences lists the field names a formula refers to.
+func formulaReferences(formula string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(formula, '{')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(formula[start:], '}')
+		if end < 0 {
+			return names
+		}
+		names = append(names, strings.TrimSpace(formula[start+1:start+end]))
+		formula = formula[start+end+1:]
+	}
+}
+
+// compute fills in the computed fields from the typed values. A computed
+// field may use another one, so this repeats until nothing more can be
+// worked out; a field whose values are missing is left out.
+func (defs CustomFieldDefList) compute(typed map[string]any) {
+	lookup := func(name string) (decimal.Decimal, bool, error) {
+		switch v := typed[name].(type) {
+		case float64:
+			return decimal.NewFromFloat(v), false, nil
+		case decimal.Decimal:
+			return v, true, nil
+		}
+		return decimal.Zero, false, errFormulaMissingValue
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for _, def := range defs {
+			if _, done := typed[def.FieldName]; done || def.FieldType != "computed" {
+				continue
+			}
+			result, currency, err := evalFormula(def.Formula, lookup)
+			if err != nil {
+				continue
+			}
+			if currency {
+				typed[def.FieldName] = result.Round(2)
+			} else {
+				typed[def.FieldName] = result.InexactFloat64()
+			}
+			progress = true
+		}
+	}
+}
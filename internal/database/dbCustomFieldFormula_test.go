@@ -0,0 +1,131 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestEvalFormula(t *testing.T) {
+	values := map[string]struct {
+		value    decimal.Decimal
+		currency bool
+	}{
+		"a":     {decimal.NewFromInt(5), false},
+		"qty":   {decimal.NewFromInt(3), false},
+		"price": {decimal.RequireFromString("2.50"), true},
+	}
+	lookup := func(name string) (decimal.Decimal, bool, error) {
+		v, ok := values[name]
+		if !ok {
+			return decimal.Zero, false, fmt.Errorf("{%s} is not another field", name)
+		}
+		return v.value, v.currency, nil
+	}
+
+	tests := []struct {
+		formula  string
+		want     string
+		currency bool
+	}{
+		{"1 + 2 * 3", "7", false},
+		{"(1 + 2) * 3", "9", false},
+		{"10 - 4 - 3", "3", false},
+		{"8 / 4 / 2", "1", false},
+		{"2 * 3 + 4 * 5", "26", false},
+		{"-3 + 5", "2", false},
+		{"-(2 + 3) * 2", "-10", false},
+		{"2 * -3", "-6", false},
+		{"--4", "4", false},
+		{" 1.5 * 2 ", "3", false},
+		{"{a} * 2", "10", false},
+		{"{ a } - 1", "4", false},
+		{"{price} * {qty}", "7.5", true},
+		{"({a} + {qty}) / 2", "4", false},
+	}
+
+	for _, tt := range tests {
+		got, currency, err := evalFormula(tt.formula, lookup)
+		if err != nil {
+			t.Errorf("evalFormula(%q) failed: %v", tt.formula, err)
+			continue
+		}
+		if !got.Equal(decimal.RequireFromString(tt.want)) || currency != tt.currency {
+			t.Errorf("evalFormula(%q) = (%s, %v), want (%s, %v)", tt.formula, got, currency, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestEvalFormulaErrors(t *testing.T) {
+	lookup := func(name string) (decimal.Decimal, bool, error) {
+		if name == "zero" {
+			return decimal.Zero, false, nil
+		}
+		return decimal.Zero, false, errFormulaMissingValue
+	}
+
+	tests := []struct {
+		formula string
+		wantErr error // nil when any error will do
+	}{
+		{"1 / 0", errFormulaDivByZero},
+		{"1 / (2 - 2)", errFormulaDivByZero},
+		{"5 / {zero}", errFormulaDivByZero},
+		{"{missing} + 1", errFormulaMissingValue},
+		{"(1 + 2", nil},
+		{"((1 + 2) * 3", nil},
+		{"{a + 1", nil},
+		{"1 +", nil},
+		{"", nil},
+		{"1 2", nil},
+		{"1 + 2)", nil},
+		{"1..2", nil},
+		{"1 % 2", nil},
+	}
+
+	for _, tt := range tests {
+		_, _, err := evalFormula(tt.formula, lookup)
+		if err == nil {
+			t.Errorf("evalFormula(%q) succeeded, want an error", tt.formula)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("evalFormula(%q) = %v, want %v", tt.formula, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckFormulaRejectsCycles(t *testing.T) {
+	defs := CustomFieldDefList{
+		{FieldName: "qty", FieldType: "number"},
+		{FieldName: "price", FieldType: "currency"},
+		{FieldName: "b", FieldType: "computed", Formula: "{a} * 2"},
+		{FieldName: "c", FieldType: "computed", Formula: "{b} + {qty}"},
+		{FieldName: "total", FieldType: "computed", Formula: "{price} * {qty}"},
+		{FieldName: "loop", FieldType: "computed", Formula: "{loop2} + 1"},
+		{FieldName: "loop2", FieldType: "computed", Formula: "{loop} + 1"},
+	}
+
+	tests := []struct {
+		name    string
+		formula string
+		reject  bool
+	}{
+		{"a", "{qty} + 1", false},
+		{"a", "{total} * 2", false},
+		{"a", "{b} + 1", true},
+		{"a", "{qty} + {c}", true},
+		{"a", "{loop} + 1", false},
+		{"a", "{a} + 1", true},
+		{"a", "{text}", true},
+	}
+
+	for _, tt := range tests {
+		msg := defs.checkFormula(tt.name, tt.formula)
+		if (msg != "") != tt.reject {
+			t.Errorf("checkFormula(%q, %q) = %q, want rejected: %v", tt.name, tt.formula, msg, tt.reject)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomFieldRule makes a field depend on the value of another field of the
+// same definitions, e.g. show "Warranty number" only when "Under warranty"
+// is checked.
+type CustomFieldRule struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"` // "equals", "not_equals", "filled" or "empty"
+	Value    string `json:"value,omitempty"`
+}
+
+var customFieldRuleOperators = []CustomFieldType{
+	{Name: "equals", Label: "is"},
+	{Name: "not_equals", Label: "is not"},
+	{Name: "filled", Label: "is filled in"},
+	{Name: "empty", Label: "is empty"},
+}
+
+func (r *CustomFieldRule) String() string {
+	if r == nil {
+		return ""
+	}
+	for _, op := range customFieldRuleOperators {
+		if op.Name == r.Operator {
+			if r.Operator == "equals" || r.Operator == "not_equals" {
+				return fmt.Sprintf("%s %s %q", r.Field, op.Label, r.Value)
+			}
+			return r.Field + " " + op.Label
+		}
+	}
+	return r.Field
+}
+
+// matches reports whether the rule holds for the current values of the
+// field it refers to. A checkbox counts as "true" when checked and as empty
+// otherwise; a multi-select equals each of its options.
+func (r *CustomFieldRule) matches(current []string) bool {
+	filled := len(current) > 0
+	switch r.Operator {
+	case "equals":
+		return slices.Contains(current, r.Value)
+	case "not_equals":
+		return !slices.Contains(current, r.Value)
+	case "filled":
+		return filled
+	case "empty":
+		return !filled
+	}
+	return false
+}
+
+// parseCustomFieldRule reads a rule from the definition form. An empty field
+// means no rule; the message says what is wrong with it.
+func (defs CustomFieldDefList) parseCustomFieldRule(name, field, operator, value string) (*CustomFieldRule, string) {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return nil, ""
+	}
+	if field == name {
+		return nil, "Error: A field cannot depend on itself."
+	}
+	ref, ok := defs.find(field)
+	if !ok {
+		return nil, fmt.Sprintf("Error: Field '%s' not found.", field)
+	}
+	if ref.FieldType == "computed" || ref.FieldType == "file" {
+		return nil, fmt.Sprintf("Error: Fields cannot depend on the %s field '%s'.", ref.FieldType, field)
+	}
+	if !slices.ContainsFunc(customFieldRuleOperators, func(op CustomFieldType) bool { return op.Name == operator }) {
+		return nil, "Error: Choose how the field depends on the other field."
+	}
+
+	rule := &CustomFieldRule{Field: field, Operator: operator}
+	if operator == "equals" || operator == "not_equals" {
+		rule.Value = strings.TrimSpace(value)
+		if ref.FieldType == "checkbox" {
+			rule.Value = "true"
+		}
+	}
+	return rule, ""
+}
+
+// ruleValues turns a submitted value into what rules compare against.
+func (def CustomFieldDef) ruleValues(value string) []string {
+	value = strings.TrimSpace(value)
+	if def.FieldType == "checkbox" {
+		if checked, _ := def.parse(value); checked == true {
+			return []string{"true"}
+		}
+		return nil
+	}
+
+	var current []string
+	for _, v := range strings.Split(value, "\n") {
+		if v = strings.TrimSpace(v); v != "" {
+			current = append(current, v)
+		}
+	}
+	return current
+}
+
+// active applies the rules to the submitted values: fields whose visibility
+// rule does not hold are left out, and fields whose required rule holds
+// become required. A field depending on a hidden field sees it as empty.
+func (defs CustomFieldDefList) active(values map[string]string) CustomFieldDefList {
+	visible := make(map[string]bool, len(defs))
+	var isVisible func(name string, depth int) bool
+	isVisible = func(name string, depth int) bool {
+		if shown, done := visible[name]; done {
+			return shown
+		}
+		def, ok := defs.find(name)
+		if !ok || depth > len(defs) {
+			return false
+		}
+		shown := def.VisibleWhen == nil || def.VisibleWhen.matches(defs.ruleValuesOf(def.VisibleWhen.Field, values, isVisible, depth))
+		visible[name] = shown
+		return shown
+	}
+
+	var active CustomFieldDefList
+	for _, def := range defs {
+		if !isVisible(def.FieldName, 0) {
+			continue
+		}
+		if def.RequiredWhen != nil && def.RequiredWhen.matches(defs.ruleValuesOf(def.RequiredWhen.Field, values, isVisible, 0)) {
+			def.IsRequired = true
+		}
+		active = append(active, def)
+	}
+	return active
+}
+
+func (defs CustomFieldDefList) ruleValuesOf(name string, values map[string]string, isVisible func(string, int) bool, depth int) []string {
+	ref, ok := defs.find(name)
+	if !ok || !isVisible(name, depth+1) {
+		return nil
+	}
+	return ref.ruleValues(values[name])
+}
+
+// renameRuleField points rules and formulas at a field's new name.
+func (defs CustomFieldDefList) renameRuleField(oldName, newName string) {
+	for i := range defs {
+		for _, rule := range []*CustomFieldRule{defs[i].VisibleWhen, defs[i].RequiredWhen} {
+			if rule != nil && rule.Field == oldName {
+				rule.Field = newName
+			}
+		}
+		defs[i].Formula = strings.ReplaceAll(defs[i].Formula, "{"+oldName+"}", "{"+newName+"}")
+	}
+}
+
+// dropRuleField removes the rules depending on a deleted field.
+func (defs CustomFieldDefList) dropRuleField(name string) {
+	for i := range defs {
+		if defs[i].VisibleWhen != nil && defs[i].VisibleWhen.Field == name {
+			defs[i].VisibleWhen = nil
+		}
+		if defs[i].RequiredWhen != nil && defs[i].RequiredWhen.Field == name {
+			defs[i].RequiredWhen = nil
+		}
+	}
+}
+
+// rulesFromForm reads the visibility and required rules of the field name
+// from the definition form.
+func (defs CustomFieldDefList) rulesFromForm(c *gin.Context, name string) (*CustomFieldRule, *CustomFieldRule, string) {
+	visibleWhen, msg := defs.parseCustomFieldRule(name, c.PostForm("visible_field"), c.PostForm("visible_operator"), c.PostForm("visible_value"))
+	if msg != "" {
+		return nil, nil, msg
+	}
+	requiredWhen, msg := defs.parseCustomFieldRule(name, c.PostForm("required_field"), c.PostForm("required_operator"), c.PostForm("required_value"))
+	return visibleWhen, requiredWhen, msg
+}
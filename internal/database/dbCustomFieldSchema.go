@@ -0,0 +1,566 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type CustomFieldType struct {
+	Name  string
+	Label string
+}
+
+var customFieldTypes = []CustomFieldType{
+	{Name: "text", Label: "Text (Single Line)"},
+	{Name: "textarea", Label: "Text (Multi-Line)"},
+	{Name: "number", Label: "Number"},
+	{Name: "date", Label: "Date"},
+	{Name: "checkbox", Label: "Checkbox (Yes/No)"},
+	{Name: "select", Label: "Select (Dropdown)"},
+	{Name: "multiselect", Label: "Multi-Select"},
+	{Name: "user", Label: "User"},
+	{Name: "contact", Label: "Contact"},
+	{Name: "currency", Label: "Currency"},
+	{Name: "file", Label: "File"},
+	{Name: "url", Label: "URL"},
+	{Name: "email", Label: "Email"},
+	{Name: "phone", Label: "Phone"},
+	{Name: "computed", Label: "Computed (read-only)"},
+}
+
+// reservedCustomFieldNames are keys of custom_fields the application writes
+// itself, so no definition may take them over.
+var reservedCustomFieldNames = []string{"thumbnail_url"}
+
+var customFieldNameFormat = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var errCustomFieldValuesDoNotFit = errors.New("stored values do not fit the new definition")
+
+func isCustomFieldType(name string) bool {
+	return slices.ContainsFunc(customFieldTypes, func(t CustomFieldType) bool { return t.Name == name })
+}
+
+// hasOptions reports whether values of the field are picked from its
+// options.
+func (def CustomFieldDef) hasOptions() bool {
+	return def.FieldType == "select" || def.FieldType == "multiselect"
+}
+
+// customFieldQuerier is what both the pool and a transaction offer.
+type customFieldQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// CustomFieldRecord is a job, contact or user together with its stored
+// custom field values.
+type CustomFieldRecord struct {
+	ID           int
+	Label        string
+	URL          string
+	CustomFields map[string]any
+}
+
+// CustomFieldConversion is how one stored value turns out under a changed
+// definition.
+type CustomFieldConversion struct {
+	Record    CustomFieldRecord
+	Current   any
+	New       any
+	Problem   string
+	Removed   bool
+	Unchanged bool
+}
+
+// CustomFieldProblem lists what is wrong with the stored values of a record.
+type CustomFieldProblem struct {
+	Record   CustomFieldRecord
+	Problems []string
+}
+
+// listCustomFieldRecords returns the records of the target, only those
+// storing fieldName when it is set. lock takes row locks for a rewrite.
+func listCustomFieldRecords(ctx context.Context, q customFieldQuerier, target customFieldTarget, fieldName string, lock bool) ([]CustomFieldRecord, error) {
+	table, label, condition := target.records()
+	query := `SELECT id, ` + label + `, COALESCE(custom_fields, '{}'::jsonb) FROM ` + table + ` WHERE ` + condition
+	args := []any{target.key()}
+	if fieldName != "" {
+		query += ` AND custom_fields ? $2`
+		args = append(args, fieldName)
+	}
+	query += ` ORDER BY id`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []CustomFieldRecord
+	for rows.Next() {
+		var record CustomFieldRecord
+		if err := rows.Scan(&record.ID, &record.Label, &record.CustomFields); err != nil {
+			return nil, err
+		}
+		record.URL = target.recordURL(record.ID)
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// fetchCustomFieldsTx locks the definitions of target for the rest of tx and
+// returns them with their version.
+func fetchCustomFieldsTx(ctx context.Context, tx pgx.Tx, target customFieldTarget) (CustomFieldDefList, int, error) {
+	var defs CustomFieldDefList
+	var version int
+	err := tx.QueryRow(ctx, target.selectQuery()+" FOR UPDATE", target.key()).Scan(&defs, &version)
+	return defs, version, err
+}
+
+// updateCustomFieldsTx saves the definitions and returns their new version.
+func updateCustomFieldsTx(ctx context.Context, tx pgx.Tx, target customFieldTarget, defs CustomFieldDefList) (int, error) {
+	if defs == nil {
+		defs = CustomFieldDefList{}
+	}
+	var version int
+	err := tx.QueryRow(ctx, target.updateQuery(), defs, target.key()).Scan(&version)
+	return version, err
+}
+
+// submittedCustomFieldsVersion is the version of the definitions the admin's
+// page shows. DELETE requests carry it in the query string. It is required,
+// so no client can skip the conflict check by leaving it out.
+func submittedCustomFieldsVersion(c *gin.Context) (int, bool) {
+	value := c.PostForm("version")
+	if value == "" {
+		value = c.Query("version")
+	}
+	version, err := strconv.Atoi(value)
+	return version, err == nil
+}
+
+// convertCustomFieldValues works out how every stored value of a field turns
+// out under its new definition. Values are only converted when the type or
+// the options changed; a rename alone keeps them as they are.
+func convertCustomFieldValues(records []CustomFieldRecord, old, updated CustomFieldDef) []CustomFieldConversion {
+	mustConvert := old.FieldType != updated.FieldType ||
+		(updated.hasOptions() && !slices.Equal(old.Options, updated.Options))
+
+	// A stored empty value is dropped rather than reported as missing.
+	target := updated
+	target.IsRequired = false
+
+	conversions := make([]CustomFieldConversion, 0, len(records))
+	for _, record := range records {
+		current := record.CustomFields[old.FieldName]
+		conversion := CustomFieldConversion{Record: record, Current: current, New: current, Unchanged: true}
+		if mustConvert {
+			converted, problem := target.convert(current)
+			conversion.New = converted
+			conversion.Problem = problem
+			conversion.Removed = problem == "" && converted == nil
+			conversion.Unchanged = problem == "" && sameCustomFieldValue(converted, current)
+		}
+		conversions = append(conversions, conversion)
+	}
+	return conversions
+}
+
+// rewriteCustomFieldValues moves the stored values of a field from its old
+// definition to the new one inside tx. Values that do not fit are removed
+// when discard is set; otherwise nothing is written and the number of
+// misfits comes back with errCustomFieldValuesDoNotFit.
+func rewriteCustomFieldValues(ctx context.Context, tx pgx.Tx, target customFieldTarget, old, updated CustomFieldDef, discard bool) (int, error) {
+	records, err := listCustomFieldRecords(ctx, tx, target, old.FieldName, true)
+	if err != nil {
+		return 0, err
+	}
+
+	conversions := convertCustomFieldValues(records, old, updated)
+
+	misfits := 0
+	for _, conversion := range conversions {
+		if conversion.Problem != "" {
+			misfits++
+		}
+	}
+	if misfits > 0 && !discard {
+		return misfits, errCustomFieldValuesDoNotFit
+	}
+
+	if old.FieldName == updated.FieldName && !slices.ContainsFunc(conversions, func(cv CustomFieldConversion) bool { return !cv.Unchanged }) {
+		return 0, nil
+	}
+
+	table, _, _ := target.records()
+	query := `UPDATE ` + table + ` SET custom_fields = $2 WHERE id = $1`
+	for _, conversion := range conversions {
+		values := conversion.Record.CustomFields
+		delete(values, old.FieldName)
+		if conversion.Problem == "" && conversion.New != nil {
+			values[updated.FieldName] = conversion.New
+		}
+		if _, err := tx.Exec(ctx, query, conversion.Record.ID, values); err != nil {
+			return 0, err
+		}
+	}
+
+	return misfits, nil
+}
+
+// checkCustomFieldValues lists the records whose stored values no longer fit
+// the definitions: values of the wrong type or outside the options, missing
+// required fields, and keys no definition covers.
+func checkCustomFieldValues(defs CustomFieldDefList, records []CustomFieldRecord) []CustomFieldProblem {
+	var report []CustomFieldProblem
+	for _, record := range records {
+		var problems []string
+		for _, def := range defs.active(customFieldFormValues(record.CustomFields)) {
+			value, stored := record.CustomFields[def.FieldName]
+			if !stored {
+				if _, problem := def.parse(""); problem != "" {
+					problems = append(problems, fmt.Sprintf("%s: %s", def.FieldLabel, problem))
+				}
+				continue
+			}
+			if _, problem := def.convert(value); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s: %q %s", def.FieldLabel, customFieldString(value), strings.ToLower(problem)))
+			}
+		}
+
+		var orphans []string
+		for key := range record.CustomFields {
+			if _, ok := defs.find(key); !ok && !slices.Contains(reservedCustomFieldNames, key) {
+				orphans = append(orphans, key)
+			}
+		}
+		slices.Sort(orphans)
+		for _, key := range orphans {
+			problems = append(problems, fmt.Sprintf("%s: no field of this name is defined", key))
+		}
+
+		if len(problems) > 0 {
+			report = append(report, CustomFieldProblem{Record: record, Problems: problems})
+		}
+	}
+	return report
+}
+
+func renderCustomFieldError(c *gin.Context, message string) {
+	c.Header("HX-Retarget", "#custom-field-feedback")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+		"Message": message,
+	})
+}
+
+// renderCustomFieldList answers a change with the new list, the new version
+// for the next change and an emptied feedback area.
+func renderCustomFieldList(c *gin.Context, target customFieldTarget, defs CustomFieldDefList, version int) {
+	c.HTML(http.StatusOK, "customFieldList.html", gin.H{
+		"Standalone":    true,
+		"Version":       version,
+		"FieldsURL":     target.URL(),
+		"CustomFields":  defs,
+		"FieldTypes":    customFieldTypes,
+		"RuleOperators": customFieldRuleOperators,
+	})
+}
+
+// renderCustomFieldConflict tells the admin someone else changed the
+// definitions meanwhile and swaps in the current list and version.
+func renderCustomFieldConflict(c *gin.Context, target customFieldTarget, defs CustomFieldDefList, version int) {
+	c.Header("HX-Retarget", "#custom-field-feedback")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "customFieldConflict.html", gin.H{
+		"Message":       "Someone else changed these fields meanwhile, so nothing was saved. The list now shows their changes; please make yours again.",
+		"Version":       version,
+		"FieldsURL":     target.URL(),
+		"CustomFields":  defs,
+		"FieldTypes":    customFieldTypes,
+		"RuleOperators": customFieldRuleOperators,
+	})
+}
+
+// changeCustomFields runs change on the locked definitions of the route's
+// target in one transaction, saves what it returns and renders the list.
+// The change is refused when the definitions moved past the version the
+// admin's page shows. change may also rewrite stored values through tx; a
+// message it returns is shown to the admin and nothing is saved.
+func changeCustomFields(c *gin.Context, handler string, change func(ctx context.Context, tx pgx.Tx, target customFieldTarget, defs CustomFieldDefList) (CustomFieldDefList, string, error)) {
+	target, ok := customFieldTargetFromRoute(c)
+	if !ok {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	submittedVersion, ok := submittedCustomFieldsVersion(c)
+	if !ok {
+		renderCustomFieldError(c, "Error: Missing or invalid version. Reload and try again.")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while starting transaction `%v`", handler, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	defs, version, err := fetchCustomFieldsTx(ctx, tx, target)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while fetching custom fields for %s `%v`", handler, target, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+	if submittedVersion != version {
+		logger.LogToLogFile(c, fmt.Sprintf("%s: Custom fields of %s are at version %d, not %d", handler, target, version, submittedVersion))
+		renderCustomFieldConflict(c, target, defs, version)
+		return
+	}
+
+	defs, message, err := change(ctx, tx, target, defs)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while changing custom fields for %s `%v`", handler, target, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+	if message != "" {
+		renderCustomFieldError(c, message)
+		return
+	}
+
+	version, err = updateCustomFieldsTx(ctx, tx, target, defs)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while updating custom fields for %s `%v`", handler, target, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while committing transaction `%v`", handler, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	renderCustomFieldList(c, target, defs, version)
+}
+
+// DeleteCustomFields removes a field and its stored values.
+func DeleteCustomFields(c *gin.Context) {
+	fieldName := c.Param("fieldName")
+
+	changeCustomFields(c, "Delete Custom Fields", func(ctx context.Context, tx pgx.Tx, target customFieldTarget, defs CustomFieldDefList) (CustomFieldDefList, string, error) {
+		if _, ok := defs.find(fieldName); !ok {
+			return nil, fmt.Sprintf("Error: Field '%s' not found.", fieldName), nil
+		}
+
+		table, _, condition := target.records()
+		cmdTag, err := tx.Exec(ctx, `UPDATE `+table+` SET custom_fields = custom_fields - $2::text WHERE `+condition+` AND custom_fields ? $2`, target.key(), fieldName)
+		if err != nil {
+			return nil, "", err
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Custom Fields: Field '%s' of %s deleted from %d records", fieldName, target, cmdTag.RowsAffected()))
+
+		defs = slices.DeleteFunc(defs, func(cf CustomFieldDef) bool { return cf.FieldName == fieldName })
+		defs.dropRuleField(fieldName)
+		return defs, "", nil
+	})
+}
+
+// UpdateCustomField edits a field's label, name, type, options, required
+// flag and rules. A new name or type rewrites the stored values in the same
+// transaction; values the new type cannot hold stop the change unless
+// discard_invalid is set.
+func UpdateCustomField(c *gin.Context) {
+	fieldName := c.Param("fieldName")
+	updated := CustomFieldDef{
+		FieldName:  strings.TrimSpace(c.PostForm("field_name")),
+		FieldLabel: strings.TrimSpace(c.PostForm("field_label")),
+		FieldType:  c.PostForm("field_type"),
+		IsRequired: c.PostForm("is_required") == "true",
+	}
+	discardInvalid := c.PostForm("discard_invalid") == "true"
+
+	if updated.FieldName == "" {
+		updated.FieldName = fieldName
+	}
+	if updated.FieldLabel == "" {
+		renderCustomFieldError(c, "Error: Label cannot be empty.")
+		return
+	}
+	if !customFieldNameFormat.MatchString(updated.FieldName) {
+		renderCustomFieldError(c, "Error: Use only lowercase letters, numbers, and underscores in the name.")
+		return
+	}
+	if slices.Contains(reservedCustomFieldNames, updated.FieldName) {
+		renderCustomFieldError(c, fmt.Sprintf("Error: '%s' is used by Momentum itself.", updated.FieldName))
+		return
+	}
+	if !isCustomFieldType(updated.FieldType) {
+		renderCustomFieldError(c, "Error: Choose the type of the field.")
+		return
+	}
+	if updated.hasOptions() {
+		updated.Options = parseSelectOptions(c.PostForm("select_options"))
+		if len(updated.Options) == 0 {
+			renderCustomFieldError(c, "Error: Select field options cannot be empty.")
+			return
+		}
+	}
+	if updated.FieldType == "computed" {
+		updated.Formula = strings.TrimSpace(c.PostForm("formula"))
+	}
+
+	changeCustomFields(c, "Update Custom Field", func(ctx context.Context, tx pgx.Tx, target customFieldTarget, defs CustomFieldDefList) (CustomFieldDefList, string, error) {
+		index := slices.IndexFunc(defs, func(cf CustomFieldDef) bool { return cf.FieldName == fieldName })
+		if index < 0 {
+			return nil, fmt.Sprintf("Error: Field '%s' not found.", fieldName), nil
+		}
+		if updated.FieldName != fieldName {
+			if _, exists := defs.find(updated.FieldName); exists {
+				return nil, fmt.Sprintf("Error: Field '%s' already exists.", updated.FieldName), nil
+			}
+		}
+
+		others := slices.Delete(slices.Clone(defs), index, index+1)
+		if updated.FieldType == "computed" {
+			if msg := others.checkFormula(updated.FieldName, updated.Formula); msg != "" {
+				return nil, msg, nil
+			}
+		}
+		var msg string
+		if updated.VisibleWhen, updated.RequiredWhen, msg = others.rulesFromForm(c, updated.FieldName); msg != "" {
+			return nil, msg, nil
+		}
+
+		misfits, err := rewriteCustomFieldValues(ctx, tx, target, defs[index], updated, discardInvalid)
+		if errors.Is(err, errCustomFieldValuesDoNotFit) {
+			return nil, fmt.Sprintf("Error: %d stored value(s) do not fit the new definition. Preview the change, or tick \"Discard values that do not fit\".", misfits), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if misfits > 0 {
+			logger.LogToLogFile(c, fmt.Sprintf("Update Custom Field: Discarded %d values of field '%s' of %s", misfits, fieldName, target))
+		}
+
+		defs[index] = updated
+		if updated.FieldName != fieldName {
+			defs.renameRuleField(fieldName, updated.FieldName)
+		}
+		return defs, "", nil
+	})
+}
+
+// ReorderCustomFields saves the order the fields were dragged into.
+func ReorderCustomFields(c *gin.Context) {
+	order := c.PostFormArray("order")
+
+	changeCustomFields(c, "Reorder Custom Fields", func(ctx context.Context, tx pgx.Tx, target customFieldTarget, defs CustomFieldDefList) (CustomFieldDefList, string, error) {
+		if len(order) != len(defs) {
+			return nil, "Error: The fields changed meanwhile. Reload and try again.", nil
+		}
+
+		reordered := make(CustomFieldDefList, 0, len(defs))
+		for _, name := range order {
+			def, ok := defs.find(name)
+			if !ok || slices.ContainsFunc(reordered, func(cf CustomFieldDef) bool { return cf.FieldName == name }) {
+				return nil, "Error: The fields changed meanwhile. Reload and try again.", nil
+			}
+			reordered = append(reordered, def)
+		}
+		return reordered, "", nil
+	})
+}
+
+// PreviewCustomFieldChange shows how the stored values of a field would turn
+// out with the type and options of the edit form, without saving anything.
+func PreviewCustomFieldChange(c *gin.Context) {
+	target, ok := customFieldTargetFromRoute(c)
+	if !ok {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+	fieldName := c.Param("fieldName")
+
+	var defs CustomFieldDefList
+	defs.fetchTargetCustomFields(c, target)
+	old, ok := defs.find(fieldName)
+	if !ok {
+		renderCustomFieldError(c, fmt.Sprintf("Error: Field '%s' not found.", fieldName))
+		return
+	}
+
+	updated := old
+	updated.FieldType = c.Query("field_type")
+	if !isCustomFieldType(updated.FieldType) {
+		renderCustomFieldError(c, "Error: Choose the type of the field.")
+		return
+	}
+	updated.Options = nil
+	if updated.hasOptions() {
+		updated.Options = parseSelectOptions(c.Query("select_options"))
+	}
+
+	records, err := listCustomFieldRecords(c.Request.Context(), conn, target, fieldName, false)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Preview Custom Field Change [SQL]: Error while querying values of field '%s' of %s `%v`", fieldName, target, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	conversions := convertCustomFieldValues(records, old, updated)
+	misfits := 0
+	for _, conversion := range conversions {
+		if conversion.Problem != "" {
+			misfits++
+		}
+	}
+
+	c.HTML(http.StatusOK, "customFieldPreview.html", gin.H{
+		"Field":       updated,
+		"Conversions": conversions,
+		"Misfits":     misfits,
+	})
+}
+
+// CustomFieldReport lists the records whose stored values no longer fit the
+// current definitions.
+func CustomFieldReport(c *gin.Context) {
+	target, ok := customFieldTargetFromRoute(c)
+	if !ok {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	var defs CustomFieldDefList
+	defs.fetchTargetCustomFields(c, target)
+
+	records, err := listCustomFieldRecords(c.Request.Context(), conn, target, "", false)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Custom Field Report [SQL]: Error while querying records of %s `%v`", target, err))
+		renderCustomFieldError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "customFieldReport.html", gin.H{
+		"Checked": len(records),
+		"Report":  checkCustomFieldValues(defs, records),
+	})
+}
@@ -0,0 +1,426 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// customFieldUploadURL is where files of file fields are served from; they
+// are saved under ./uploads/custom_fields/.
+const customFieldUploadURL = "/uploads/custom_fields/"
+
+var phoneFormat = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+
+var allowedCustomFieldFileTypes = map[string]bool{
+	".pdf":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".txt":  true,
+	".csv":  true,
+	".doc":  true,
+	".docx": true,
+	".xls":  true,
+	".xlsx": true,
+}
+
+// CustomFieldInput is one custom field as _customFieldInputs.html renders it.
+type CustomFieldInput struct {
+	CustomFieldDef
+	Value   string // what the form sends, one option per line for multi-selects
+	Choices []CustomFieldChoice
+	Error   string
+}
+
+// CustomFieldChoice is an option of a select or multi-select field, or the
+// user or contact a picker holds.
+type CustomFieldChoice struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// customFieldForm reads custom_fields[field_name] from the submitted form.
+// A multi-select sends its name once per checked option; those are joined one
+// per line the way parse expects.
+func customFieldForm(c *gin.Context) map[string]string {
+	values := make(map[string]string)
+	c.PostFormMap("custom_fields") // parses the form, multipart or not
+	for key, submitted := range c.Request.PostForm {
+		name, ok := strings.CutPrefix(key, "custom_fields[")
+		if !ok {
+			continue
+		}
+		if name, ok = strings.CutSuffix(name, "]"); ok {
+			values[name] = strings.Join(submitted, "\n")
+		}
+	}
+	return values
+}
+
+// submit reads, stores and validates the custom fields of a form. Files
+// uploaded as custom_files[field_name] are saved before validating, and
+// removed again when any field is refused, since nothing keeps them then. It
+// returns the values as the form sent them along with what validate returns.
+func (defs CustomFieldDefList) submit(c *gin.Context) (map[string]string, map[string]any, map[string]string) {
+	submitted := customFieldForm(c)
+	carried := maps.Clone(submitted)
+	saved, fileErrors := defs.saveFiles(c, submitted)
+
+	typed, fieldErrors := defs.validate(c, submitted)
+	for name, msg := range fileErrors {
+		delete(typed, name)
+		fieldErrors[name] = msg
+	}
+
+	if len(fieldErrors) > 0 {
+		removeUploads(c, saved)
+		return carried, typed, fieldErrors
+	}
+	return submitted, typed, fieldErrors
+}
+
+// saveFiles stores the files uploaded for file fields, puts their URLs in
+// values and returns the paths it wrote. A field without a new upload keeps
+// the URL the form carried.
+func (defs CustomFieldDefList) saveFiles(c *gin.Context, values map[string]string) ([]string, map[string]string) {
+	var saved []string
+	fieldErrors := make(map[string]string)
+	for _, def := range defs {
+		if def.FieldType != "file" {
+			continue
+		}
+
+		file, err := c.FormFile("custom_files[" + def.FieldName + "]")
+		if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+			continue
+		}
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field Files: Error while processing uploaded file for field '%s' `%v`", def.FieldName, err))
+			fieldErrors[def.FieldName] = "Error processing uploaded file."
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if !allowedCustomFieldFileTypes[ext] {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field Files: Invalid file extension: %s", ext))
+			fieldErrors[def.FieldName] = "Invalid file type. Only PDF, image, text, Word and Excel files are allowed."
+			continue
+		}
+
+		newFileName := uuid.New().String() + ext
+		filePath := filepath.Join("./uploads/custom_fields/", newFileName)
+		if err := c.SaveUploadedFile(file, filePath); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field Files: Error while saving the file for field '%s' `%v`", def.FieldName, err))
+			fieldErrors[def.FieldName] = "Error saving the file."
+			continue
+		}
+
+		saved = append(saved, filePath)
+		values[def.FieldName] = customFieldUploadURL + newFileName
+	}
+	return saved, fieldErrors
+}
+
+// removeUploads deletes files saveFiles wrote for a form that was refused.
+func removeUploads(c *gin.Context, paths []string) {
+	for _, filePath := range paths {
+		if err := os.Remove(filePath); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field Files: Error while removing unused upload '%s' `%v`", filePath, err))
+		}
+	}
+}
+
+// checkReferences flags user and contact fields pointing at records that do
+// not exist and leaves them out of typed.
+func (defs CustomFieldDefList) checkReferences(c *gin.Context, typed map[string]any, fieldErrors map[string]string) {
+	for _, def := range defs {
+		id, ok := typed[def.FieldName].(int)
+		if !ok {
+			continue
+		}
+
+		var query string
+		switch def.FieldType {
+		case "user":
+			query = "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)"
+		case "contact":
+			query = "SELECT EXISTS (SELECT 1 FROM contacts WHERE id = $1)"
+		default:
+			continue
+		}
+
+		var exists bool
+		if err := conn.QueryRow(c.Request.Context(), query, id).Scan(&exists); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field References [SQL]: Error while checking %s %d `%v`", def.FieldType, id, err))
+			fieldErrors[def.FieldName] = "Could not be checked. Please try again."
+			delete(typed, def.FieldName)
+			continue
+		}
+		if !exists {
+			fieldErrors[def.FieldName] = fmt.Sprintf("The %s does not exist.", def.FieldType)
+			delete(typed, def.FieldName)
+		}
+	}
+}
+
+// referenceNames returns the names of the users or contacts picked in
+// values, keyed by ID.
+func (defs CustomFieldDefList) referenceNames(c *gin.Context, fieldType string, values map[string]any) map[int]string {
+	var ids []int
+	for _, def := range defs {
+		if def.FieldType != fieldType {
+			continue
+		}
+		if id, err := strconv.Atoi(customFieldString(values[def.FieldName])); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := "SELECT id, username FROM users WHERE id = ANY($1)"
+	if fieldType == "contact" {
+		query = "SELECT id, name FROM contacts WHERE id = ANY($1)"
+	}
+
+	names := make(map[int]string)
+	rows, err := conn.Query(c.Request.Context(), query, ids)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Custom Field References [SQL]: Error while querying %s names `%v`", fieldType, err))
+		return names
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field References [SQL]: Error while scanning %s names `%v`", fieldType, err))
+			return names
+		}
+		names[id] = name
+	}
+	return names
+}
+
+// referenceChoices lists the users or contacts picked in the fields of that
+// type in values, the only choices their pickers need.
+func (defs CustomFieldDefList) referenceChoices(c *gin.Context, fieldType string, values map[string]string) []CustomFieldChoice {
+	var ids []string
+	for _, def := range defs {
+		if def.FieldType == fieldType && values[def.FieldName] != "" {
+			ids = append(ids, values[def.FieldName])
+		}
+	}
+	return referenceChoicesByID(c, fieldType, ids)
+}
+
+// referenceChoicesByID looks up the users or contacts with the given IDs as
+// choices; anything that is not an ID is skipped.
+func referenceChoicesByID(c *gin.Context, fieldType string, ids []string) []CustomFieldChoice {
+	var numeric []int
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil {
+			numeric = append(numeric, n)
+		}
+	}
+	if len(numeric) == 0 {
+		return nil
+	}
+
+	query := "SELECT id, username FROM users WHERE id = ANY($1) ORDER BY username"
+	if fieldType == "contact" {
+		query = "SELECT id, name FROM contacts WHERE id = ANY($1) ORDER BY name"
+	}
+
+	rows, err := conn.Query(c.Request.Context(), query, numeric)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Custom Field Inputs [SQL]: Error while querying %s choices `%v`", fieldType, err))
+		return nil
+	}
+	defer rows.Close()
+
+	var choices []CustomFieldChoice
+	for rows.Next() {
+		var id int
+		var choice CustomFieldChoice
+		if err := rows.Scan(&id, &choice.Label); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Custom Field Inputs [SQL]: Error while scanning %s choices `%v`", fieldType, err))
+			return nil
+		}
+		choice.Value = strconv.Itoa(id)
+		choices = append(choices, choice)
+	}
+	return choices
+}
+
+// ReferencePicker is a typeahead for one user or contact, as
+// _referencePicker.html renders it. ID is the search box, Name the form field
+// that carries the picked ID and Empty what shows while nothing is picked.
+// Other is a value besides an ID the picker offers, such as unassigned.
+type ReferencePicker struct {
+	ID, Name, Kind string
+	Value, Label   string
+	Empty          string
+	Other          *CustomFieldChoice
+}
+
+// newReferencePicker picks the selected one of choices, if any.
+func newReferencePicker(id, name, kind, empty string, choices []CustomFieldChoice) ReferencePicker {
+	picker := ReferencePicker{ID: id, Name: name, Kind: kind, Empty: empty}
+	for _, choice := range choices {
+		if choice.Selected {
+			picker.Value, picker.Label = choice.Value, choice.Label
+			break
+		}
+	}
+	return picker
+}
+
+// Picker is the typeahead of a user or contact field, sent as name.
+func (input CustomFieldInput) Picker(id, name, empty string) ReferencePicker {
+	return newReferencePicker(id, name, input.FieldType, empty, input.Choices)
+}
+
+func (defs CustomFieldDefList) has(fieldType string) bool {
+	return slices.ContainsFunc(defs, func(def CustomFieldDef) bool { return def.FieldType == fieldType })
+}
+
+// inputs prepares the form partial: every field with what the form sent or
+// what is stored, its choices and what is wrong with it.
+func (defs CustomFieldDefList) inputs(c *gin.Context, values map[string]string, fieldErrors map[string]string) []CustomFieldInput {
+	users := defs.referenceChoices(c, "user", values)
+	contacts := defs.referenceChoices(c, "contact", values)
+
+	inputs := make([]CustomFieldInput, 0, len(defs))
+	for _, def := range defs {
+		input := CustomFieldInput{CustomFieldDef: def, Value: values[def.FieldName], Error: fieldErrors[def.FieldName]}
+
+		var choices []CustomFieldChoice
+		switch def.FieldType {
+		case "select", "multiselect":
+			for _, option := range def.Options {
+				choices = append(choices, CustomFieldChoice{Value: option, Label: option})
+			}
+		case "user":
+			choices = users
+		case "contact":
+			choices = contacts
+		case "computed":
+			input.Value = formatCustomFieldNumber(input.Value)
+		}
+
+		selected := strings.Split(input.Value, "\n")
+		for _, choice := range choices {
+			choice.Selected = input.Value != "" && (choice.Value == input.Value ||
+				def.FieldType == "multiselect" && slices.Contains(selected, choice.Value))
+			input.Choices = append(input.Choices, choice)
+		}
+
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// formatCustomFieldNumber shows amounts stored as decimals with two places.
+func formatCustomFieldNumber(value string) string {
+	if strings.Contains(value, ".") {
+		if amount, err := decimal.NewFromString(value); err == nil {
+			return amount.StringFixed(2)
+		}
+	}
+	return value
+}
+
+// display lists the stored values ready to show, defined fields first in
+// their order and then any leftover keys no definition covers. Users and
+// contacts show by name, and files, web addresses, emails and phone numbers
+// come with a link.
+func (defs CustomFieldDefList) display(c *gin.Context, values map[string]any) []CustomFieldValue {
+	users := defs.referenceNames(c, "user", values)
+	contacts := defs.referenceNames(c, "contact", values)
+
+	var fields []CustomFieldValue
+	for _, def := range defs {
+		value, ok := values[def.FieldName]
+		if !ok || value == nil {
+			continue
+		}
+
+		field := CustomFieldValue{Label: def.FieldLabel, Value: value}
+		text := customFieldString(value)
+		switch def.FieldType {
+		case "checkbox":
+			field.Value = "No"
+			if checked, _ := value.(bool); checked {
+				field.Value = "Yes"
+			}
+		case "multiselect":
+			field.Value = strings.Join(strings.Split(text, "\n"), ", ")
+		case "currency", "computed":
+			field.Value = formatCustomFieldNumber(text)
+		case "user", "contact":
+			id, _ := strconv.Atoi(text)
+			names := users
+			if def.FieldType == "contact" {
+				names = contacts
+				field.URL = fmt.Sprintf("/contacts/%d", id)
+			}
+			if name, ok := names[id]; ok {
+				field.Value = name
+			} else {
+				field.Value = fmt.Sprintf("Unknown %s #%d", def.FieldType, id)
+				field.URL = ""
+			}
+		case "file":
+			field.Value = path.Base(text)
+			field.URL = text
+		case "url":
+			field.URL = text
+		case "email":
+			field.URL = "mailto:" + text
+		case "phone":
+			field.URL = "tel:" + text
+		}
+		fields = append(fields, field)
+	}
+
+	var leftover []string
+	for key := range values {
+		if _, ok := defs.find(key); !ok && !slices.Contains(reservedCustomFieldNames, key) {
+			leftover = append(leftover, key)
+		}
+	}
+	sort.Strings(leftover)
+	for _, key := range leftover {
+		fields = append(fields, CustomFieldValue{Label: key, Value: values[key]})
+	}
+
+	return fields
+}
+
+// sameCustomFieldValue compares stored values, which may be lists.
+func sameCustomFieldValue(a, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
@@ -3,17 +3,22 @@ package database
 import (
 	"Momentum/internal/logger"
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
+	"net/mail"
+	"net/url"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
 )
 
 type CustomFieldDef struct {
@@ -22,192 +27,492 @@ type CustomFieldDef struct {
 	FieldType  string   `json:"field_type"`
 	IsRequired bool     `json:"is_required"`
 	Options    []string `json:"options"`
+	Formula    string   `json:"formula,omitempty"`
+
+	VisibleWhen  *CustomFieldRule `json:"visible_when,omitempty"`
+	RequiredWhen *CustomFieldRule `json:"required_when,omitempty"`
 }
 type CustomFieldDefList []CustomFieldDef
 
-func GetCustomFieldsHandler(c *gin.Context) {
-	id := c.Param("id")
+// CustomFieldValue is a stored custom field ready to show, labelled by its
+// definition when there is one.
+type CustomFieldValue struct {
+	Label string
+	Value any
+	URL   string
+}
 
-	var jt jobType
-	queryName := "SELECT name FROM job_types WHERE id = $1"
-	err := conn.QueryRow(c.Request.Context(), queryName, id).Scan(&jt.Name)
-	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Get Custom Fields [SQL]: Error while querying name from job_types table `%v`", err))
-		c.String(http.StatusNotFound, "Job Type not found")
-		return
+func (defs CustomFieldDefList) find(name string) (CustomFieldDef, bool) {
+	for _, def := range defs {
+		if def.FieldName == name {
+			return def, true
+		}
 	}
-	jt.ID, _ = strconv.Atoi(id)
+	return CustomFieldDef{}, false
+}
 
-	var currentFields CustomFieldDefList
-	currentFields.fetchCurrentCustomFields(c, id)
+// names lists the field names, which is what gets stripped from stored values
+// before the validated ones are written back.
+func (defs CustomFieldDefList) names() []string {
+	names := make([]string, 0, len(defs))
+	for _, def := range defs {
+		names = append(names, def.FieldName)
+	}
+	return names
+}
 
-	c.HTML(http.StatusOK, "manageCustomFieldsModal.html", gin.H{
-		"JobType":      jt,
-		"CustomFields": currentFields,
-	})
+// validate checks submitted values against the definitions and returns them
+// typed the way they are stored: numbers as float64, checkboxes as bool,
+// multi-selects as lists, users and contacts as IDs, currency as
+// decimal.Decimal and everything else as strings. Computed fields are worked
+// out from the others and empty optional fields are left out, as are fields
+// hidden by their visibility rule. The second result maps field names,
+// including unknown ones, to what is wrong with them.
+func (defs CustomFieldDefList) validate(c *gin.Context, values map[string]string) (map[string]any, map[string]string) {
+	typed := make(map[string]any)
+	fieldErrors := make(map[string]string)
+
+	for key := range values {
+		if _, ok := defs.find(key); !ok {
+			fieldErrors[key] = "Unknown field."
+		}
+	}
+
+	active := defs.active(values)
+	for _, def := range active {
+		if def.FieldType == "computed" {
+			continue
+		}
+		value, msg := def.parse(values[def.FieldName])
+		if msg != "" {
+			fieldErrors[def.FieldName] = msg
+			continue
+		}
+		if value != nil {
+			typed[def.FieldName] = value
+		}
+	}
+
+	active.checkReferences(c, typed, fieldErrors)
+	active.compute(typed)
+
+	return typed, fieldErrors
 }
 
-func (currentFields *CustomFieldDefList) fetchCurrentCustomFields(c *gin.Context, id string) {
-	var definitionsJSON []byte
-	queryFields := "SELECT custom_field_definitions FROM job_types WHERE id = $1"
-	err := conn.QueryRow(c.Request.Context(), queryFields, id).Scan(&definitionsJSON)
+// parse converts a submitted value to what the field stores. A nil value with
+// no message means the field is left out; a message says what is wrong.
+func (def CustomFieldDef) parse(value string) (any, string) {
+	value = strings.TrimSpace(value)
 
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		logger.LogToLogFile(c, fmt.Sprintf("Fetch Current Custom Fields [SQL]: Error fetching custom fields for job type %s: %v", id, err))
-	} else if definitionsJSON != nil {
-		err = json.Unmarshal(definitionsJSON, currentFields)
+	if def.FieldType == "computed" {
+		return nil, ""
+	}
+
+	if def.FieldType == "checkbox" {
+		var checked bool
+		switch strings.ToLower(value) {
+		case "true", "on", "yes", "1":
+			checked = true
+		case "", "false", "off", "no", "0":
+		default:
+			return nil, "Must be checked or unchecked."
+		}
+		if def.IsRequired && !checked {
+			return nil, "Must be checked."
+		}
+		return checked, ""
+	}
+
+	if value == "" {
+		if def.IsRequired {
+			return nil, "Required."
+		}
+		return nil, ""
+	}
+
+	switch def.FieldType {
+	case "number":
+		number, err := strconv.ParseFloat(value, 64)
 		if err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Fetch Current Custom Fields [Unmarshal]: Error unmarshaling custom fields for job type %s: %v", id, err))
-			c.String(http.StatusInternalServerError, "Could not parse field definitions")
-			return
+			return nil, "Must be a number."
+		}
+		return number, ""
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return nil, "Must be a date (YYYY-MM-DD)."
+		}
+	case "select":
+		if !slices.Contains(def.Options, value) {
+			return nil, "Choose one of the options."
+		}
+	case "multiselect":
+		var chosen []string
+		for _, option := range strings.Split(value, "\n") {
+			option = strings.TrimSpace(option)
+			if option == "" || slices.Contains(chosen, option) {
+				continue
+			}
+			if !slices.Contains(def.Options, option) {
+				return nil, "Choose from the options."
+			}
+			chosen = append(chosen, option)
+		}
+		if len(chosen) == 0 {
+			return def.parse("")
+		}
+		return chosen, ""
+	case "user", "contact":
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return nil, fmt.Sprintf("Choose a %s.", def.FieldType)
+		}
+		return id, ""
+	case "currency":
+		amount, err := decimal.NewFromString(value)
+		if err != nil {
+			return nil, "Must be an amount."
+		}
+		return amount.Round(2), ""
+	case "file":
+		if !strings.HasPrefix(value, customFieldUploadURL) || strings.Contains(value, "..") {
+			return nil, "Must be an uploaded file."
+		}
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, "Must be a web address starting with http:// or https://."
+		}
+	case "email":
+		address, err := mail.ParseAddress(value)
+		if err != nil || address.Address != value {
+			return nil, "Must be an email address."
+		}
+	case "phone":
+		digits := len(strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, value))
+		if !phoneFormat.MatchString(value) || digits < 6 || digits > 15 {
+			return nil, "Must be a phone number."
 		}
 	}
+	return value, ""
+}
 
+// convert turns a stored value into what the field stores now, after its
+// type or options changed. The message says why the value does not fit.
+func (def CustomFieldDef) convert(value any) (any, string) {
+	return def.parse(customFieldString(value))
 }
 
-func updateCustomFieldsDB(c *gin.Context, currentFields CustomFieldDefList, id string) {
-	newCustomFieldsJSON, err := json.Marshal(currentFields)
-	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Update Custom Fields [Marshal]: Error marshaling custom fields for job type %s: %v", id, err))
-		return
+// errorMessage joins field errors into one sentence per field, in the order
+// the fields are defined and then unknown fields by name.
+func (defs CustomFieldDefList) errorMessage(fieldErrors map[string]string) string {
+	var messages []string
+	for _, def := range defs {
+		if msg, ok := fieldErrors[def.FieldName]; ok {
+			messages = append(messages, fmt.Sprintf("%s: %s", def.FieldLabel, msg))
+		}
 	}
 
-	query := `
-		UPDATE job_types
-		SET custom_field_definitions = $1
-		WHERE id = $2;
-	`
+	var unknown []string
+	for key := range fieldErrors {
+		if _, ok := defs.find(key); !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		messages = append(messages, fmt.Sprintf("%s: %s", key, fieldErrors[key]))
+	}
 
-	cmdTag, err := conn.Exec(c.Request.Context(), query, newCustomFieldsJSON, id)
-	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Update Custom Fields [SQL]: Error updating custom fields for job type %s: %v", id, err))
-		return
+	return strings.Join(messages, " ")
+}
+
+// customFieldString turns a JSON custom field value into the string a form
+// would have sent for it. Multi-select values are one option per line.
+func customFieldString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		options := make([]string, 0, len(v))
+		for _, option := range v {
+			options = append(options, customFieldString(option))
+		}
+		return strings.Join(options, "\n")
+	case []string:
+		return strings.Join(v, "\n")
+	default:
+		return fmt.Sprint(v)
 	}
+}
 
-	if cmdTag.RowsAffected() == 0 {
-		logger.LogToLogFile(c, fmt.Sprintf("Update Custom Fields [SQL]: Error finding custom fields for job type %s: %v", id, err))
-		return
+// customFieldFormValues turns JSON custom field values into the strings a
+// form would have sent, so API requests go through the same validation.
+func customFieldFormValues(values map[string]any) map[string]string {
+	formValues := make(map[string]string, len(values))
+	for key, value := range values {
+		formValues[key] = customFieldString(value)
 	}
+	return formValues
+}
 
+// customFieldTarget is what a list of custom field definitions belongs to:
+// a single job type, or every contact or every user.
+type customFieldTarget struct {
+	Entity string // "job_type", "contact" or "user"
+	ID     string // the job type ID, empty for the other entities
 }
 
-func DeleteCustomFields(c *gin.Context) {
-	id := c.Param("id")
-	fieldName := c.Param("fieldName")
-	var currentFields CustomFieldDefList
-	currentFields.fetchCurrentCustomFields(c, id)
+// customFieldEntities maps the :entity route parameter to the rows of
+// entity_custom_fields.
+var customFieldEntities = map[string]string{
+	"contacts": "contact",
+	"users":    "user",
+}
 
-	found := false
-	updatedFields := slices.DeleteFunc(currentFields, func(cf CustomFieldDef) bool {
-		if cf.FieldName == fieldName {
-			found = true
-			return true
+// customFieldTargetFromRoute reads the target from either the job type
+// routes (:id) or the contact and user routes (:entity).
+func customFieldTargetFromRoute(c *gin.Context) (customFieldTarget, bool) {
+	if entity := c.Param("entity"); entity != "" {
+		name, ok := customFieldEntities[entity]
+		return customFieldTarget{Entity: name}, ok
+	}
+	return customFieldTarget{Entity: "job_type", ID: c.Param("id")}, true
+}
+
+func (t customFieldTarget) key() string {
+	if t.Entity == "job_type" {
+		return t.ID
+	}
+	return t.Entity
+}
+
+// selectQuery reads the definitions and their version.
+func (t customFieldTarget) selectQuery() string {
+	if t.Entity == "job_type" {
+		return "SELECT custom_field_definitions, custom_fields_version FROM job_types WHERE id = $1"
+	}
+	return "SELECT definitions, version FROM entity_custom_fields WHERE entity = $1"
+}
+
+// updateQuery writes the definitions and returns their new version.
+func (t customFieldTarget) updateQuery() string {
+	if t.Entity == "job_type" {
+		return "UPDATE job_types SET custom_field_definitions = $1, custom_fields_version = custom_fields_version + 1 WHERE id = $2 RETURNING custom_fields_version"
+	}
+	return "UPDATE entity_custom_fields SET definitions = $1, version = version + 1 WHERE entity = $2 RETURNING version"
+}
+
+// URL is where the manage modal posts new fields and deletes old ones.
+func (t customFieldTarget) URL() string {
+	if t.Entity == "job_type" {
+		return "/admin/job-types/" + t.ID + "/fields"
+	}
+	for route, entity := range customFieldEntities {
+		if entity == t.Entity {
+			return "/admin/custom-fields/" + route
 		}
-		return false
-	})
+	}
+	return ""
+}
+
+func (t customFieldTarget) String() string {
+	if t.Entity == "job_type" {
+		return "job type " + t.ID
+	}
+	return t.Entity + "s"
+}
+
+func (t customFieldTarget) title(c *gin.Context) (string, error) {
+	switch t.Entity {
+	case "contact":
+		return "Contacts", nil
+	case "user":
+		return "Users", nil
+	}
+
+	var name string
+	err := conn.QueryRow(c.Request.Context(), "SELECT name FROM job_types WHERE id = $1", t.ID).Scan(&name)
+	return name, err
+}
 
-	if !found {
-		logger.LogToLogFile(c, fmt.Sprintf("Field '%s' not found for job type %s, nothing to delete.", fieldName, id))
+// records describes where the target's values live: the table, the column
+// naming each record in reports, and the condition picking the records the
+// definitions apply to. The condition uses $1 = key().
+func (t customFieldTarget) records() (table, label, condition string) {
+	switch t.Entity {
+	case "contact":
+		return "contacts", "name", "$1::text = 'contact'"
+	case "user":
+		return "users", "username", "$1::text = 'user'"
+	}
+	return "jobs", "title", "job_type_id = $1::int"
+}
+
+// recordURL links a record in reports; users have no page of their own.
+func (t customFieldTarget) recordURL(id int) string {
+	switch t.Entity {
+	case "job_type":
+		return fmt.Sprintf("/jobs/%d", id)
+	case "contact":
+		return fmt.Sprintf("/contacts/%d", id)
+	}
+	return ""
+}
+
+func GetCustomFieldsHandler(c *gin.Context) {
+	target, ok := customFieldTargetFromRoute(c)
+	if !ok {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	title, err := target.title(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Get Custom Fields [SQL]: Error while querying name from job_types table `%v`", err))
+		c.String(http.StatusNotFound, "Job Type not found")
 		return
 	}
 
-	updateCustomFieldsDB(c, updatedFields, id)
+	var currentFields CustomFieldDefList
+	version := currentFields.fetchTargetCustomFields(c, target)
 
-	c.Status(http.StatusOK)
+	c.HTML(http.StatusOK, "manageCustomFieldsModal.html", gin.H{
+		"Title":         title,
+		"FieldsURL":     target.URL(),
+		"Version":       version,
+		"CustomFields":  currentFields,
+		"FieldTypes":    customFieldTypes,
+		"RuleOperators": customFieldRuleOperators,
+	})
+}
 
+func (currentFields *CustomFieldDefList) fetchCurrentCustomFields(c *gin.Context, id string) {
+	currentFields.fetchTargetCustomFields(c, customFieldTarget{Entity: "job_type", ID: id})
 }
 
+// fetchEntityCustomFields loads the definitions shared by every contact or
+// every user.
+func (currentFields *CustomFieldDefList) fetchEntityCustomFields(c *gin.Context, entity string) {
+	currentFields.fetchTargetCustomFields(c, customFieldTarget{Entity: entity})
+}
+
+// fetchTargetCustomFields loads the definitions of target and returns their
+// version.
+func (currentFields *CustomFieldDefList) fetchTargetCustomFields(c *gin.Context, target customFieldTarget) int {
+	var definitionsJSON []byte
+	var version int
+	err := conn.QueryRow(c.Request.Context(), target.selectQuery(), target.key()).Scan(&definitionsJSON, &version)
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.LogToLogFile(c, fmt.Sprintf("Fetch Current Custom Fields [SQL]: Error fetching custom fields for %s: %v", target, err))
+	} else if definitionsJSON != nil {
+		err = json.Unmarshal(definitionsJSON, currentFields)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Fetch Current Custom Fields [Unmarshal]: Error unmarshaling custom fields for %s: %v", target, err))
+			c.String(http.StatusInternalServerError, "Could not parse field definitions")
+		}
+	}
+
+	return version
+}
+
+// AddNewCustomFields appends a field to the definitions of the route's
+// target in one transaction.
 func AddNewCustomFields(c *gin.Context) {
-	id := c.Param("id")
-	newFieldLabel := c.PostForm("field_label")
-	newFieldName := c.PostForm("field_name")
+	newFieldLabel := strings.TrimSpace(c.PostForm("field_label"))
+	newFieldName := strings.TrimSpace(c.PostForm("field_name"))
 	newFieldType := c.PostForm("field_type")
-	newIsRequiredStr := c.PostForm("is_required")
-	var newIsRequired bool = true
+	newIsRequired := c.PostForm("is_required") != ""
 	var optionsSlice []string
 
 	if newFieldName == "" || newFieldLabel == "" || newFieldType == "" {
 		logger.LogToLogFile(c, "Add New Custom Fields: newFieldName or newFieldLabel or newFieldType is empty")
+		renderCustomFieldError(c, "Error: Label, name and type are required.")
 		return
 	}
-
-	if newIsRequiredStr == "" {
-		newIsRequired = false
-	}
-	isValidFormat, _ := regexp.MatchString(`^[a-z0-9_]+$`, newFieldName)
-	if !isValidFormat {
+	if !customFieldNameFormat.MatchString(newFieldName) {
 		logger.LogToLogFile(c, fmt.Sprintf("Add New Custom Fields: newFieldName is not a valid name [%s]", newFieldName))
+		renderCustomFieldError(c, "Error: Use only lowercase letters, numbers, and underscores in the name.")
 		return
 	}
-
-	fieldNameExists, _ := customFieldNameExist(c, id, newFieldName)
-	if fieldNameExists {
-		logger.LogToLogFile(c, fmt.Sprintf("Add New Custom Fields: Custom field [%s] alredy exist", newFieldName))
+	if slices.Contains(reservedCustomFieldNames, newFieldName) {
+		renderCustomFieldError(c, fmt.Sprintf("Error: '%s' is used by Momentum itself.", newFieldName))
+		return
+	}
+	if !isCustomFieldType(newFieldType) {
+		logger.LogToLogFile(c, fmt.Sprintf("Add New Custom Fields: Unknown field type [%s]", newFieldType))
+		renderCustomFieldError(c, "Error: Choose the type of the field.")
 		return
 	}
 
-	if newFieldType == "select" {
-		optionsStr := c.PostForm("select_options")
-		if optionsStr == "" {
-			logger.LogToLogFile(c, "Add New Custom Fields: Select field type there is no options.")
-			c.Header("HX-Retarget", "#add-field-feedback")
-			c.HTML(http.StatusUnprocessableEntity, "errorFeedback.html", gin.H{"Message": "Error: Select field type requires options."})
+	if newFieldType == "select" || newFieldType == "multiselect" {
+		optionsSlice = parseSelectOptions(c.PostForm("select_options"))
+		if len(optionsSlice) == 0 {
+			logger.LogToLogFile(c, "Add New Custom Fields: Select field options is empty.")
+			renderCustomFieldError(c, "Error: Select field options cannot be empty.")
 			return
 		}
+	}
 
-		scanner := bufio.NewScanner(strings.NewReader(optionsStr))
+	var formula string
+	if newFieldType == "computed" {
+		formula = strings.TrimSpace(c.PostForm("formula"))
+	}
 
-		for scanner.Scan() {
-			trimmedOpt := strings.TrimSpace(scanner.Text())
+	changeCustomFields(c, "Add New Custom Fields", func(ctx context.Context, tx pgx.Tx, target customFieldTarget, currentFields CustomFieldDefList) (CustomFieldDefList, string, error) {
+		if _, fieldNameExists := currentFields.find(newFieldName); fieldNameExists {
+			logger.LogToLogFile(c, fmt.Sprintf("Add New Custom Fields: Custom field [%s] alredy exist", newFieldName))
+			return nil, fmt.Sprintf("Error: Field '%s' already exists.", newFieldName), nil
+		}
 
-			if trimmedOpt != "" {
-				optionsSlice = append(optionsSlice, trimmedOpt)
+		if newFieldType == "computed" {
+			if msg := currentFields.checkFormula(newFieldName, formula); msg != "" {
+				logger.LogToLogFile(c, fmt.Sprintf("Add New Custom Fields: Invalid formula [%s]", formula))
+				return nil, msg, nil
 			}
 		}
 
-		if len(optionsSlice) == 0 {
-			logger.LogToLogFile(c, "Add New Custom Fields: Select field options is empty.")
-			c.Header("HX-Retarget", "#add-field-feedback")
-			c.HTML(http.StatusUnprocessableEntity, "errorFeedback.html", gin.H{"Message": "Error: Select field options cannot be empty."})
-			return
+		visibleWhen, requiredWhen, msg := currentFields.rulesFromForm(c, newFieldName)
+		if msg != "" {
+			logger.LogToLogFile(c, fmt.Sprintf("Add New Custom Fields: Invalid rule for field [%s]", newFieldName))
+			return nil, msg, nil
 		}
-	}
-
-	var currentFields CustomFieldDefList
-	currentFields.fetchCurrentCustomFields(c, id)
-
-	newCustomFields := CustomFieldDef{
-		FieldName:  newFieldName,
-		FieldLabel: newFieldLabel,
-		FieldType:  newFieldType,
-		IsRequired: newIsRequired,
-		Options:    optionsSlice,
-	}
 
-	currentFields = append(currentFields, newCustomFields)
+		newCustomFields := CustomFieldDef{
+			FieldName:  newFieldName,
+			FieldLabel: newFieldLabel,
+			FieldType:  newFieldType,
+			IsRequired: newIsRequired,
+			Options:    optionsSlice,
+			Formula:    formula,
 
-	updateCustomFieldsDB(c, currentFields, id)
+			VisibleWhen:  visibleWhen,
+			RequiredWhen: requiredWhen,
+		}
 
-	c.HTML(http.StatusOK, "manageCustomFieldsModal.html", gin.H{
-		"CustomFields": currentFields,
-		"JobType":      gin.H{"ID": id},
+		return append(currentFields, newCustomFields), "", nil
 	})
 }
 
-func customFieldNameExist(c *gin.Context, id, fieldName string) (bool, error) {
-	var exists bool
-	query := `SELECT COALESCE(custom_field_definitions @> $2::jsonb, false)
-              FROM job_types
-              WHERE id = $1;`
-	searchJSON := fmt.Sprintf(`[{"field_name": "%s"}]`, fieldName)
-
-	err := conn.QueryRow(c.Request.Context(), query, id, searchJSON).Scan(&exists)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return false, nil
+// parseSelectOptions reads the options of a select field, one per line.
+func parseSelectOptions(optionsStr string) []string {
+	var options []string
+	scanner := bufio.NewScanner(strings.NewReader(optionsStr))
+	for scanner.Scan() {
+		if trimmedOpt := strings.TrimSpace(scanner.Text()); trimmedOpt != "" {
+			options = append(options, trimmedOpt)
 		}
-		logger.LogToLogFile(c, fmt.Sprintf("custom Field Name Exist [SQL]: Error checking custom field existence for job type %s: %v", id, err))
-		return false, err
 	}
-	return exists, nil
+	return options
 }
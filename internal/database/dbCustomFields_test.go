@@ -0,0 +1,101 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCustomFieldDefParse(t *testing.T) {
+	field := func(fieldType string, required bool, options ...string) CustomFieldDef {
+		return CustomFieldDef{FieldName: "f", FieldLabel: "F", FieldType: fieldType, IsRequired: required, Options: options}
+	}
+
+	tests := []struct {
+		name   string
+		def    CustomFieldDef
+		value  string
+		want   any
+		reject bool
+	}{
+		{"text is trimmed", field("text", false), "  hello ", "hello", false},
+		{"empty optional is left out", field("text", false), "  ", nil, false},
+		{"empty required", field("text", true), "", nil, true},
+
+		{"number", field("number", false), "3.5", 3.5, false},
+		{"number with letters", field("number", false), "3 apples", nil, true},
+
+		{"date", field("date", false), "2024-02-29", "2024-02-29", false},
+		{"date that does not exist", field("date", false), "2023-02-29", nil, true},
+		{"date in another format", field("date", false), "29/02/2024", nil, true},
+
+		{"checkbox checked", field("checkbox", false), "on", true, false},
+		{"checkbox unchecked", field("checkbox", false), "", false, false},
+		{"checkbox other text", field("checkbox", false), "maybe", nil, true},
+		{"required checkbox unchecked", field("checkbox", true), "false", nil, true},
+
+		{"select option", field("select", false, "a", "b"), "a", "a", false},
+		{"select unknown option", field("select", false, "a", "b"), "c", nil, true},
+
+		{"multiselect drops blanks and repeats", field("multiselect", false, "a", "b"), "a\n\nb\na", []string{"a", "b"}, false},
+		{"multiselect unknown option", field("multiselect", false, "a", "b"), "a\nc", nil, true},
+		{"multiselect only blanks", field("multiselect", false, "a"), "\n \n", nil, false},
+		{"required multiselect only blanks", field("multiselect", true, "a"), "\n \n", nil, true},
+
+		{"user", field("user", false), "12", 12, false},
+		{"user zero", field("user", false), "0", nil, true},
+		{"user not a number", field("user", false), "bob", nil, true},
+		{"contact negative", field("contact", false), "-1", nil, true},
+
+		{"currency is rounded", field("currency", false), "12.345", decimal.RequireFromString("12.35"), false},
+		{"currency with a comma", field("currency", false), "12,50", nil, true},
+
+		{"file upload", field("file", false), "/uploads/custom_fields/report.pdf", "/uploads/custom_fields/report.pdf", false},
+		{"file leaving the upload directory", field("file", false), "/uploads/custom_fields/../../config/config.toml", nil, true},
+		{"file with dots in the name", field("file", false), "/uploads/custom_fields/a..pdf", nil, true},
+		{"file elsewhere", field("file", false), "/etc/passwd", nil, true},
+		{"file on another site", field("file", false), "https://example.com/report.pdf", nil, true},
+
+		{"url https", field("url", false), "https://example.com/a?b=c", "https://example.com/a?b=c", false},
+		{"url http", field("url", false), "http://example.com", "http://example.com", false},
+		{"url ftp", field("url", false), "ftp://example.com/file", nil, true},
+		{"url javascript", field("url", false), "javascript:alert(1)", nil, true},
+		{"url without scheme", field("url", false), "example.com", nil, true},
+		{"url without host", field("url", false), "https://", nil, true},
+
+		{"email", field("email", false), "ann@example.com", "ann@example.com", false},
+		{"email with a name", field("email", false), "Ann <ann@example.com>", nil, true},
+		{"email without domain", field("email", false), "ann", nil, true},
+
+		{"phone", field("phone", false), "+44 (20) 7946-0958", "+44 (20) 7946-0958", false},
+		{"phone too short", field("phone", false), "12345", nil, true},
+		{"phone too long", field("phone", false), "1234567890123456", nil, true},
+		{"phone with letters", field("phone", false), "555-CALL-NOW", nil, true},
+
+		{"computed ignores input", field("computed", true), "42", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, msg := tt.def.parse(tt.value)
+		if tt.reject {
+			if msg == "" {
+				t.Errorf("%s: parse(%q) = %v, want a message", tt.name, tt.value, got)
+			}
+			continue
+		}
+		if msg != "" {
+			t.Errorf("%s: parse(%q) refused: %s", tt.name, tt.value, msg)
+			continue
+		}
+		if want, ok := tt.want.(decimal.Decimal); ok {
+			if amount, ok := got.(decimal.Decimal); !ok || !amount.Equal(want) {
+				t.Errorf("%s: parse(%q) = %v, want %s", tt.name, tt.value, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parse(%q) = %#v, want %#v", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
@@ -17,40 +17,16 @@ type PaginationFinance struct {
 }
 
 type Finance struct {
-	ID              int
-	Description     string
-	TransactionDate time.Time
-	Type            string
-	Amount          decimal.Decimal
-	RelatedJobID    sql.NullInt64
-	CreatedAt       time.Time
+	ID              int             `json:"id"`
+	Description     string          `json:"description"`
+	TransactionDate time.Time       `json:"transaction_date"`
+	Type            string          `json:"type"`
+	Amount          decimal.Decimal `json:"amount"`
+	RelatedJobID    *int64          `json:"related_job_id"`
+	CreatedAt       time.Time       `json:"created_at"`
 }
 
-func FinanceList(c *gin.Context) {
-	var pagination PaginationFinance
-	if err := c.ShouldBindQuery(&pagination); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Finance List [Bind Query]: Error while binding query to pagination struct `%v`", err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	var beforeTimestamp time.Time
-	var err error
-	if pagination.Before == "" || pagination.Before == "now" {
-		beforeTimestamp = time.Now()
-	} else {
-		beforeTimestamp, err = time.Parse(time.RFC3339Nano, pagination.Before)
-		if err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Finance List [Before Time]: Invalid 'before' timestamp format: %s", pagination.Before))
-			c.String(http.StatusBadRequest, "Invalid 'before' parameter format.")
-			return
-		}
-	}
-
-	if pagination.Limit <= 0 || pagination.Limit > 50 {
-		pagination.Limit = 10
-	}
-
+func listFinances(c *gin.Context, before time.Time, limit int) ([]Finance, error) {
 	query := `
 	SELECT
 	    id,
@@ -70,11 +46,9 @@ func FinanceList(c *gin.Context) {
 	    $2; 
 	`
 
-	rows, err := conn.Query(c.Request.Context(), query, beforeTimestamp, pagination.Limit)
+	rows, err := conn.Query(c.Request.Context(), query, before, limit)
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Finance List [SQL]: Error querying financial_transactions table `%v`", err))
-		c.String(http.StatusInternalServerError, "An internal server error occurred, Try again.")
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -82,17 +56,38 @@ func FinanceList(c *gin.Context) {
 	for rows.Next() {
 		var record Finance
 		if err := rows.Scan(&record.ID, &record.Description, &record.Amount, &record.Type, &record.TransactionDate, &record.RelatedJobID, &record.CreatedAt); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Finance List [SQL]: Failed to scan row `%v`", err))
-			c.String(http.StatusInternalServerError, "Error processing financial records.")
-			return
+			return nil, err
 		}
 
 		finances = append(finances, record)
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Finance List [SQL]: Error interating rows `%v`", err))
-		c.String(http.StatusInternalServerError, "Error reading updates list.")
+	return finances, rows.Err()
+}
+
+func FinanceList(c *gin.Context) {
+	var pagination PaginationFinance
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Finance List [Bind Query]: Error while binding query to pagination struct `%v`", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	beforeTimestamp, err := parseBeforeCursor(pagination.Before)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Finance List [Before Time]: Invalid 'before' timestamp format: %s", pagination.Before))
+		c.String(http.StatusBadRequest, "Invalid 'before' parameter format.")
+		return
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 10
+	}
+
+	finances, err := listFinances(c, beforeTimestamp, pagination.Limit)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Finance List [SQL]: Error querying financial_transactions table `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal server error occurred, Try again.")
 		return
 	}
 
@@ -115,7 +110,6 @@ func AddNewFinancialRecord(c *gin.Context) {
 	typeRecord := c.PostForm("type")
 	transactionDateStr := c.PostForm("transaction_date")
 	relatedJobID := c.PostForm("related_job_id")
-	relatedJobIDNull := sql.NullString{String: relatedJobID}
 
 	formData := gin.H{
 		"description":      description,
@@ -170,8 +164,7 @@ func AddNewFinancialRecord(c *gin.Context) {
 		transactionDate = parsedDate
 	}
 
-	query := `INSERT INTO financial_transactions (description, amount, type, transaction_date, related_job_id) VALUES ($1, $2, $3, $4, $5)`
-	_, err = conn.Exec(c.Request.Context(), query, description, amount, typeRecord, transactionDate, relatedJobIDNull)
+	_, err = insertFinancialRecord(c, description, amount, typeRecord, transactionDate, relatedJobID)
 
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("Add New Financial Record [SQL]: Error while inserting record into financial_transactions `%v`", err))
@@ -186,3 +179,15 @@ func AddNewFinancialRecord(c *gin.Context) {
 	c.Status(http.StatusOK)
 
 }
+
+func insertFinancialRecord(c *gin.Context, description string, amount decimal.Decimal, typeRecord string, transactionDate time.Time, relatedJobID string) (Finance, error) {
+	relatedJobIDNull := sql.NullString{String: relatedJobID, Valid: relatedJobID != ""}
+
+	var record Finance
+	query := `
+	INSERT INTO financial_transactions (description, amount, type, transaction_date, related_job_id) VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, description, amount, type, transaction_date, related_job_id, created_at`
+
+	err := conn.QueryRow(c.Request.Context(), query, description, amount, typeRecord, transactionDate, relatedJobIDNull).Scan(&record.ID, &record.Description, &record.Amount, &record.Type, &record.TransactionDate, &record.RelatedJobID, &record.CreatedAt)
+	return record, err
+}
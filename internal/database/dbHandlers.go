@@ -1,7 +1,7 @@
 package database
 
 import (
-	"Momentum/internal/jwt"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
@@ -20,6 +20,8 @@ type userAuthData struct {
 	PasswordHash string
 	Role         string
 	ID           string
+	TOTPEnabled  bool
+	LockedUntil  sql.NullTime
 }
 
 type Pagination struct {
@@ -27,30 +29,51 @@ type Pagination struct {
 	After int `form:"after,default=0"` // Corresponds to the "cursor" ID
 }
 
+// parseBeforeCursor reads the `before` value of time-based pagination. An empty
+// cursor or "now" starts from the newest record.
+func parseBeforeCursor(before string) (time.Time, error) {
+	if before == "" || before == "now" {
+		return time.Now(), nil
+	}
+
+	return time.Parse(time.RFC3339Nano, before)
+}
+
 type jobType struct {
-	ID                     int
-	Name                   string
-	Description            string
+	ID                     int              `json:"id"`
+	Name                   string           `json:"name"`
+	Description            string           `json:"description"`
+	Restricted             bool             `json:"restricted"`
 	CustomFieldDefinitions []CustomFieldDef `json:"-"`
 
-	CreatedAt time.Time
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Users struct {
-	ID       int
-	Username string
-	FullName string
-	Role     string
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"full_name"`
+	Role     string `json:"role"`
 
-	LocationContact string
-	WorkPhone       string
-	HomePhone       string
-	OtherInfo       string
+	LocationContact string `json:"location_contact"`
+	WorkPhone       string `json:"work_phone"`
+	HomePhone       string `json:"home_phone"`
+	OtherInfo       string `json:"-"`
 
-	CustomFields map[string]any
+	CustomFields map[string]any `json:"custom_fields,omitempty"`
+
+	TOTPEnabled         bool         `json:"totp_enabled"`
+	FailedLoginAttempts int          `json:"-"`
+	LockedUntil         sql.NullTime `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
 
-	CreatedAt time.Time
-	UpdatedAt time.Time
+// IsLocked reports whether the account is inside a lockout window after too
+// many failed logins.
+func (u Users) IsLocked() bool {
+	return u.LockedUntil.Valid && u.LockedUntil.Time.After(time.Now())
 }
 
 func createPasswordHash(password string) ([]byte, error) {
@@ -63,11 +86,11 @@ func createPasswordHash(password string) ([]byte, error) {
 
 func (u *Users) findUserByID(c *gin.Context, id string) error {
 	query := `
-        SELECT id, username, role, full_name, location_contact, work_phone, home_phone, created_at, updated_at 
+        SELECT id, username, role, full_name, location_contact, work_phone, home_phone, custom_fields, totp_enabled, failed_login_attempts, locked_until, created_at, updated_at 
         FROM users 
         WHERE id = $1`
 
-	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&u.ID, &u.Username, &u.Role, &u.FullName, &u.LocationContact, &u.WorkPhone, &u.HomePhone, &u.CreatedAt, &u.UpdatedAt)
+	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&u.ID, &u.Username, &u.Role, &u.FullName, &u.LocationContact, &u.WorkPhone, &u.HomePhone, &u.CustomFields, &u.TOTPEnabled, &u.FailedLoginAttempts, &u.LockedUntil, &u.CreatedAt, &u.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
@@ -76,7 +99,7 @@ func (u *Users) findUserByID(c *gin.Context, id string) error {
 }
 
 func Login(c *gin.Context) {
-	query := `SELECT username, password_hash,role, id FROM users WHERE username = $1`
+	query := `SELECT username, password_hash, role, id, totp_enabled, locked_until FROM users WHERE username = $1`
 	var user userAuthData
 	username := c.PostForm("username")
 	password := c.PostForm("password")
@@ -86,11 +109,24 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	err := conn.QueryRow(c.Request.Context(), query, username).Scan(&user.Username, &user.PasswordHash, &user.Role, &user.ID)
+	_, blocked, err := ipBlockedUntil(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login [SQL]: Error while checking IP block `%v`", err))
+		c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+		return
+	}
+	if blocked {
+		logger.LogToLogFile(c, fmt.Sprintf("Login: Attempt from blocked IP %s", c.ClientIP()))
+		c.String(http.StatusTooManyRequests, "<div class='error'>Too many failed attempts. Try again later.</div>")
+		return
+	}
+
+	err = conn.QueryRow(c.Request.Context(), query, username).Scan(&user.Username, &user.PasswordHash, &user.Role, &user.ID, &user.TOTPEnabled, &user.LockedUntil)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			bcrypt.CompareHashAndPassword([]byte{}, []byte(password))
 			logger.LogToLogFile(c, "Login: Wrong username")
+			recordIPFailure(c)
 			c.String(http.StatusBadRequest, "<div class='error'>Invalid username or password</div>")
 			return
 		}
@@ -99,22 +135,20 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		logger.LogToLogFile(c, "Login: Wrong password")
-		c.String(http.StatusBadRequest, "<div class='error'>Invalid username or password</div>")
+	if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+		logger.LogToLogFile(c, fmt.Sprintf("Login: Attempt on locked account %s", user.Username))
+		c.String(http.StatusTooManyRequests, "<div class='error'>Too many failed attempts. Try again later.</div>")
 		return
 	}
 
-	tokenString, err := jwt.CreateToken(username, user.Role, user.ID)
-	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Login [JWT]: Error while creating JWT `%v`", err))
-		c.String(http.StatusBadRequest, "<div class='error'>Internal server error (JWT)</div>")
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		logger.LogToLogFile(c, "Login: Wrong password")
+		recordUserFailure(c, user.ID, user.Username)
+		c.String(http.StatusBadRequest, "<div class='error'>Invalid username or password</div>")
 		return
 	}
 
-	c.SetCookie("token", tokenString, 3600, "/", "localhost", false, true)
-	c.Redirect(http.StatusSeeOther, "/")
-
+	continueLogin(c, user)
 }
 
 func Register(c *gin.Context) {
@@ -126,8 +160,15 @@ func Register(c *gin.Context) {
 	workPhone := c.PostForm("work_phone")
 	homePhone := c.PostForm("home_phone")
 
-	if role != "admin" && role != "user" {
-		logger.LogToLogFile(c, "Register: The user's role is not admin or user.")
+	validRole, err := roleExists(c, role)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Register [SQL]: Error while checking role `%v`", err))
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(`<div id="form-feedback" class="error">Erro: Internal server error</div>`))
+		return
+	}
+
+	if !validRole {
+		logger.LogToLogFile(c, fmt.Sprintf("Register: The role `%s` does not exist.", role))
 		c.Data(http.StatusUnprocessableEntity, "text/html; charset=utf-8", []byte(`<div id="form-feedback" class="error">Erro: Invalid role.</div>`))
 		return
 	}
@@ -179,6 +220,8 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Sessions reference users with ON DELETE CASCADE, so deleting the user
+	// also invalidates every token issued to them.
 	query := "DELETE FROM users WHERE id = $1"
 	cmdTag, err := conn.Exec(c.Request.Context(), query, idStr)
 	if err != nil {
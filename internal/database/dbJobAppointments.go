@@ -0,0 +1,396 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// appointmentInputFormat is how datetime-local inputs send times; they are
+// read in the server's time zone.
+const appointmentInputFormat = "2006-01-02T15:04"
+
+// maxAppointmentLength is the longest an appointment window may be.
+const maxAppointmentLength = 14 * 24 * time.Hour
+
+// appointmentLockSpace is the first key passed to pg_advisory_xact_lock when
+// booking a technician; the second is their user ID.
+const appointmentLockSpace int32 = 723651
+
+// JobAppointment is a window in which a technician is booked to work on a
+// job.
+type JobAppointment struct {
+	ID       int
+	JobID    int
+	UserID   int
+	UserName string
+	StartsAt time.Time
+	EndsAt   time.Time
+	Notes    string
+
+	UpdatedAt time.Time
+
+	// The job, for the calendar.
+	Ticket string
+	Title  string
+	Status string
+
+	// Conflict is whether the technician is booked elsewhere at the same time.
+	Conflict bool
+}
+
+// Window is when the appointment is, e.g. "Mon 02 Jan 09:00–11:00".
+func (a JobAppointment) Window() string {
+	return appointmentWindow(a.StartsAt, a.EndsAt)
+}
+
+// Times is the window within a day of the calendar.
+func (a JobAppointment) Times() string {
+	start, end := a.StartsAt.Local(), a.EndsAt.Local()
+	if sameDay(start, end) {
+		return start.Format("15:04") + "–" + end.Format("15:04")
+	}
+	return start.Format("Jan 02 15:04") + " – " + end.Format("Jan 02 15:04")
+}
+
+func appointmentWindow(start, end time.Time) string {
+	start, end = start.Local(), end.Local()
+	if sameDay(start, end) {
+		return start.Format("Mon 02 Jan 2006 15:04") + "–" + end.Format("15:04")
+	}
+	return start.Format("Mon 02 Jan 2006 15:04") + " – " + end.Format("Mon 02 Jan 2006 15:04")
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// appointmentConflictSQL is true when the technician of appointment a has
+// another appointment overlapping it.
+const appointmentConflictSQL = `EXISTS (
+	    SELECT 1 FROM job_appointments o
+	    WHERE o.user_id = a.user_id AND o.id <> a.id
+	        AND o.starts_at < a.ends_at AND o.ends_at > a.starts_at
+	)`
+
+func listJobAppointments(c *gin.Context, jobID string) ([]JobAppointment, error) {
+	query := `
+	SELECT a.id, a.job_id, a.user_id, u.username, a.starts_at, a.ends_at, a.notes,
+	    ` + appointmentConflictSQL + `
+	FROM job_appointments a
+	JOIN users u ON u.id = a.user_id
+	WHERE a.job_id = $1
+	ORDER BY a.starts_at, a.id`
+
+	rows, err := conn.Query(c.Request.Context(), query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var appointments []JobAppointment
+	for rows.Next() {
+		var a JobAppointment
+		if err := rows.Scan(&a.ID, &a.JobID, &a.UserID, &a.UserName, &a.StartsAt, &a.EndsAt, &a.Notes, &a.Conflict); err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, a)
+	}
+	return appointments, rows.Err()
+}
+
+// listTechnicians lists the users who can see jobs of a job type, the ones an
+// appointment can be booked for, with selected marked.
+func listTechnicians(c *gin.Context, jobTypeID, selected string) ([]CustomFieldChoice, error) {
+	query := `SELECT id::text, username FROM users WHERE job_type_access($1, id, false, role_grants(id, 'jobs.access.all')) ORDER BY username`
+	rows, err := conn.Query(c.Request.Context(), query, jobTypeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var choices []CustomFieldChoice
+	for rows.Next() {
+		var choice CustomFieldChoice
+		if err := rows.Scan(&choice.Value, &choice.Label); err != nil {
+			return nil, err
+		}
+		choices = append(choices, choice)
+	}
+	return markSelected(choices, []string{selected}), rows.Err()
+}
+
+// findOverlappingAppointments returns the user's appointments overlapping a
+// window, other than the one with exceptID.
+func findOverlappingAppointments(c *gin.Context, tx pgx.Tx, userID string, start, end time.Time, exceptID int) ([]JobAppointment, error) {
+	query := `
+	SELECT a.id, a.job_id, a.starts_at, a.ends_at, j.ticket_id, j.title
+	FROM job_appointments a
+	JOIN jobs j ON j.id = a.job_id
+	WHERE a.user_id = $1 AND a.id <> $4
+	    AND a.starts_at < $3 AND a.ends_at > $2
+	ORDER BY a.starts_at
+	LIMIT 3`
+
+	rows, err := tx.Query(c.Request.Context(), query, userID, start, end, exceptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overlapping []JobAppointment
+	for rows.Next() {
+		var a JobAppointment
+		if err := rows.Scan(&a.ID, &a.JobID, &a.StartsAt, &a.EndsAt, &a.Ticket, &a.Title); err != nil {
+			return nil, err
+		}
+		overlapping = append(overlapping, a)
+	}
+	return overlapping, rows.Err()
+}
+
+// recordAppointmentChange adds the job_updates entry written when an
+// appointment is booked or cancelled.
+func recordAppointmentChange(c *gin.Context, tx pgx.Tx, jobID, title, technician string, start, end time.Time) error {
+	query := `
+	INSERT INTO job_updates (job_id, author_user_id, content)
+	VALUES ($1, $2, jsonb_build_object('type', 'appointment', 'title', $3::text, 'description', $4::text))`
+
+	_, err := tx.Exec(c.Request.Context(), query, jobID, currentUserID(c), title, technician+", "+appointmentWindow(start, end))
+	return err
+}
+
+func renderJobAppointments(c *gin.Context, jobID string) {
+	var jobTypeID string
+	var assigneeID *int
+	err := conn.QueryRow(c.Request.Context(), `SELECT job_type_id::text, assigned_to_user_id FROM jobs WHERE id = $1`, jobID).Scan(&jobTypeID, &assigneeID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Appointments [SQL]: Error while querying job %s `%v`", jobID, err))
+		c.String(http.StatusNotFound, "Job not found")
+		return
+	}
+
+	appointments, err := listJobAppointments(c, jobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Appointments [SQL]: Error while querying job_appointments `%v`", err))
+		c.String(http.StatusInternalServerError, "Error reading appointments.")
+		return
+	}
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Appointments [SQL]: Error while checking edit access to job %s `%v`", jobID, err))
+	}
+
+	data := gin.H{
+		"JobID":        jobID,
+		"Appointments": appointments,
+		"CanEdit":      canEdit,
+	}
+	if canEdit {
+		selected := currentUserID(c)
+		if assigneeID != nil {
+			selected = fmt.Sprint(*assigneeID)
+		}
+		technicians, err := listTechnicians(c, jobTypeID, selected)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Job Appointments [SQL]: Error while querying technicians of job type %s `%v`", jobTypeID, err))
+		}
+		data["Technicians"] = technicians
+	}
+
+	c.HTML(http.StatusOK, "jobAppointments.html", data)
+}
+
+// JobAppointments renders the appointments section of the job page.
+func JobAppointments(c *gin.Context) {
+	jobID := c.Param("id")
+
+	canView, err := canAccessJob(c, jobID, false)
+	if err != nil || !canView {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Appointments: User %s cannot view job %s `%v`", currentUserID(c), jobID, err))
+		c.String(http.StatusNotFound, "Job not found")
+		return
+	}
+
+	renderJobAppointments(c, jobID)
+}
+
+// AddJobAppointment books a technician on a job for a window. Windows that
+// overlap another appointment of the technician are refused.
+func AddJobAppointment(c *gin.Context) {
+	jobID := c.Param("id")
+	userID := c.PostForm("user_id")
+	notes := strings.TrimSpace(c.PostForm("notes"))
+
+	renderError := func(message string) {
+		c.Header("HX-Retarget", "#appointment-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment: User %s cannot edit job %s `%v`", currentUserID(c), jobID, err))
+		renderError("You do not have permission to edit this job.")
+		return
+	}
+
+	start, err := time.ParseInLocation(appointmentInputFormat, c.PostForm("starts_at"), time.Local)
+	if err != nil {
+		renderError("Enter when the appointment starts.")
+		return
+	}
+	end, err := time.ParseInLocation(appointmentInputFormat, c.PostForm("ends_at"), time.Local)
+	if err != nil {
+		renderError("Enter when the appointment ends.")
+		return
+	}
+	if !end.After(start) {
+		renderError("The appointment must end after it starts.")
+		return
+	}
+	if end.Sub(start) > maxAppointmentLength {
+		renderError("An appointment can last at most 14 days.")
+		return
+	}
+
+	var jobTypeID string
+	if err := conn.QueryRow(c.Request.Context(), `SELECT job_type_id::text FROM jobs WHERE id = $1`, jobID).Scan(&jobTypeID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while querying job type of job %s `%v`", jobID, err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	technician, err := findAssignee(c, jobTypeID, userID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment: Cannot book user %s on job %s `%v`", userID, jobID, err))
+		renderError("The technician does not exist or cannot see jobs of this type.")
+		return
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while starting transaction `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	// Bookings of the same technician wait for each other, so two overlapping
+	// ones cannot both pass the check below. An advisory lock leaves the user
+	// row, and so their logins and profile, alone.
+	if _, err := tx.Exec(c.Request.Context(), `SELECT pg_advisory_xact_lock($1, $2::int)`, appointmentLockSpace, userID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while locking user %s `%v`", userID, err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	overlapping, err := findOverlappingAppointments(c, tx, userID, start, end, 0)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while checking for double bookings `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	if len(overlapping) > 0 {
+		var bookings []string
+		for _, a := range overlapping {
+			bookings = append(bookings, fmt.Sprintf("%s %s (%s)", a.Ticket, a.Title, a.Window()))
+		}
+		renderError(fmt.Sprintf("%s is already booked then: %s.", technician, strings.Join(bookings, "; ")))
+		return
+	}
+
+	query := `INSERT INTO job_appointments (job_id, user_id, starts_at, ends_at, notes) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.Exec(c.Request.Context(), query, jobID, userID, start, end, notes); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while inserting into job_appointments `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := recordAppointmentChange(c, tx, jobID, "Appointment booked", technician, start, end); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while recording the appointment `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Appointment [SQL]: Error while committing transaction `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	renderJobAppointments(c, jobID)
+}
+
+// DeleteJobAppointment cancels an appointment of a job.
+func DeleteJobAppointment(c *gin.Context) {
+	jobID := c.Param("id")
+	appointmentID := c.Param("appointmentId")
+
+	renderError := func(message string) {
+		c.Header("HX-Retarget", "#appointment-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Appointment: User %s cannot edit job %s `%v`", currentUserID(c), jobID, err))
+		renderError("You do not have permission to edit this job.")
+		return
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Appointment [SQL]: Error while starting transaction `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	query := `
+	DELETE FROM job_appointments a
+	USING users u
+	WHERE a.id = $1 AND a.job_id = $2 AND u.id = a.user_id
+	RETURNING u.username, a.starts_at, a.ends_at`
+
+	var technician string
+	var start, end time.Time
+	err = tx.QueryRow(c.Request.Context(), query, appointmentID, jobID).Scan(&technician, &start, &end)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			renderError("The appointment was already cancelled. Reload the job.")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Appointment [SQL]: Error while deleting from job_appointments `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := recordAppointmentChange(c, tx, jobID, "Appointment cancelled", technician, start, end); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Appointment [SQL]: Error while recording the cancellation `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Appointment [SQL]: Error while committing transaction `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	renderJobAppointments(c, jobID)
+}
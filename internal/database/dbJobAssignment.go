@@ -0,0 +1,102 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var errInvalidAssignee = errors.New("assignee not found or cannot see the job type")
+
+// findAssignee returns the username of the user a job of the job type may be
+// assigned to. Anyone who can see the job type qualifies.
+func findAssignee(c *gin.Context, jobTypeID, userID string) (string, error) {
+	var username string
+	query := `SELECT username FROM users WHERE id = $1 AND job_type_access($2, id, false, role_grants(id, 'jobs.access.all'))`
+	err := conn.QueryRow(c.Request.Context(), query, userID, jobTypeID).Scan(&username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errInvalidAssignee
+	}
+	return username, err
+}
+
+// recordAssignmentChange adds the structured job_updates entry written when
+// a job is reassigned. A null user means the job was unassigned.
+func recordAssignmentChange(c *gin.Context, tx pgx.Tx, jobID, authorUserID string, from, to sql.NullInt64) error {
+	query := `
+	INSERT INTO job_updates (job_id, author_user_id, content)
+	SELECT $1, $2, jsonb_build_object(
+	    'type', 'assignment_change',
+	    'title', COALESCE('Assigned to ' || t.username, 'Unassigned'),
+	    'from', $3::int,
+	    'to', $4::int,
+	    'from_name', f.username,
+	    'to_name', t.username
+	)
+	FROM (SELECT 1) one
+	LEFT JOIN users f ON f.id = $3::int
+	LEFT JOIN users t ON t.id = $4::int`
+
+	_, err := tx.Exec(c.Request.Context(), query, jobID, authorUserID, from, to)
+	return err
+}
+
+// searchAssignees matches users by username or full name among those who can
+// see at least one job type the logged-in user can see, the only ones a job
+// of theirs can be assigned or booked to.
+func searchAssignees(c *gin.Context, userQuery string) ([]Users, error) {
+	query := `
+	SELECT u.id, u.username, u.full_name
+	FROM users u
+	WHERE (u.username ILIKE '%' || $1 || '%' OR u.full_name ILIKE '%' || $1 || '%')
+	    AND EXISTS (
+	        SELECT 1 FROM job_types jt
+	        WHERE job_type_access(jt.id, $2, false, $3)
+	            AND job_type_access(jt.id, u.id, false, role_grants(u.id, 'jobs.access.all'))
+	    )
+	ORDER BY u.username
+	LIMIT 10`
+
+	rows, err := conn.Query(c.Request.Context(), query, userQuery, currentUserID(c), accessAllJobTypes(c))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []Users
+	for rows.Next() {
+		var user Users
+		if err := rows.Scan(&user.ID, &user.Username, &user.FullName); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// SearchAssignees renders the user picker of the job forms, or of the
+// _referencePicker.html with the ID in picker.
+func SearchAssignees(c *gin.Context) {
+	userQuery := c.Query("q_user")
+	if userQuery == "" {
+		return
+	}
+
+	users, err := searchAssignees(c, userQuery)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Search Assignees [SQL]: Failed to fetch users: %v", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred while searching users. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "_userSearchResults.html", gin.H{
+		"Users":  users,
+		"Picker": c.Query("picker"),
+	})
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// JobBoardColumn is one status of a job type's board, with the number of jobs
+// in it and where its cards load from.
+type JobBoardColumn struct {
+	Name     string
+	Label    string
+	Count    int
+	CardsURL string
+}
+
+// countJobsByStatus is listJobs grouped by status: how many of the jobs
+// matching filter the logged-in user can see are in each status.
+func countJobsByStatus(c *gin.Context, filter jobFilter) (map[string]int, error) {
+	args := sqlArgs{currentUserID(c), accessAllJobTypes(c)}
+	conditions := append([]string{"job_type_access(j.job_type_id, $1, false, $2)"}, filter.conditions(&args)...)
+
+	query := `
+	SELECT j.status, COUNT(*)
+	FROM jobs j
+	WHERE ` + strings.Join(conditions, "\n\t    AND ") + `
+	GROUP BY j.status`
+
+	rows, err := conn.Query(c.Request.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+// jobBoardColumns lays out the board of a job type: a column per status of
+// its workflow, then one per status the workflow no longer knows that jobs
+// are still in. Cards load with the filters of query.
+func jobBoardColumns(c *gin.Context, filter jobFilter, statuses JobStatusDefList, query url.Values) ([]JobBoardColumn, error) {
+	counts, err := countJobsByStatus(c, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []JobBoardColumn
+	add := func(name, label string) {
+		cardsQuery := savedQuery(query)
+		cardsQuery.Set("column", name)
+		cardsQuery.Set("limit", "20")
+		columns = append(columns, JobBoardColumn{
+			Name:     name,
+			Label:    label,
+			Count:    counts[name],
+			CardsURL: "/api/jobs/" + filter.JobTypeID + "/board?" + cardsQuery.Encode(),
+		})
+	}
+
+	for _, s := range statuses {
+		add(s.Name, statuses.label(s.Name))
+	}
+	var unknown []string
+	for name := range counts {
+		if _, ok := statuses.find(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		add(name, name)
+	}
+	return columns, nil
+}
+
+// JobBoard is the board page of a job type: its jobs as cards in a column per
+// status, filtered like the list page by the query string. Cards are dragged
+// between columns to change their status.
+func JobBoard(c *gin.Context) {
+	jobTypeId := c.Param("jobTypeId")
+
+	jobTypeName, err := getJobTypeName(c, jobTypeId)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board: Error while search for job type name {ID: %s} `%v`", jobTypeId, err))
+		c.String(http.StatusNotFound, "Job type not found")
+		return
+	}
+
+	canView, err := canAccessJobType(c, jobTypeId, false)
+	if err != nil || !canView {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board: User %s cannot view job type {ID: %s} `%v`", currentUserID(c), jobTypeId, err))
+		c.String(http.StatusNotFound, "Job type not found")
+		return
+	}
+
+	view := savedQuery(c.Request.URL.Query())
+	data := gin.H{
+		"JobTypeName": jobTypeName,
+		"JobTypeId":   jobTypeId,
+		"HasView":     len(view) > 0,
+		"ListURL":     "/jobs/type/" + jobTypeId,
+	}
+	if len(view) > 0 {
+		data["ListURL"] = "/jobs/type/" + jobTypeId + "?" + view.Encode()
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeId)
+
+	filter := jobFilter{JobTypeID: jobTypeId}
+	if msg := filter.parse(c.Request.URL.Query(), customFieldDefs); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board: Invalid filters `%s`", msg))
+		data["Error"] = msg
+		c.HTML(http.StatusOK, "jobBoard.html", data)
+		return
+	}
+
+	statuses, err := fetchJobStatuses(c, jobTypeId)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board [SQL]: Error while querying status_workflow `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	columns, err := jobBoardColumns(c, filter, statuses, c.Request.URL.Query())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board [SQL]: Error while counting jobs by status `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	data["Columns"] = columns
+	c.HTML(http.StatusOK, "jobBoard.html", data)
+}
+
+// JobBoardCards renders the next page of cards of one board column.
+func JobBoardCards(c *gin.Context) {
+	jobTypeId := c.Param("id")
+	var pagination Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board Cards [Bind Query]: Error while binding query to pagination struct `%v`", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 20
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeId)
+
+	filter := jobFilter{JobTypeID: jobTypeId}
+	if msg := filter.parse(c.Request.URL.Query(), customFieldDefs); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board Cards: Invalid filters `%s`", msg))
+		renderJobListError(c, msg)
+		return
+	}
+
+	// A column the status filter leaves out stays empty.
+	column := c.Query("column")
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, column) {
+		c.HTML(http.StatusOK, "jobBoardCards.html", gin.H{})
+		return
+	}
+	filter.Statuses = []string{column}
+
+	jobs, err := listJobs(c, filter, pagination)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Board Cards [SQL]: Error while querying items `%v`", err))
+		c.String(http.StatusInternalServerError, "Error reading jobs list.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobBoardCards.html", gin.H{
+		"Jobs":    jobs,
+		"NextURL": nextJobListURL(c, "/api/jobs/"+jobTypeId+"/board", jobs),
+	})
+}
+
+// MoveJob changes the status of a job dropped on another board column. The
+// board's filters come along in the query string so the column counts are
+// sent back the way the board counts them.
+func MoveJob(c *gin.Context) {
+	jobID := c.Param("id")
+	status := c.PostForm("status")
+	from := c.PostForm("from")
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job: User %s cannot edit job %s `%v`", currentUserID(c), jobID, err))
+		renderJobListError(c, "You do not have permission to edit this job.")
+		return
+	}
+
+	var jobTypeID string
+	if err := conn.QueryRow(c.Request.Context(), `SELECT job_type_id::text FROM jobs WHERE id = $1`, jobID).Scan(&jobTypeID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job [SQL]: Error while querying job type of job %s `%v`", jobID, err))
+		renderJobListError(c, "An internal error occurred while moving the job. Please try again.")
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeID)
+
+	filter := jobFilter{JobTypeID: jobTypeID}
+	if msg := filter.parse(c.Request.URL.Query(), customFieldDefs); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job: Invalid filters `%s`", msg))
+		renderJobListError(c, msg)
+		return
+	}
+
+	currentStatus, statuses, err := fetchJobStatusWorkflow(c, jobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job [SQL]: Error while querying status_workflow `%v`", err))
+		renderJobListError(c, "An internal error occurred while moving the job. Please try again.")
+		return
+	}
+
+	if from != "" && from != currentStatus {
+		renderJobListError(c, "The job was changed by someone else. Reload the board and try again.")
+		return
+	}
+	if status == currentStatus {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if msg := statuses.transitionError(currentStatus, status); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job: Job %s cannot move from `%s` to `%s`", jobID, currentStatus, status))
+		renderJobListError(c, msg)
+		return
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job [SQL]: Error while starting transaction `%v`", err))
+		renderJobListError(c, "An internal error occurred while moving the job. Please try again.")
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	if err := moveJobStatus(c, tx, jobID, currentUserID(c), currentStatus, status, statuses); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			renderJobListError(c, "The job was changed by someone else. Reload the board and try again.")
+			return
+		}
+		if errors.Is(err, errJobStatusWorkflowChanged) {
+			renderJobListError(c, "The statuses of this job type were changed meanwhile. Reload the board and try again.")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job [SQL]: Error while moving job %s `%v`", jobID, err))
+		renderJobListError(c, "An internal error occurred while moving the job. Please try again.")
+		return
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job [SQL]: Error while committing transaction `%v`", err))
+		renderJobListError(c, "An internal error occurred while moving the job. Please try again.")
+		return
+	}
+
+	columns, err := jobBoardColumns(c, filter, statuses, c.Request.URL.Query())
+	if err != nil {
+		// The job moved; the counts catch up when the board reloads.
+		logger.LogToLogFile(c, fmt.Sprintf("Move Job [SQL]: Error while counting jobs by status `%v`", err))
+	}
+
+	moved, _ := json.Marshal(gin.H{"jobMoved": gin.H{"id": jobID, "status": status}})
+	c.Header("HX-Trigger", string(moved))
+	c.HTML(http.StatusOK, "jobBoardCounts.html", gin.H{
+		"Columns": columns,
+	})
+}
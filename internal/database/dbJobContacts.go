@@ -0,0 +1,166 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type JobContactRole struct {
+	Name  string
+	Label string
+}
+
+// jobContactRoles are the parts a contact can play in a job, next to its
+// primary contact.
+var jobContactRoles = []JobContactRole{
+	{Name: "site", Label: "Site Contact"},
+	{Name: "billing", Label: "Billing Contact"},
+	{Name: "requester", Label: "Requester"},
+}
+
+type JobContact struct {
+	ID        int    `json:"id"`
+	JobID     int    `json:"job_id"`
+	ContactID int    `json:"contact_id"`
+	Role      string `json:"role"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+}
+
+func (jc JobContact) RoleLabel() string {
+	for _, role := range jobContactRoles {
+		if role.Name == jc.Role {
+			return role.Label
+		}
+	}
+	return jc.Role
+}
+
+func isJobContactRole(name string) bool {
+	return slices.ContainsFunc(jobContactRoles, func(role JobContactRole) bool { return role.Name == name })
+}
+
+func listJobContacts(c *gin.Context, jobID string) ([]JobContact, error) {
+	query := `
+	SELECT jc.id, jc.job_id, jc.contact_id, jc.role, ct.name, COALESCE(ct.email, ''), COALESCE(ct.phone, '')
+	FROM job_contacts jc
+	JOIN contacts ct ON ct.id = jc.contact_id
+	WHERE jc.job_id = $1
+	ORDER BY jc.role, ct.name`
+
+	rows, err := conn.Query(c.Request.Context(), query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []JobContact
+	for rows.Next() {
+		var jc JobContact
+		if err := rows.Scan(&jc.ID, &jc.JobID, &jc.ContactID, &jc.Role, &jc.Name, &jc.Email, &jc.Phone); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, jc)
+	}
+
+	return contacts, rows.Err()
+}
+
+func renderJobContactError(c *gin.Context, message string) {
+	c.Header("HX-Retarget", "#job-contacts-feedback")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+		"Message": message,
+	})
+}
+
+func renderJobContacts(c *gin.Context, jobID string) {
+	contacts, err := listJobContacts(c, jobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Contacts [SQL]: Error while querying job_contacts of job %s `%v`", jobID, err))
+		renderJobContactError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobContactList.html", gin.H{
+		"JobID":       jobID,
+		"JobContacts": contacts,
+	})
+}
+
+func AddJobContact(c *gin.Context) {
+	jobID := c.Param("id")
+	contactID := c.PostForm("job_contact_id")
+	role := c.PostForm("job_contact_role")
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Contact: User %s cannot edit job %s `%v`", currentUserID(c), jobID, err))
+		renderJobContactError(c, "You do not have permission to edit this job.")
+		return
+	}
+
+	if contactID == "" {
+		renderJobContactError(c, "Error: Choose a contact first.")
+		return
+	}
+
+	if !isJobContactRole(role) {
+		renderJobContactError(c, "Error: Choose the role of the contact.")
+		return
+	}
+
+	query := `INSERT INTO job_contacts (job_id, contact_id, role) VALUES ($1, $2, $3)`
+	_, err = conn.Exec(c.Request.Context(), query, jobID, contactID, role)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				renderJobContactError(c, "Error: This contact already has that role on the job.")
+				return
+			case "23503":
+				renderJobContactError(c, "Error: Contact not found.")
+				return
+			}
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Contact [SQL]: Error while inserting into job_contacts `%v`", err))
+		renderJobContactError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	renderJobContacts(c, jobID)
+}
+
+func DeleteJobContact(c *gin.Context) {
+	jobID := c.Param("id")
+	linkID, err := strconv.Atoi(c.Param("jobContactId"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid job contact ID")
+		return
+	}
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Contact: User %s cannot edit job %s `%v`", currentUserID(c), jobID, err))
+		renderJobContactError(c, "You do not have permission to edit this job.")
+		return
+	}
+
+	query := `DELETE FROM job_contacts WHERE id = $1 AND job_id = $2`
+	if _, err := conn.Exec(c.Request.Context(), query, linkID, jobID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Contact [SQL]: Error while deleting from job_contacts `%v`", err))
+		renderJobContactError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	renderJobContacts(c, jobID)
+}
@@ -0,0 +1,454 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// jobFilter narrows listJobs down and orders it. Empty fields match every
+// job; without a sort the list runs by ID.
+type jobFilter struct {
+	JobTypeID      string
+	AssignedUserID string // a user ID, or "none" for unassigned jobs
+	Statuses       []string
+	Priorities     []string
+	Overdue        bool   // only jobs past a due date or SLA target
+	ContactID      string // primary or linked contact
+
+	// Dates as YYYY-MM-DD, both ends included.
+	CreatedFrom, CreatedTo string
+	UpdatedFrom, UpdatedTo string
+
+	Fields []jobFieldFilter
+
+	Sort       string         // "id", "created", "updated", "title", "due", "priority" or "field"
+	SortField  CustomFieldDef // the custom field sorted by when Sort is "field"
+	Descending bool
+
+	// Cursor is where the page starts; nil for the first page.
+	Cursor *jobCursor
+}
+
+// jobFieldFilter narrows the job list down by a custom field: to jobs whose
+// value contains Equals, or lies between From and To.
+type jobFieldFilter struct {
+	Def    CustomFieldDef
+	Equals string // JSON object the custom fields must contain
+	From   string
+	To     string
+}
+
+// jobSortColumns are the columns the job list sorts by besides custom
+// fields, with the type their values compare as.
+var jobSortColumns = map[string]struct{ expr, sqlType string }{
+	"id":       {"j.id", "int"},
+	"created":  {"j.created_at", "timestamptz"},
+	"updated":  {"j.updated_at", "timestamptz"},
+	"title":    {"lower(j.title)", "text"},
+	"due":      {"j.due_date", "date"},
+	"priority": {"array_position(ARRAY['low', 'normal', 'high', 'urgent'], j.priority::text)", "int"},
+}
+
+var jobSorts = []CustomFieldType{
+	{Name: "id", Label: "ID"},
+	{Name: "created", Label: "Created"},
+	{Name: "updated", Label: "Last updated"},
+	{Name: "title", Label: "Title"},
+	{Name: "due", Label: "Due date"},
+	{Name: "priority", Label: "Priority"},
+}
+
+// jobFilterKeys are the query parameters a saved view keeps; cf, cf_from and
+// cf_to come as cf[field_name].
+var jobFilterKeys = []string{"status", "priority", "overdue", "assignee", "contact", "created_from", "created_to", "updated_from", "updated_to", "sort", "dir"}
+
+// jobCursor is where a page of the job list starts: after the job with this
+// sort value and ID. It only fits the sort and direction it was made for.
+type jobCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Null       bool   `json:"n,omitempty"`
+	Value      string `json:"v"`
+	ID         int    `json:"id"`
+}
+
+func (cur jobCursor) String() string {
+	encoded, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// sqlArgs collects the arguments of a query put together from parts; add
+// returns the placeholder of the argument it appends.
+type sqlArgs []any
+
+func (args *sqlArgs) add(value any) string {
+	*args = append(*args, value)
+	return "$" + strconv.Itoa(len(*args))
+}
+
+// filterable reports whether the job list can be narrowed down by the field.
+func (def CustomFieldDef) filterable() bool {
+	return def.FieldType != "file"
+}
+
+// ranged reports whether the field filters by a range rather than a value.
+func (def CustomFieldDef) ranged() bool {
+	return def.numeric() || def.FieldType == "date"
+}
+
+func (def CustomFieldDef) numeric() bool {
+	return def.FieldType == "number" || def.FieldType == "currency" || def.FieldType == "computed"
+}
+
+// sortable reports whether the job list can be ordered by the field. Lists
+// and references have no useful order of their own.
+func (def CustomFieldDef) sortable() bool {
+	switch def.FieldType {
+	case "multiselect", "file", "user", "contact":
+		return false
+	}
+	return true
+}
+
+// sortName is how the sort appears in the query string and in cursors.
+func (f jobFilter) sortName() string {
+	if f.Sort == "field" {
+		return "cf." + f.SortField.FieldName
+	}
+	if f.Sort == "" {
+		return "id"
+	}
+	return f.Sort
+}
+
+func isID(value string) bool {
+	id, err := strconv.Atoi(value)
+	return err == nil && id > 0
+}
+
+// parse adds the filters, sort and cursor of a query string to f. defs are
+// the custom fields of f.JobTypeID; lists across job types have none. The
+// message says what is wrong with the query.
+func (f *jobFilter) parse(query url.Values, defs CustomFieldDefList) string {
+	for _, status := range query["status"] {
+		if status = strings.TrimSpace(status); status != "" {
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+
+	for _, priority := range query["priority"] {
+		if priority = strings.TrimSpace(priority); priority == "" {
+			continue
+		}
+		if !slices.Contains(jobPriorities, priority) {
+			return "`priority` must be low, normal, high or urgent."
+		}
+		f.Priorities = append(f.Priorities, priority)
+	}
+
+	switch query.Get("overdue") {
+	case "", "false":
+	case "true":
+		f.Overdue = true
+	default:
+		return "`overdue` must be `true` or `false`."
+	}
+
+	if assignee := strings.TrimSpace(query.Get("assignee")); assignee != "" && f.AssignedUserID == "" {
+		if assignee != "none" && !isID(assignee) {
+			return "`assignee` must be a user ID or `none`."
+		}
+		f.AssignedUserID = assignee
+	}
+
+	if contact := strings.TrimSpace(query.Get("contact")); contact != "" {
+		if !isID(contact) {
+			return "`contact` must be a contact ID."
+		}
+		f.ContactID = contact
+	}
+
+	for key, date := range map[string]*string{
+		"created_from": &f.CreatedFrom,
+		"created_to":   &f.CreatedTo,
+		"updated_from": &f.UpdatedFrom,
+		"updated_to":   &f.UpdatedTo,
+	} {
+		value := strings.TrimSpace(query.Get(key))
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Sprintf("`%s` must be a date (YYYY-MM-DD).", key)
+		}
+		*date = value
+	}
+
+	if msg := f.parseFields(query, defs); msg != "" {
+		return msg
+	}
+
+	switch sort := query.Get("sort"); {
+	case sort == "":
+	case strings.HasPrefix(sort, "cf."):
+		def, ok := defs.find(strings.TrimPrefix(sort, "cf."))
+		if !ok || !def.sortable() {
+			return fmt.Sprintf("Cannot sort by `%s`.", sort)
+		}
+		f.Sort, f.SortField = "field", def
+	default:
+		if _, ok := jobSortColumns[sort]; !ok {
+			return fmt.Sprintf("Cannot sort by `%s`.", sort)
+		}
+		f.Sort = sort
+	}
+
+	switch query.Get("dir") {
+	case "", "asc":
+	case "desc":
+		f.Descending = true
+	default:
+		return "`dir` must be `asc` or `desc`."
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		var cursor jobCursor
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err == nil {
+			err = json.Unmarshal(decoded, &cursor)
+		}
+		if err != nil || cursor.Sort != f.sortName() || cursor.Descending != f.Descending {
+			return "`cursor` does not fit this sort; start from the first page."
+		}
+		f.Cursor = &cursor
+	}
+
+	return ""
+}
+
+// parseFields reads cf[field_name] for a value the field must have and
+// cf_from[field_name] and cf_to[field_name] for the range of numbers, amounts
+// and dates.
+func (f *jobFilter) parseFields(query url.Values, defs CustomFieldDefList) string {
+	filters := make(map[string]*jobFieldFilter)
+	for key, values := range query {
+		prefix, name, ok := strings.Cut(key, "[")
+		if !ok || (prefix != "cf" && prefix != "cf_from" && prefix != "cf_to") {
+			continue
+		}
+		name = strings.TrimSuffix(name, "]")
+		value := strings.TrimSpace(strings.Join(values, "\n"))
+		if value == "" {
+			continue
+		}
+
+		def, ok := defs.find(name)
+		if !ok || !def.filterable() {
+			return fmt.Sprintf("Cannot filter by the custom field `%s`.", name)
+		}
+		filter, ok := filters[name]
+		if !ok {
+			filter = &jobFieldFilter{Def: def}
+			filters[name] = filter
+		}
+
+		if prefix == "cf" {
+			def.IsRequired = false
+			typed, msg := def.parse(value)
+			if msg == "" && typed == nil {
+				msg = "Cannot filter by this value."
+			}
+			if msg != "" {
+				return fmt.Sprintf("%s: %s", def.FieldLabel, msg)
+			}
+			encoded, err := json.Marshal(map[string]any{def.FieldName: typed})
+			if err != nil {
+				return fmt.Sprintf("%s: Cannot filter by this value.", def.FieldLabel)
+			}
+			filter.Equals = string(encoded)
+			continue
+		}
+
+		if !def.ranged() {
+			return fmt.Sprintf("%s: Only numbers, amounts and dates filter by a range.", def.FieldLabel)
+		}
+		if def.numeric() {
+			if _, err := decimal.NewFromString(value); err != nil {
+				return fmt.Sprintf("%s: The range must be numbers.", def.FieldLabel)
+			}
+		} else if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Sprintf("%s: The range must be dates (YYYY-MM-DD).", def.FieldLabel)
+		}
+		if prefix == "cf_from" {
+			filter.From = value
+		} else {
+			filter.To = value
+		}
+	}
+
+	for _, def := range defs {
+		if filter, ok := filters[def.FieldName]; ok {
+			f.Fields = append(f.Fields, *filter)
+		}
+	}
+	return ""
+}
+
+// jobFieldExpr is the stored value of a custom field as SQL: numeric for
+// numbers and amounts, whether stored as JSON numbers or strings, and text
+// otherwise.
+func jobFieldExpr(args *sqlArgs, def CustomFieldDef) (string, string) {
+	name := args.add(def.FieldName)
+	if def.numeric() {
+		return fmt.Sprintf(`(CASE WHEN j.custom_fields->>%[1]s::text ~ '^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$' THEN (j.custom_fields->>%[1]s::text)::numeric END)`, name), "numeric"
+	}
+	return fmt.Sprintf("(j.custom_fields->>%s::text)", name), "text"
+}
+
+// conditions turns the filters into WHERE conditions on jobs j.
+func (f jobFilter) conditions(args *sqlArgs) []string {
+	var conditions []string
+	if f.JobTypeID != "" {
+		conditions = append(conditions, "j.job_type_id = "+args.add(f.JobTypeID)+"::int")
+	}
+	switch f.AssignedUserID {
+	case "":
+	case "none":
+		conditions = append(conditions, "j.assigned_to_user_id IS NULL")
+	default:
+		conditions = append(conditions, "j.assigned_to_user_id = "+args.add(f.AssignedUserID)+"::int")
+	}
+	if len(f.Statuses) > 0 {
+		conditions = append(conditions, "j.status = ANY("+args.add(f.Statuses)+"::text[])")
+	}
+	if len(f.Priorities) > 0 {
+		conditions = append(conditions, "j.priority = ANY("+args.add(f.Priorities)+"::text[])")
+	}
+	if f.Overdue {
+		conditions = append(conditions, "job_overdue(j) IS NOT NULL")
+	}
+	if f.ContactID != "" {
+		contact := args.add(f.ContactID)
+		conditions = append(conditions, fmt.Sprintf("(j.primary_contact_id = %[1]s::int OR EXISTS (SELECT 1 FROM job_contacts jc WHERE jc.job_id = j.id AND jc.contact_id = %[1]s::int))", contact))
+	}
+
+	for column, dates := range map[string][2]string{
+		"j.created_at": {f.CreatedFrom, f.CreatedTo},
+		"j.updated_at": {f.UpdatedFrom, f.UpdatedTo},
+	} {
+		if dates[0] != "" {
+			conditions = append(conditions, column+" >= "+args.add(dates[0])+"::date")
+		}
+		if dates[1] != "" {
+			conditions = append(conditions, column+" < "+args.add(dates[1])+"::date + 1")
+		}
+	}
+
+	for _, filter := range f.Fields {
+		if filter.Equals != "" {
+			conditions = append(conditions, "j.custom_fields @> "+args.add(filter.Equals)+"::jsonb")
+		}
+		if filter.From == "" && filter.To == "" {
+			continue
+		}
+		expr, sqlType := jobFieldExpr(args, filter.Def)
+		if filter.From != "" {
+			conditions = append(conditions, fmt.Sprintf("%s >= %s::%s", expr, args.add(filter.From), sqlType))
+		}
+		if filter.To != "" {
+			conditions = append(conditions, fmt.Sprintf("%s <= %s::%s", expr, args.add(filter.To), sqlType))
+		}
+	}
+
+	return conditions
+}
+
+// sortKey is the SQL expression the list is ordered by, its type and the
+// value jobs without one stand in with.
+func (f jobFilter) sortKey(args *sqlArgs) (string, string, string) {
+	if f.Sort == "field" {
+		expr, sqlType := jobFieldExpr(args, f.SortField)
+		if sqlType == "numeric" {
+			return expr, sqlType, "0"
+		}
+		return expr, sqlType, "''"
+	}
+
+	column := jobSortColumns[f.sortName()]
+	switch column.sqlType {
+	case "timestamptz", "date":
+		return column.expr, column.sqlType, "'epoch'::" + column.sqlType
+	case "text":
+		return column.expr, column.sqlType, "''"
+	}
+	return column.expr, column.sqlType, "0"
+}
+
+// keyset is the condition for the jobs after cursor, on the sort key sk of
+// the list query. Jobs without a sort value come last in either direction.
+func (f jobFilter) keyset(args *sqlArgs, cursor jobCursor, sqlType string) string {
+	cmp := ">"
+	if f.Descending {
+		cmp = "<"
+	}
+	isNull := args.add(cursor.Null)
+	value := args.add(cursor.Value)
+	id := args.add(cursor.ID)
+	return fmt.Sprintf("(sk.is_null > %[1]s OR (sk.is_null = %[1]s AND (sk.value %[4]s %[2]s::%[5]s OR (sk.value = %[2]s::%[5]s AND j.id %[4]s %[3]s))))",
+		isNull, value, id, cmp, sqlType)
+}
+
+// nextJobListURL is the fragment URL of the page after jobs, keeping the
+// filters and sort of the current request.
+func nextJobListURL(c *gin.Context, listURL string, jobs []Job) string {
+	if len(jobs) == 0 {
+		return ""
+	}
+	query := c.Request.URL.Query()
+	query.Del("after")
+	query.Set("cursor", jobs[len(jobs)-1].sortKey.String())
+	if query.Get("limit") == "" {
+		query.Set("limit", "20")
+	}
+	return listURL + "?" + query.Encode()
+}
+
+// apiNextCursor is the next_cursor of an API job list: the last ID, passed
+// back as `after`, when the list runs by ID, and a `cursor` otherwise.
+func (f jobFilter) apiNextCursor(jobs []Job, limit int) any {
+	if len(jobs) < limit {
+		return nil
+	}
+	last := jobs[len(jobs)-1]
+	if f.sortName() == "id" && !f.Descending {
+		return last.ID
+	}
+	return last.sortKey.String()
+}
+
+// savedQuery keeps the filters and sort of a query string, the way a saved
+// view stores them.
+func savedQuery(query url.Values) url.Values {
+	saved := make(url.Values)
+	for key, values := range query {
+		prefix, _, _ := strings.Cut(key, "[")
+		if !slices.Contains(jobFilterKeys, key) && prefix != "cf" && prefix != "cf_from" && prefix != "cf_to" {
+			continue
+		}
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				saved.Add(key, value)
+			}
+		}
+	}
+	return saved
+}
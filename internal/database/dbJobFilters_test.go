@@ -0,0 +1,150 @@
+package database
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var jobFilterTestDefs = CustomFieldDefList{
+	{FieldName: "amount", FieldLabel: "Amount", FieldType: "currency"},
+	{FieldName: "site", FieldLabel: "Site", FieldType: "text"},
+	{FieldName: "tags", FieldLabel: "Tags", FieldType: "multiselect", Options: []string{"a"}},
+}
+
+func TestJobFilterParseSortAndCursor(t *testing.T) {
+	cursor := jobCursor{Sort: "cf.amount", Descending: true, Null: true, Value: "0", ID: 9}
+
+	var f jobFilter
+	query := url.Values{"sort": {"cf.amount"}, "dir": {"desc"}, "cursor": {cursor.String()}}
+	if msg := f.parse(query, jobFilterTestDefs); msg != "" {
+		t.Fatalf("parse refused the query: %s", msg)
+	}
+
+	if f.Sort != "field" || f.SortField.FieldName != "amount" || !f.Descending {
+		t.Errorf("parse = sort %q on %q, descending %v; want field on amount, descending", f.Sort, f.SortField.FieldName, f.Descending)
+	}
+	if f.Cursor == nil || *f.Cursor != cursor {
+		t.Errorf("parse cursor = %+v, want %+v", f.Cursor, cursor)
+	}
+}
+
+func TestJobFilterParseRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"unknown sort", url.Values{"sort": {"colour"}}},
+		{"unknown field", url.Values{"sort": {"cf.colour"}}},
+		{"field without an order", url.Values{"sort": {"cf.tags"}}},
+		{"direction", url.Values{"dir": {"up"}}},
+		{"cursor of another sort", url.Values{"sort": {"cf.site"}, "cursor": {jobCursor{Sort: "cf.amount", ID: 1}.String()}}},
+		{"cursor of the default sort used with another", url.Values{"sort": {"due"}, "cursor": {jobCursor{Sort: "id", ID: 1}.String()}}},
+		{"ascending cursor used descending", url.Values{"sort": {"due"}, "dir": {"desc"}, "cursor": {jobCursor{Sort: "due", ID: 1}.String()}}},
+		{"descending cursor used ascending", url.Values{"sort": {"due"}, "cursor": {jobCursor{Sort: "due", Descending: true, ID: 1}.String()}}},
+		{"cursor that is not base64", url.Values{"cursor": {"%%%"}}},
+		{"cursor that is not JSON", url.Values{"cursor": {"bm90IGpzb24"}}},
+	}
+
+	for _, tt := range tests {
+		var f jobFilter
+		if msg := f.parse(tt.query, jobFilterTestDefs); msg == "" {
+			t.Errorf("%s: parse accepted %v", tt.name, tt.query)
+		}
+	}
+}
+
+func TestJobFilterSortKey(t *testing.T) {
+	amount, _ := jobFilterTestDefs.find("amount")
+	site, _ := jobFilterTestDefs.find("site")
+
+	tests := []struct {
+		name        string
+		filter      jobFilter
+		wantExpr    string // substring of the expression
+		wantType    string
+		wantDefault string
+		wantArgs    []any
+	}{
+		{"default", jobFilter{}, "j.id", "int", "0", nil},
+		{"due date", jobFilter{Sort: "due"}, "j.due_date", "date", "'epoch'::date", nil},
+		{"title", jobFilter{Sort: "title"}, "lower(j.title)", "text", "''", nil},
+		{"currency field", jobFilter{Sort: "field", SortField: amount}, "(j.custom_fields->>$2::text)::numeric", "numeric", "0", []any{"user", "amount"}},
+		{"text field", jobFilter{Sort: "field", SortField: site}, "(j.custom_fields->>$2::text)", "text", "''", []any{"user", "site"}},
+	}
+
+	for _, tt := range tests {
+		args := sqlArgs{"user"}
+		expr, sqlType, sortDefault := tt.filter.sortKey(&args)
+		if !strings.Contains(expr, tt.wantExpr) || sqlType != tt.wantType || sortDefault != tt.wantDefault {
+			t.Errorf("%s: sortKey = (%q, %q, %q), want (%q…, %q, %q)", tt.name, expr, sqlType, sortDefault, tt.wantExpr, tt.wantType, tt.wantDefault)
+		}
+		wantArgs := tt.wantArgs
+		if wantArgs == nil {
+			wantArgs = []any{"user"}
+		}
+		if !reflect.DeepEqual([]any(args), wantArgs) {
+			t.Errorf("%s: sortKey args = %v, want %v", tt.name, args, wantArgs)
+		}
+	}
+}
+
+// TestJobFilterKeyset checks the condition for the page after a cursor. The
+// null flag is compared first, so jobs without a sort value stay after every
+// job with one in either direction, and a cursor on such a job only moves on
+// through them by ID.
+func TestJobFilterKeyset(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   jobFilter
+		cursor   jobCursor
+		sqlType  string
+		want     string
+		wantArgs []any
+	}{
+		{
+			name:     "ascending",
+			filter:   jobFilter{Sort: "field"},
+			cursor:   jobCursor{Sort: "cf.amount", Value: "12.50", ID: 7},
+			sqlType:  "numeric",
+			want:     "(sk.is_null > $2 OR (sk.is_null = $2 AND (sk.value > $3::numeric OR (sk.value = $3::numeric AND j.id > $4))))",
+			wantArgs: []any{"user", false, "12.50", 7},
+		},
+		{
+			name:     "descending keeps jobs without a value last",
+			filter:   jobFilter{Sort: "field", Descending: true},
+			cursor:   jobCursor{Sort: "cf.amount", Value: "12.50", ID: 7},
+			sqlType:  "numeric",
+			want:     "(sk.is_null > $2 OR (sk.is_null = $2 AND (sk.value < $3::numeric OR (sk.value = $3::numeric AND j.id < $4))))",
+			wantArgs: []any{"user", false, "12.50", 7},
+		},
+		{
+			name:     "cursor on a job without a value",
+			filter:   jobFilter{Sort: "field"},
+			cursor:   jobCursor{Sort: "cf.site", Null: true, Value: "", ID: 9},
+			sqlType:  "text",
+			want:     "(sk.is_null > $2 OR (sk.is_null = $2 AND (sk.value > $3::text OR (sk.value = $3::text AND j.id > $4))))",
+			wantArgs: []any{"user", true, "", 9},
+		},
+		{
+			name:     "descending cursor on a job without a value",
+			filter:   jobFilter{Sort: "due", Descending: true},
+			cursor:   jobCursor{Sort: "due", Null: true, Value: "1970-01-01", ID: 3},
+			sqlType:  "date",
+			want:     "(sk.is_null > $2 OR (sk.is_null = $2 AND (sk.value < $3::date OR (sk.value = $3::date AND j.id < $4))))",
+			wantArgs: []any{"user", true, "1970-01-01", 3},
+		},
+	}
+
+	for _, tt := range tests {
+		args := sqlArgs{"user"}
+		got := tt.filter.keyset(&args, tt.cursor, tt.sqlType)
+		if got != tt.want {
+			t.Errorf("%s: keyset =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual([]any(args), tt.wantArgs) {
+			t.Errorf("%s: keyset args = %v, want %v", tt.name, args, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobPriorities are the priorities of a job, lowest first.
+var jobPriorities = []string{"low", "normal", "high", "urgent"}
+
+// jobPriorityChoices are the options of a priority select, with selected
+// marked.
+func jobPriorityChoices(selected ...string) []CustomFieldChoice {
+	choices := make([]CustomFieldChoice, 0, len(jobPriorities))
+	for _, priority := range jobPriorities {
+		choices = append(choices, CustomFieldChoice{Value: priority, Label: strings.ToUpper(priority[:1]) + priority[1:]})
+	}
+	return markSelected(choices, selected)
+}
+
+// JobSLAPolicy is how soon a job type's jobs of one priority must be
+// responded to and resolved. A nil target is not tracked.
+type JobSLAPolicy struct {
+	Priority          string `json:"priority"`
+	ResponseMinutes   *int   `json:"response_minutes"`
+	ResolutionMinutes *int   `json:"resolution_minutes"`
+}
+
+// ResponseHours and ResolutionHours fill the hour inputs of the SLA modal.
+func (p JobSLAPolicy) ResponseHours() string   { return minutesAsHours(p.ResponseMinutes) }
+func (p JobSLAPolicy) ResolutionHours() string { return minutesAsHours(p.ResolutionMinutes) }
+
+func (p JobSLAPolicy) PriorityLabel() string {
+	return strings.ToUpper(p.Priority[:1]) + p.Priority[1:]
+}
+
+func minutesAsHours(minutes *int) string {
+	if minutes == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*minutes)/60, 'f', -1, 64)
+}
+
+// parseHours reads an SLA target given in hours as minutes; empty is no
+// target.
+func parseHours(value string) (*int, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, true
+	}
+	hours, err := strconv.ParseFloat(value, 64)
+	if err != nil || hours <= 0 || hours > 24*365 {
+		return nil, false
+	}
+	minutes := max(int(math.Round(hours*60)), 1)
+	return &minutes, true
+}
+
+// overdueLabel says what a job is overdue on, as job_overdue names it.
+func overdueLabel(overdue string) string {
+	switch overdue {
+	case "resolution":
+		return "Resolution overdue"
+	case "response":
+		return "Response overdue"
+	case "due_date":
+		return "Overdue"
+	}
+	return ""
+}
+
+func (j Job) OverdueLabel() string       { return overdueLabel(j.Overdue) }
+func (j JobDetail) OverdueLabel() string { return overdueLabel(j.Overdue) }
+
+// parseJobSchedule reads the priority and due date of a job form. present
+// is whether the form sent a due date at all; an empty one clears it.
+func parseJobSchedule(c *gin.Context) (priority, dueDate string, present bool, msg string) {
+	priority = c.PostForm("priority")
+	if priority != "" && !slices.Contains(jobPriorities, priority) {
+		return "", "", false, "Priority must be low, normal, high or urgent."
+	}
+
+	dueDate, present = c.GetPostForm("due_date")
+	if dueDate != "" {
+		if _, err := time.Parse("2006-01-02", dueDate); err != nil {
+			return "", "", false, "The due date must be a date (YYYY-MM-DD)."
+		}
+	}
+	return priority, dueDate, present, ""
+}
+
+// fetchJobSLAPolicies returns a job type's SLA policy for every priority,
+// in the order of jobPriorities.
+func fetchJobSLAPolicies(c *gin.Context, jobTypeID string) ([]JobSLAPolicy, error) {
+	query := `SELECT priority, response_minutes, resolution_minutes FROM job_type_slas WHERE job_type_id = $1`
+	rows, err := conn.Query(c.Request.Context(), query, jobTypeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]JobSLAPolicy)
+	for rows.Next() {
+		var p JobSLAPolicy
+		if err := rows.Scan(&p.Priority, &p.ResponseMinutes, &p.ResolutionMinutes); err != nil {
+			return nil, err
+		}
+		stored[p.Priority] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	policies := make([]JobSLAPolicy, 0, len(jobPriorities))
+	for _, priority := range jobPriorities {
+		p, ok := stored[priority]
+		if !ok {
+			p = JobSLAPolicy{Priority: priority}
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func JobSLAModal(c *gin.Context) {
+	id := c.Param("id")
+
+	var jt jobType
+	if err := jt.findJobTypeByID(c, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job SLA Modal: Job type {ID: %s} not found `%v`", id, err))
+		c.String(http.StatusNotFound, "Job Type not found")
+		return
+	}
+
+	policies, err := fetchJobSLAPolicies(c, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job SLA Modal [SQL]: Error while querying job_type_slas for job type %s `%v`", id, err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobTypeSLAModal.html", gin.H{
+		"JobType":  jt,
+		"Policies": policies,
+	})
+}
+
+// UpdateJobSLAs replaces the response and resolution targets of a job type,
+// given in hours per priority as response_hours[priority] and
+// resolution_hours[priority].
+func UpdateJobSLAs(c *gin.Context) {
+	id := c.Param("id")
+	responseHours := c.PostFormMap("response_hours")
+	resolutionHours := c.PostFormMap("resolution_hours")
+
+	renderError := func(message string) {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	var policies []JobSLAPolicy
+	for _, priority := range jobPriorities {
+		response, ok := parseHours(responseHours[priority])
+		if !ok {
+			renderError(fmt.Sprintf("The %s response target must be a positive number of hours.", priority))
+			return
+		}
+		resolution, ok := parseHours(resolutionHours[priority])
+		if !ok {
+			renderError(fmt.Sprintf("The %s resolution target must be a positive number of hours.", priority))
+			return
+		}
+		if response != nil || resolution != nil {
+			policies = append(policies, JobSLAPolicy{Priority: priority, ResponseMinutes: response, ResolutionMinutes: resolution})
+		}
+	}
+
+	var jt jobType
+	if err := jt.findJobTypeByID(c, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Job SLAs: Job type {ID: %s} not found `%v`", id, err))
+		renderError("Job type not found.")
+		return
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Job SLAs [SQL]: Error while starting transaction `%v`", err))
+		renderError("Cannot save changes.")
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	if _, err := tx.Exec(c.Request.Context(), `DELETE FROM job_type_slas WHERE job_type_id = $1`, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Job SLAs [SQL]: Error while deleting from job_type_slas table `%v`", err))
+		renderError("Cannot save changes.")
+		return
+	}
+
+	query := `INSERT INTO job_type_slas (job_type_id, priority, response_minutes, resolution_minutes) VALUES ($1, $2, $3, $4)`
+	for _, p := range policies {
+		if _, err := tx.Exec(c.Request.Context(), query, id, p.Priority, p.ResponseMinutes, p.ResolutionMinutes); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Update Job SLAs [SQL]: Error while inserting into job_type_slas table `%v`", err))
+			renderError("Cannot save changes.")
+			return
+		}
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Job SLAs [SQL]: Error while committing transaction `%v`", err))
+		renderError("Cannot save changes.")
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="success">SLA targets saved.</div>`))
+}
+
+// RunSLAWorker escalates overdue jobs every interval until ctx is done.
+func RunSLAWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := escalateOverdueJobs(ctx); err != nil {
+			log.Printf("SLA Worker [SQL]: Error while escalating overdue jobs `%v`", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// escalateOverdueJobs writes a job update on every job that newly missed its
+// due date or an SLA target and notifies its assignee. Each breach is
+// escalated once; breaches that ended, because the job was resolved or given
+// a later due date, are forgotten so they escalate again if they recur.
+func escalateOverdueJobs(ctx context.Context) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	DELETE FROM job_sla_escalations e
+	USING jobs j
+	WHERE j.id = e.job_id
+	    AND ((e.breach = 'resolution' AND j.resolved_at IS NOT NULL)
+	        OR (e.breach = 'due_date' AND (j.due_date IS NULL OR j.due_date >= CURRENT_DATE)))`
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	query = `
+	WITH breaches AS (
+	    SELECT j.id, j.ticket_id, j.title, j.assigned_to_user_id, job_overdue(j) AS breach
+	    FROM jobs j
+	    WHERE j.resolved_at IS NULL
+	),
+	escalated AS (
+	    INSERT INTO job_sla_escalations (job_id, breach)
+	    SELECT id, breach FROM breaches WHERE breach IS NOT NULL
+	    ON CONFLICT DO NOTHING
+	    RETURNING job_id, breach
+	),
+	messages AS (
+	    SELECT e.job_id, e.breach, b.assigned_to_user_id, b.ticket_id || ' ' || b.title AS job,
+	        CASE e.breach
+	            WHEN 'resolution' THEN 'Resolution target missed'
+	            WHEN 'response' THEN 'Response target missed'
+	            ELSE 'Due date passed'
+	        END AS title
+	    FROM escalated e
+	    JOIN breaches b ON b.id = e.job_id
+	),
+	updates AS (
+	    INSERT INTO job_updates (job_id, author_user_id, content)
+	    SELECT job_id, NULL, jsonb_build_object('type', 'sla_breach', 'breach', breach, 'title', title)
+	    FROM messages
+	)
+	INSERT INTO notifications (user_id, job_id, message)
+	SELECT assigned_to_user_id, job_id, title || ': ' || job
+	FROM messages
+	WHERE assigned_to_user_id IS NOT NULL`
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
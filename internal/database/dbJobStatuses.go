@@ -0,0 +1,519 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// JobStatusDef is one status of a job type's workflow. Transitions lists the
+// names of the statuses a job may move to from this one. The SLA clocks of a
+// job stand still while it is in a status that pauses them or is final.
+type JobStatusDef struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	IsInitial   bool     `json:"is_initial"`
+	IsFinal     bool     `json:"is_final"`
+	PausesSLA   bool     `json:"pauses_sla"`
+	Transitions []string `json:"transitions"`
+}
+type JobStatusDefList []JobStatusDef
+
+func (s JobStatusDef) CanMoveTo(name string) bool {
+	return slices.Contains(s.Transitions, name)
+}
+
+var statusNameFormat = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var errJobStatusWorkflowChanged = errors.New("the status workflow changed meanwhile")
+
+func (statuses JobStatusDefList) find(name string) (JobStatusDef, bool) {
+	for _, s := range statuses {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return JobStatusDef{}, false
+}
+
+// stopsSLA reports whether the SLA clocks stand still in a status.
+func (statuses JobStatusDefList) stopsSLA(name string) bool {
+	s, ok := statuses.find(name)
+	return ok && (s.PausesSLA || s.IsFinal)
+}
+
+func (statuses JobStatusDefList) label(name string) string {
+	if s, ok := statuses.find(name); ok && s.Label != "" {
+		return s.Label
+	}
+	return name
+}
+
+// initial is the status new jobs start in: the one marked initial, or the
+// first one when none is.
+func (statuses JobStatusDefList) initial() string {
+	for _, s := range statuses {
+		if s.IsInitial {
+			return s.Name
+		}
+	}
+	if len(statuses) > 0 {
+		return statuses[0].Name
+	}
+	return "open"
+}
+
+// canTransition reports whether a job may move from one status to another.
+// Jobs in a status the workflow no longer knows may move to any status, so
+// they are never stuck.
+func (statuses JobStatusDefList) canTransition(from, to string) bool {
+	if _, ok := statuses.find(to); !ok {
+		return false
+	}
+	current, ok := statuses.find(from)
+	if !ok {
+		return true
+	}
+	return from == to || current.CanMoveTo(to)
+}
+
+// transitionError explains why a job cannot move from one status to another,
+// or is empty when it can.
+func (statuses JobStatusDefList) transitionError(from, to string) string {
+	if statuses.canTransition(from, to) {
+		return ""
+	}
+	return fmt.Sprintf("A job cannot move from %s to %s.", statuses.label(from), statuses.label(to))
+}
+
+// next lists the statuses offered when editing a job in the given status:
+// the current one first, then the ones it can move to.
+func (statuses JobStatusDefList) next(from string) JobStatusDefList {
+	current, ok := statuses.find(from)
+	if !ok {
+		return append(JobStatusDefList{{Name: from, Label: from}}, statuses...)
+	}
+
+	options := JobStatusDefList{current}
+	for _, s := range statuses {
+		if s.Name != from && current.CanMoveTo(s.Name) {
+			options = append(options, s)
+		}
+	}
+	return options
+}
+
+func fetchJobStatuses(c *gin.Context, jobTypeID string) (JobStatusDefList, error) {
+	var workflowJSON []byte
+	query := `SELECT status_workflow FROM job_types WHERE id = $1`
+	if err := conn.QueryRow(c.Request.Context(), query, jobTypeID).Scan(&workflowJSON); err != nil {
+		return nil, err
+	}
+
+	var statuses JobStatusDefList
+	if err := json.Unmarshal(workflowJSON, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// fetchJobStatusWorkflow returns the current status of a job and the
+// workflow of its job type.
+func fetchJobStatusWorkflow(c *gin.Context, jobID string) (string, JobStatusDefList, error) {
+	var status string
+	var workflowJSON []byte
+	query := `
+	SELECT j.status, jt.status_workflow
+	FROM jobs j
+	JOIN job_types jt ON jt.id = j.job_type_id
+	WHERE j.id = $1`
+	if err := conn.QueryRow(c.Request.Context(), query, jobID).Scan(&status, &workflowJSON); err != nil {
+		return "", nil, err
+	}
+
+	var statuses JobStatusDefList
+	if err := json.Unmarshal(workflowJSON, &statuses); err != nil {
+		return "", nil, err
+	}
+	return status, statuses, nil
+}
+
+// fetchJobStatusesTx locks the workflow of a job type for the rest of tx and
+// returns it with its version.
+func fetchJobStatusesTx(ctx context.Context, tx pgx.Tx, jobTypeID string) (JobStatusDefList, int, error) {
+	var workflowJSON []byte
+	var version int
+	query := `SELECT status_workflow, status_workflow_version FROM job_types WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, jobTypeID).Scan(&workflowJSON, &version); err != nil {
+		return nil, 0, err
+	}
+
+	var statuses JobStatusDefList
+	if err := json.Unmarshal(workflowJSON, &statuses); err != nil {
+		return nil, 0, err
+	}
+	return statuses, version, nil
+}
+
+// updateJobStatusesTx saves the workflow and returns its new version.
+func updateJobStatusesTx(ctx context.Context, tx pgx.Tx, jobTypeID string, statuses JobStatusDefList) (int, error) {
+	if statuses == nil {
+		statuses = JobStatusDefList{}
+	}
+	workflowJSON, err := json.Marshal(statuses)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	query := `
+	UPDATE job_types
+	SET status_workflow = $2, status_workflow_version = status_workflow_version + 1
+	WHERE id = $1
+	RETURNING status_workflow_version`
+	err = tx.QueryRow(ctx, query, jobTypeID, workflowJSON).Scan(&version)
+	return version, err
+}
+
+// slaAssignments is the SET list that brings the SLA clocks and resolved_at
+// of a job in line with status: the clocks stop while the status pauses them
+// or is final, and the job is resolved while the status is final. Moving a
+// job and changing the flags of the status it is in both use it.
+func (statuses JobStatusDefList) slaAssignments(args *sqlArgs, status string) string {
+	target, _ := statuses.find(status)
+	return fmt.Sprintf(`
+	    sla_paused_seconds = sla_paused_seconds + COALESCE(EXTRACT(EPOCH FROM NOW() - sla_paused_at)::int, 0),
+	    sla_paused_at = CASE WHEN %s::boolean THEN NOW() END,
+	    resolved_at = CASE WHEN %s::boolean THEN COALESCE(resolved_at, NOW()) END`,
+		args.add(statuses.stopsSLA(status)), args.add(target.IsFinal))
+}
+
+// recordStatusChange adds the structured job_updates entry written for every
+// status transition.
+func recordStatusChange(c *gin.Context, tx pgx.Tx, jobID, authorUserID, from, to string, statuses JobStatusDefList) error {
+	content, err := json.Marshal(gin.H{
+		"type":       "status_change",
+		"title":      fmt.Sprintf("Status changed to %s", statuses.label(to)),
+		"from":       from,
+		"to":         to,
+		"from_label": statuses.label(from),
+		"to_label":   statuses.label(to),
+	})
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO job_updates (job_id, author_user_id, content) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(c.Request.Context(), query, jobID, authorUserID, content)
+	return err
+}
+
+// moveJobStatus moves a job to another status within tx and records the
+// transition. Editing a job and dragging it on the board both go through it.
+// The SLA clocks stop or run again with the status, and the job is resolved
+// while it is in a final status. It fails with pgx.ErrNoRows when the job is
+// no longer in from, and with errJobStatusWorkflowChanged when the workflow
+// no longer allows the move.
+func moveJobStatus(c *gin.Context, tx pgx.Tx, jobID, authorUserID, from, to string, statuses JobStatusDefList) error {
+	// Share-lock the workflow so a status cannot be deleted while a job moves
+	// into it, and check the move against the workflow as it is now.
+	var workflowJSON []byte
+	query := `
+	SELECT jt.status_workflow
+	FROM job_types jt
+	JOIN jobs j ON j.job_type_id = jt.id
+	WHERE j.id = $1
+	FOR SHARE OF jt`
+	if err := tx.QueryRow(c.Request.Context(), query, jobID).Scan(&workflowJSON); err != nil {
+		return err
+	}
+	var current JobStatusDefList
+	if err := json.Unmarshal(workflowJSON, &current); err != nil {
+		return err
+	}
+	if !current.canTransition(from, to) {
+		return errJobStatusWorkflowChanged
+	}
+	statuses = current
+
+	args := sqlArgs{jobID, from, to}
+	query = `
+	UPDATE jobs
+	SET
+	    status = $3,` + statuses.slaAssignments(&args, to) + `
+	WHERE id = $1 AND status = $2`
+	cmdTag, err := tx.Exec(c.Request.Context(), query, args...)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return recordStatusChange(c, tx, jobID, authorUserID, from, to, statuses)
+}
+
+func renderJobStatusError(c *gin.Context, message string) {
+	c.Header("HX-Retarget", "#status-feedback")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+		"Message": message,
+	})
+}
+
+// renderJobStatuses answers a change with the new list, the new version for
+// the next change and an emptied feedback area.
+func renderJobStatuses(c *gin.Context, jobTypeID string, statuses JobStatusDefList, version int) {
+	c.HTML(http.StatusOK, "jobStatusList.html", gin.H{
+		"Standalone": true,
+		"Version":    version,
+		"JobType":    gin.H{"ID": jobTypeID},
+		"Statuses":   statuses,
+	})
+}
+
+// renderJobStatusConflict tells the admin someone else changed the workflow
+// meanwhile and swaps in the current list and version.
+func renderJobStatusConflict(c *gin.Context, jobTypeID string, statuses JobStatusDefList, version int) {
+	c.Header("HX-Retarget", "#status-feedback")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "jobStatusConflict.html", gin.H{
+		"Message":  "Someone else changed these statuses meanwhile, so nothing was saved. The list now shows their changes; please make yours again.",
+		"Version":  version,
+		"JobType":  gin.H{"ID": jobTypeID},
+		"Statuses": statuses,
+	})
+}
+
+// changeJobStatuses runs change on the locked workflow of the route's job
+// type in one transaction, saves what it returns and renders the list. The
+// change is refused when the workflow moved past the version the admin's page
+// shows. A message change returns is shown to the admin and nothing is saved.
+func changeJobStatuses(c *gin.Context, handler string, change func(ctx context.Context, tx pgx.Tx, statuses JobStatusDefList) (JobStatusDefList, string, error)) {
+	id := c.Param("id")
+
+	value := c.PostForm("version")
+	if value == "" {
+		value = c.Query("version")
+	}
+	submittedVersion, err := strconv.Atoi(value)
+	if err != nil {
+		renderJobStatusError(c, "Error: Missing or invalid version. Reload and try again.")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while starting transaction `%v`", handler, err))
+		renderJobStatusError(c, "An internal error occurred. Please try again.")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	statuses, version, err := fetchJobStatusesTx(ctx, tx, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while querying status_workflow for job type %s `%v`", handler, id, err))
+		renderJobStatusError(c, "An internal error occurred. Please try again.")
+		return
+	}
+	if submittedVersion != version {
+		logger.LogToLogFile(c, fmt.Sprintf("%s: Status workflow of job type %s is at version %d, not %d", handler, id, version, submittedVersion))
+		renderJobStatusConflict(c, id, statuses, version)
+		return
+	}
+
+	statuses, message, err := change(ctx, tx, statuses)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while changing status_workflow for job type %s `%v`", handler, id, err))
+		renderJobStatusError(c, "An internal error occurred. Please try again.")
+		return
+	}
+	if message != "" {
+		renderJobStatusError(c, message)
+		return
+	}
+
+	version, err = updateJobStatusesTx(ctx, tx, id, statuses)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while updating status_workflow for job type %s `%v`", handler, id, err))
+		renderJobStatusError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while committing transaction `%v`", handler, err))
+		renderJobStatusError(c, "An internal error occurred. Please try again.")
+		return
+	}
+
+	renderJobStatuses(c, id, statuses, version)
+}
+
+func JobStatusesModal(c *gin.Context) {
+	id := c.Param("id")
+
+	var jt jobType
+	if err := jt.findJobTypeByID(c, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Statuses Modal: Job type {ID: %s} not found `%v`", id, err))
+		c.String(http.StatusNotFound, "Job Type not found")
+		return
+	}
+
+	var workflowJSON []byte
+	var version int
+	query := `SELECT status_workflow, status_workflow_version FROM job_types WHERE id = $1`
+	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&workflowJSON, &version)
+	var statuses JobStatusDefList
+	if err == nil {
+		err = json.Unmarshal(workflowJSON, &statuses)
+	}
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Statuses Modal [SQL]: Error while querying status_workflow for job type %s `%v`", id, err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "manageJobStatusesModal.html", gin.H{
+		"JobType":  jt,
+		"Version":  version,
+		"Statuses": statuses,
+	})
+}
+
+func AddJobStatus(c *gin.Context) {
+	name := c.PostForm("name")
+	label := c.PostForm("label")
+
+	if name == "" || label == "" {
+		renderJobStatusError(c, "Error: Name and label cannot be empty.")
+		return
+	}
+
+	if !statusNameFormat.MatchString(name) {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Status: name is not a valid name [%s]", name))
+		renderJobStatusError(c, "Error: Use only lowercase letters, numbers, and underscores in the name.")
+		return
+	}
+
+	changeJobStatuses(c, "Add Job Status", func(ctx context.Context, tx pgx.Tx, statuses JobStatusDefList) (JobStatusDefList, string, error) {
+		if _, exists := statuses.find(name); exists {
+			return nil, fmt.Sprintf("Error: Status '%s' already exists.", name), nil
+		}
+
+		status := JobStatusDef{
+			Name:        name,
+			Label:       label,
+			IsInitial:   c.PostForm("is_initial") == "true",
+			IsFinal:     c.PostForm("is_final") == "true",
+			PausesSLA:   c.PostForm("pauses_sla") == "true",
+			Transitions: []string{},
+		}
+		for _, to := range c.PostFormArray("transitions") {
+			if _, ok := statuses.find(to); ok {
+				status.Transitions = append(status.Transitions, to)
+			}
+		}
+
+		if status.IsInitial {
+			for i := range statuses {
+				statuses[i].IsInitial = false
+			}
+		}
+		return append(statuses, status), "", nil
+	})
+}
+
+// UpdateJobStatus changes the label, flags and allowed transitions of a
+// status. The name is kept, since jobs store it, and the jobs in the status
+// follow its new flags.
+func UpdateJobStatus(c *gin.Context) {
+	id := c.Param("id")
+	name := c.Param("statusName")
+	label := c.PostForm("label")
+
+	if label == "" {
+		renderJobStatusError(c, "Error: Label cannot be empty.")
+		return
+	}
+
+	changeJobStatuses(c, "Update Job Status", func(ctx context.Context, tx pgx.Tx, statuses JobStatusDefList) (JobStatusDefList, string, error) {
+		index := slices.IndexFunc(statuses, func(s JobStatusDef) bool { return s.Name == name })
+		if index < 0 {
+			return nil, fmt.Sprintf("Error: Status '%s' not found.", name), nil
+		}
+
+		transitions := []string{}
+		for _, to := range c.PostFormArray("transitions") {
+			if _, ok := statuses.find(to); ok && to != name {
+				transitions = append(transitions, to)
+			}
+		}
+
+		isInitial := c.PostForm("is_initial") == "true"
+		if isInitial {
+			for i := range statuses {
+				statuses[i].IsInitial = false
+			}
+		}
+		stoppedSLA, wasFinal := statuses.stopsSLA(name), statuses[index].IsFinal
+		statuses[index].Label = label
+		statuses[index].IsInitial = isInitial
+		statuses[index].IsFinal = c.PostForm("is_final") == "true"
+		statuses[index].PausesSLA = c.PostForm("pauses_sla") == "true"
+		statuses[index].Transitions = transitions
+
+		// Jobs already in the status stop or restart their clocks and are
+		// resolved or reopened with it.
+		if statuses.stopsSLA(name) != stoppedSLA || statuses[index].IsFinal != wasFinal {
+			args := sqlArgs{id, name}
+			query := `UPDATE jobs SET` + statuses.slaAssignments(&args, name) + `
+			WHERE job_type_id = $1 AND status = $2`
+			if _, err := tx.Exec(ctx, query, args...); err != nil {
+				return nil, "", err
+			}
+		}
+		return statuses, "", nil
+	})
+}
+
+// DeleteJobStatus removes a status that no job is in, along with every
+// transition into it. Jobs moving into the status wait for the workflow lock,
+// so none can slip in between the check and the delete.
+func DeleteJobStatus(c *gin.Context) {
+	id := c.Param("id")
+	name := c.Param("statusName")
+
+	changeJobStatuses(c, "Delete Job Status", func(ctx context.Context, tx pgx.Tx, statuses JobStatusDefList) (JobStatusDefList, string, error) {
+		if _, ok := statuses.find(name); !ok {
+			return nil, fmt.Sprintf("Error: Status '%s' not found.", name), nil
+		}
+
+		if len(statuses) == 1 {
+			return nil, "Error: A job type needs at least one status.", nil
+		}
+
+		var inUse bool
+		query := `SELECT EXISTS (SELECT 1 FROM jobs WHERE job_type_id = $1 AND status = $2)`
+		if err := tx.QueryRow(ctx, query, id, name).Scan(&inUse); err != nil {
+			return nil, "", err
+		}
+		if inUse {
+			return nil, fmt.Sprintf("Error: Jobs are still in status '%s'. Move them first.", statuses.label(name)), nil
+		}
+
+		statuses = slices.DeleteFunc(statuses, func(s JobStatusDef) bool { return s.Name == name })
+		for i := range statuses {
+			statuses[i].Transitions = slices.DeleteFunc(statuses[i].Transitions, func(to string) bool { return to == name })
+		}
+		return statuses, "", nil
+	})
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJobStatusSLAAssignments(t *testing.T) {
+	statuses := JobStatusDefList{
+		{Name: "open", IsInitial: true},
+		{Name: "waiting", PausesSLA: true},
+		{Name: "done", IsFinal: true},
+	}
+
+	tests := []struct {
+		status    string
+		wantPause bool
+		wantFinal bool
+	}{
+		{"open", false, false},
+		{"waiting", true, false},
+		{"done", true, true},
+		{"gone", false, false},
+	}
+
+	for _, tt := range tests {
+		args := sqlArgs{"1", "open"}
+		set := statuses.slaAssignments(&args, tt.status)
+
+		for _, column := range []string{"sla_paused_seconds =", "sla_paused_at = CASE WHEN $3::boolean", "resolved_at = CASE WHEN $4::boolean"} {
+			if !strings.Contains(set, column) {
+				t.Errorf("%s: slaAssignments = %q, missing %q", tt.status, set, column)
+			}
+		}
+		if want := []any{"1", "open", tt.wantPause, tt.wantFinal}; !reflect.DeepEqual([]any(args), want) {
+			t.Errorf("%s: slaAssignments args = %v, want %v", tt.status, args, want)
+		}
+	}
+}
@@ -153,9 +153,9 @@ func JobTypeEditForm(c *gin.Context) {
 }
 
 func (j *jobType) findJobTypeByID(c *gin.Context, id string) error {
-	query := `SELECT id, name, description, created_at FROM job_types WHERE id = $1`
+	query := `SELECT id, name, description, restricted, created_at FROM job_types WHERE id = $1`
 
-	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&j.ID, &j.Name, &j.Description, &j.CreatedAt)
+	err := conn.QueryRow(c.Request.Context(), query, id).Scan(&j.ID, &j.Name, &j.Description, &j.Restricted, &j.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
@@ -163,38 +163,32 @@ func (j *jobType) findJobTypeByID(c *gin.Context, id string) error {
 	return nil
 }
 
-func JobTypeList(c *gin.Context) {
-	query := "SELECT id, name, description, created_at FROM job_types"
+func listJobTypes(c *gin.Context) ([]jobType, error) {
+	query := "SELECT id, name, description, restricted, created_at FROM job_types"
 
 	rows, err := conn.Query(c.Request.Context(), query)
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Job Type List [SQL]: Error while querying job_types table `%v`", err))
-		c.Header("HX-Retarget", "#add-form-feedback")
-		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
-			"Message": "An internal error occurred. Please try again.",
-		})
-
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var jobTypes []jobType
 	for rows.Next() {
 		var job jobType
-		if err := rows.Scan(&job.ID, &job.Name, &job.Description, &job.CreatedAt); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Job Type List [SQL]: Error while scanning row `%v`", err))
-			c.Header("HX-Retarget", "#add-form-feedback")
-			c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
-				"Message": "An internal error occurred. Please try again.",
-			})
-			return
+		if err := rows.Scan(&job.ID, &job.Name, &job.Description, &job.Restricted, &job.CreatedAt); err != nil {
+			return nil, err
 		}
 		jobTypes = append(jobTypes, job)
 
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Job Type List [SQL]: Error while iterating rows `%v`", err))
+	return jobTypes, rows.Err()
+}
+
+func JobTypeList(c *gin.Context) {
+	jobTypes, err := listJobTypes(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Type List [SQL]: Error while querying job_types table `%v`", err))
 		c.Header("HX-Retarget", "#add-form-feedback")
 		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
 			"Message": "An internal error occurred. Please try again.",
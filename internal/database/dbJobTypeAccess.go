@@ -0,0 +1,234 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type JobTypeMember struct {
+	ID        int
+	JobTypeID int
+	UserID    sql.NullInt64
+	RoleID    sql.NullInt64
+	Name      string
+	CanEdit   bool
+}
+
+func (m JobTypeMember) IsRole() bool {
+	return m.RoleID.Valid
+}
+
+func currentUserID(c *gin.Context) string {
+	id, _ := c.Get("userID")
+	userID, _ := id.(string)
+	return userID
+}
+
+// accessAllJobTypes reports whether the logged-in user sees every restricted
+// job type. It is the last argument of job_type_access, so an API token
+// without the scope does not get it from the role.
+func accessAllJobTypes(c *gin.Context) bool {
+	return HasPermission(c, "jobs.access.all")
+}
+
+// canAccessJobType reports whether the logged-in user may see (edit = false)
+// or change (edit = true) jobs of the job type. Access rules live in the
+// job_type_access SQL function so list queries can apply the same check.
+func canAccessJobType(c *gin.Context, jobTypeID string, edit bool) (bool, error) {
+	var allowed bool
+	query := `SELECT COALESCE(job_type_access($1, $2, $3, $4), false)`
+	err := conn.QueryRow(c.Request.Context(), query, jobTypeID, currentUserID(c), edit, accessAllJobTypes(c)).Scan(&allowed)
+	return allowed, err
+}
+
+// canAccessJob is canAccessJobType for the job type of an existing job. A
+// missing job is reported as not allowed.
+func canAccessJob(c *gin.Context, jobID string, edit bool) (bool, error) {
+	var allowed bool
+	query := `SELECT COALESCE(job_type_access(job_type_id, $2, $3, $4), false) FROM jobs WHERE id = $1`
+	err := conn.QueryRow(c.Request.Context(), query, jobID, currentUserID(c), edit, accessAllJobTypes(c)).Scan(&allowed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return allowed, err
+}
+
+func listJobTypeMembers(c *gin.Context, jobTypeID string) ([]JobTypeMember, error) {
+	query := `
+	SELECT m.id, m.job_type_id, m.user_id, m.role_id, COALESCE(u.username, r.name), m.can_edit
+	FROM job_type_members m
+	LEFT JOIN users u ON u.id = m.user_id
+	LEFT JOIN roles r ON r.id = m.role_id
+	WHERE m.job_type_id = $1
+	ORDER BY m.role_id IS NULL, COALESCE(u.username, r.name)`
+
+	rows, err := conn.Query(c.Request.Context(), query, jobTypeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []JobTypeMember
+	for rows.Next() {
+		var m JobTypeMember
+		if err := rows.Scan(&m.ID, &m.JobTypeID, &m.UserID, &m.RoleID, &m.Name, &m.CanEdit); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+func JobTypeAccessModal(c *gin.Context) {
+	id := c.Param("id")
+
+	var jt jobType
+	if err := jt.findJobTypeByID(c, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Type Access Modal: Job type {ID: %s} not found `%v`", id, err))
+		c.String(http.StatusNotFound, "Job Type not found")
+		return
+	}
+
+	members, err := listJobTypeMembers(c, id)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Type Access Modal [SQL]: Error while querying members `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	roles, err := listRoles(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Type Access Modal [SQL]: Error while querying roles `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobTypeAccessModal.html", gin.H{
+		"JobType": jt,
+		"Members": members,
+		"Roles":   roles,
+	})
+}
+
+func SetJobTypeRestricted(c *gin.Context) {
+	id := c.Param("id")
+	restricted := c.PostForm("restricted") == "true"
+
+	query := `UPDATE job_types SET restricted = $2 WHERE id = $1`
+	cmdTag, err := conn.Exec(c.Request.Context(), query, id, restricted)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Set Job Type Restricted [SQL]: Error while updating job_types table `%v`", err))
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Cannot save changes.",
+		})
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Job type not found.",
+		})
+		return
+	}
+
+	message := "Everyone can see and edit jobs of this type."
+	if restricted {
+		message = "Only members can see and edit jobs of this type."
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="success">`+message+`</div>`))
+}
+
+func AddJobTypeMember(c *gin.Context) {
+	jobTypeID := c.Param("id")
+	memberType := c.PostForm("member_type")
+	canEdit := c.PostForm("can_edit") == "true"
+
+	renderError := func(message string) {
+		c.Header("HX-Retarget", "#access-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	var query string
+	var member string
+	switch memberType {
+	case "user":
+		member = c.PostForm("username")
+		query = `
+		INSERT INTO job_type_members (job_type_id, user_id, can_edit)
+		SELECT $1, id, $3 FROM users WHERE username = $2
+		ON CONFLICT (job_type_id, user_id) DO UPDATE SET can_edit = EXCLUDED.can_edit
+		RETURNING id`
+	case "role":
+		member = c.PostForm("role_id")
+		query = `
+		INSERT INTO job_type_members (job_type_id, role_id, can_edit)
+		SELECT $1, id, $3 FROM roles WHERE id = $2::int
+		ON CONFLICT (job_type_id, role_id) DO UPDATE SET can_edit = EXCLUDED.can_edit
+		RETURNING id`
+	default:
+		renderError("Error: Choose a user or a role.")
+		return
+	}
+
+	if member == "" {
+		renderError("Error: Choose a user or a role.")
+		return
+	}
+
+	var memberID int
+	err := conn.QueryRow(c.Request.Context(), query, jobTypeID, member, canEdit).Scan(&memberID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			logger.LogToLogFile(c, fmt.Sprintf("Add Job Type Member: %s `%s` not found", memberType, member))
+			renderError("Error: User or role not found.")
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Type Member [SQL]: Error while inserting into job_type_members `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	members, err := listJobTypeMembers(c, jobTypeID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add Job Type Member [SQL]: Error while querying members `%v`", err))
+		renderError("An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobTypeMembers.html", gin.H{
+		"Members": members,
+	})
+}
+
+func DeleteJobTypeMember(c *gin.Context) {
+	jobTypeID := c.Param("id")
+	memberID, err := strconv.Atoi(c.Param("memberId"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid member ID")
+		return
+	}
+
+	query := `DELETE FROM job_type_members WHERE id = $1 AND job_type_id = $2`
+	if _, err := conn.Exec(c.Request.Context(), query, memberID, jobTypeID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job Type Member [SQL]: Error while deleting from job_type_members `%v`", err))
+		c.Header("HX-Retarget", "#access-feedback")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: An internal error occurred. Please try again.",
+		})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// SavedJobView is a named set of filters and sort of a job list. Shared views
+// are listed for everyone who sees that list.
+type SavedJobView struct {
+	ID        int
+	OwnerName string
+	JobTypeID *int // nil for My Jobs
+	Name      string
+	Query     string
+	IsShared  bool
+
+	// IsOwn is whether the logged-in user saved the view and may change it.
+	IsOwn bool
+}
+
+// URL opens the job list page with the view's filters.
+func (v SavedJobView) URL() string {
+	page := "/jobs/mine"
+	if v.JobTypeID != nil {
+		page = fmt.Sprintf("/jobs/type/%d", *v.JobTypeID)
+	}
+	if v.Query == "" {
+		return page
+	}
+	return page + "?" + v.Query
+}
+
+// JobFilterForm is the filter bar of a job list page, filled in from the
+// page's query string so saved views open the way they were saved.
+type JobFilterForm struct {
+	JobTypeID  string
+	Statuses   []CustomFieldChoice
+	Priorities []CustomFieldChoice
+	Overdue    bool
+	Assignee   *ReferencePicker // nil when the list belongs to one assignee
+	Contact    ReferencePicker
+
+	CreatedFrom, CreatedTo string
+	UpdatedFrom, UpdatedTo string
+
+	Fields     []JobFieldFilterInput
+	Sorts      []CustomFieldChoice
+	Descending bool
+}
+
+// JobFieldFilterInput is the filter of one custom field: a value, or a
+// range for numbers, amounts and dates.
+type JobFieldFilterInput struct {
+	CustomFieldInput
+	Ranged   bool
+	From, To string
+}
+
+// markSelected marks the choices whose value is among values.
+func markSelected(choices []CustomFieldChoice, values []string) []CustomFieldChoice {
+	for i := range choices {
+		choices[i].Selected = slices.Contains(values, choices[i].Value)
+	}
+	return choices
+}
+
+// newJobFilterForm prepares the filter bar of the list filter starts from;
+// defs are the custom fields of its job type.
+func newJobFilterForm(c *gin.Context, filter jobFilter, defs CustomFieldDefList) JobFilterForm {
+	query := c.Request.URL.Query()
+	form := JobFilterForm{
+		JobTypeID:   filter.JobTypeID,
+		Statuses:    markSelected(jobStatusChoices(c, filter), query["status"]),
+		Priorities:  jobPriorityChoices(query["priority"]...),
+		Overdue:     query.Get("overdue") == "true",
+		Contact:     newReferencePicker("filter_contact", "contact", "contact", "Any", markSelected(referenceChoicesByID(c, "contact", query["contact"]), query["contact"])),
+		CreatedFrom: query.Get("created_from"),
+		CreatedTo:   query.Get("created_to"),
+		UpdatedFrom: query.Get("updated_from"),
+		UpdatedTo:   query.Get("updated_to"),
+		Descending:  query.Get("dir") == "desc",
+	}
+	if filter.AssignedUserID == "" {
+		unassigned := CustomFieldChoice{Value: "none", Label: "Unassigned"}
+		assignees := append([]CustomFieldChoice{unassigned}, referenceChoicesByID(c, "user", query["assignee"])...)
+		picker := newReferencePicker("filter_assignee", "assignee", "user", "Anyone", markSelected(assignees, query["assignee"]))
+		picker.Other = &unassigned
+		form.Assignee = &picker
+	}
+
+	var filterable CustomFieldDefList
+	values := make(map[string]string)
+	for _, def := range defs {
+		if !def.filterable() {
+			continue
+		}
+		def.IsRequired = false
+		filterable = append(filterable, def)
+		values[def.FieldName] = strings.Join(query["cf["+def.FieldName+"]"], "\n")
+	}
+	for _, input := range filterable.inputs(c, values, nil) {
+		form.Fields = append(form.Fields, JobFieldFilterInput{
+			CustomFieldInput: input,
+			Ranged:           input.ranged(),
+			From:             query.Get("cf_from[" + input.FieldName + "]"),
+			To:               query.Get("cf_to[" + input.FieldName + "]"),
+		})
+	}
+
+	for _, sort := range jobSorts {
+		form.Sorts = append(form.Sorts, CustomFieldChoice{Value: sort.Name, Label: sort.Label})
+	}
+	for _, def := range defs {
+		if def.sortable() {
+			form.Sorts = append(form.Sorts, CustomFieldChoice{Value: "cf." + def.FieldName, Label: def.FieldLabel})
+		}
+	}
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = "id"
+	}
+	form.Sorts = markSelected(form.Sorts, []string{sort})
+
+	return form
+}
+
+// jobStatusChoices lists the statuses of the job type of the list, or the
+// statuses the user's own jobs are in when the list spans job types.
+func jobStatusChoices(c *gin.Context, filter jobFilter) []CustomFieldChoice {
+	var choices []CustomFieldChoice
+	if filter.JobTypeID != "" {
+		statuses, err := fetchJobStatuses(c, filter.JobTypeID)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Job Filters [SQL]: Error while fetching statuses of job type %s `%v`", filter.JobTypeID, err))
+			return nil
+		}
+		for _, s := range statuses {
+			choices = append(choices, CustomFieldChoice{Value: s.Name, Label: statuses.label(s.Name)})
+		}
+		return choices
+	}
+
+	query := `SELECT DISTINCT status FROM jobs WHERE assigned_to_user_id = $1 ORDER BY status`
+	rows, err := conn.Query(c.Request.Context(), query, filter.AssignedUserID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Filters [SQL]: Error while fetching statuses `%v`", err))
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Job Filters [SQL]: Error while scanning statuses `%v`", err))
+			return nil
+		}
+		choices = append(choices, CustomFieldChoice{Value: status, Label: status})
+	}
+	return choices
+}
+
+// listSavedJobViews returns the user's own views of a job list and the ones
+// others shared. An empty jobTypeID is My Jobs.
+func listSavedJobViews(c *gin.Context, jobTypeID string) ([]SavedJobView, error) {
+	query := `
+	SELECT v.id, u.username, v.job_type_id, v.name, v.query, v.is_shared, v.user_id = $1::int
+	FROM saved_job_views v
+	JOIN users u ON u.id = v.user_id
+	WHERE (v.user_id = $1::int OR v.is_shared)
+	    AND v.job_type_id IS NOT DISTINCT FROM $2::int
+	ORDER BY v.name, v.id`
+
+	rows, err := conn.Query(c.Request.Context(), query, currentUserID(c), nullIfEmpty(jobTypeID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []SavedJobView
+	for rows.Next() {
+		var v SavedJobView
+		if err := rows.Scan(&v.ID, &v.OwnerName, &v.JobTypeID, &v.Name, &v.Query, &v.IsShared, &v.IsOwn); err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// savedJobViewList is listSavedJobViews for the list pages, which still show
+// when the views cannot be read.
+func savedJobViewList(c *gin.Context, jobTypeID string) []SavedJobView {
+	views, err := listSavedJobViews(c, jobTypeID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Saved Job Views [SQL]: Error while querying saved_job_views table `%v`", err))
+	}
+	return views
+}
+
+func renderSavedJobViews(c *gin.Context, jobTypeID string) {
+	views, err := listSavedJobViews(c, jobTypeID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Saved Job Views [SQL]: Error while querying saved_job_views table `%v`", err))
+		renderJobListError(c, "An internal error occurred while reading the saved views. Please reload the page.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "savedJobViews.html", gin.H{
+		"SavedViews": views,
+	})
+}
+
+// SaveJobView saves the filters and sort of a job list form under a name,
+// for the user alone or shared with everyone who sees the list.
+func SaveJobView(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("view_name"))
+	jobTypeID := c.PostForm("job_type_id")
+	isShared := c.PostForm("is_shared") != ""
+
+	if name == "" || len(name) > 100 {
+		renderJobListError(c, "Give the view a name of at most 100 characters.")
+		return
+	}
+
+	filter := jobFilter{JobTypeID: jobTypeID}
+	var customFieldDefs CustomFieldDefList
+	if jobTypeID == "" {
+		filter.AssignedUserID = currentUserID(c)
+	} else {
+		canView, err := canAccessJobType(c, jobTypeID, false)
+		if err != nil || !canView {
+			logger.LogToLogFile(c, fmt.Sprintf("Save Job View: User %s cannot view job type {ID: %s} `%v`", currentUserID(c), jobTypeID, err))
+			renderJobListError(c, "Job type not found.")
+			return
+		}
+		customFieldDefs.fetchCurrentCustomFields(c, jobTypeID)
+	}
+
+	query := savedQuery(c.Request.PostForm)
+	if msg := filter.parse(query, customFieldDefs); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Save Job View: Invalid filters `%s`", msg))
+		renderJobListError(c, msg)
+		return
+	}
+
+	insertQuery := `INSERT INTO saved_job_views (user_id, job_type_id, name, query, is_shared) VALUES ($1, $2, $3, $4, $5)`
+	_, err := conn.Exec(c.Request.Context(), insertQuery, currentUserID(c), nullIfEmpty(jobTypeID), name, query.Encode(), isShared)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Save Job View [SQL]: Error while inserting into saved_job_views table `%v`", err))
+		renderJobListError(c, "An internal error occurred while saving the view. Please try again.")
+		return
+	}
+
+	renderSavedJobViews(c, jobTypeID)
+}
+
+// ShareJobView shares one of the user's views with everyone who sees its job
+// list, or takes it back.
+func ShareJobView(c *gin.Context) {
+	query := `
+	UPDATE saved_job_views SET is_shared = $3
+	WHERE id = $1 AND user_id = $2
+	RETURNING COALESCE(job_type_id::text, '')`
+
+	var jobTypeID string
+	err := conn.QueryRow(c.Request.Context(), query, c.Param("id"), currentUserID(c), c.PostForm("is_shared") != "").Scan(&jobTypeID)
+	if err != nil {
+		handleJobViewChangeError(c, "Share Job View", err)
+		return
+	}
+
+	renderSavedJobViews(c, jobTypeID)
+}
+
+// DeleteJobView deletes one of the user's views; views others shared stay.
+func DeleteJobView(c *gin.Context) {
+	query := `
+	DELETE FROM saved_job_views
+	WHERE id = $1 AND user_id = $2
+	RETURNING COALESCE(job_type_id::text, '')`
+
+	var jobTypeID string
+	err := conn.QueryRow(c.Request.Context(), query, c.Param("id"), currentUserID(c)).Scan(&jobTypeID)
+	if err != nil {
+		handleJobViewChangeError(c, "Delete Job View", err)
+		return
+	}
+
+	renderSavedJobViews(c, jobTypeID)
+}
+
+func handleJobViewChangeError(c *gin.Context, handler string, err error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		logger.LogToLogFile(c, fmt.Sprintf("%s: User %s does not own view %s", handler, currentUserID(c), c.Param("id")))
+		renderJobListError(c, "Only the user who saved a view can change it.")
+		return
+	}
+	logger.LogToLogFile(c, fmt.Sprintf("%s [SQL]: Error while updating saved_job_views table `%v`", handler, err))
+	renderJobListError(c, "An internal error occurred. Please try again.")
+}
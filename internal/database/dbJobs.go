@@ -5,34 +5,77 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 type JobUpdate struct {
-	ID           string
-	AuthorUserID int
-	AuthorName   string
-	CreatedAt    time.Time
+	ID           string    `json:"id"`
+	AuthorUserID int       `json:"author_user_id"`
+	AuthorName   string    `json:"author_name"`
+	CreatedAt    time.Time `json:"created_at"`
 
-	Content map[string]any
+	Content map[string]any `json:"content"`
 }
 
 type Job struct {
-	ID        int
-	Status    string
-	Ticket    string
-	Title     string
-	JobTypeID int
+	ID        int    `json:"id"`
+	Status    string `json:"status"`
+	Ticket    string `json:"ticket_id"`
+	Title     string `json:"title"`
+	JobTypeID int    `json:"job_type_id"`
 
-	CustomFields map[string]any
-	LastUpdate   *JobUpdate
+	AssignedUserID   *int   `json:"assigned_to_user_id"`
+	AssignedUserName string `json:"assigned_user_name"`
+
+	Priority string  `json:"priority"`
+	DueDate  *string `json:"due_date"`
+	// Overdue is what the job missed: resolution, response or due_date.
+	Overdue string `json:"overdue,omitempty"`
+
+	CustomFields map[string]any `json:"custom_fields,omitempty"`
+	LastUpdate   *JobUpdate     `json:"last_update,omitempty"`
+
+	// CanEdit is whether the logged-in user may change the job.
+	CanEdit bool `json:"-"`
+
+	// sortKey is where the next page starts when this job ends a page.
+	sortKey jobCursor
+}
+
+type JobDetail struct {
+	ID               int            `json:"id"`
+	Title            string         `json:"title"`
+	Status           string         `json:"status"`
+	Ticket           string         `json:"ticket_id"`
+	JobTypeID        int            `json:"job_type_id"`
+	JobTypeName      string         `json:"job_type_name"`
+	ContactName      string         `json:"contact_name"`
+	AssignedUserID   *int           `json:"assigned_to_user_id"`
+	AssignedUserName string         `json:"assigned_user_name"`
+	Priority         string         `json:"priority"`
+	DueDate          *string        `json:"due_date"`
+	Overdue          string         `json:"overdue,omitempty"`
+	Contacts         []JobContact   `json:"contacts"`
+	CustomFields     map[string]any `json:"custom_fields"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+
+	// The SLA targets of the job's priority and when they were met; targets
+	// the job type does not set are nil.
+	ResponseDue   *time.Time `json:"response_due"`
+	ResolutionDue *time.Time `json:"resolution_due"`
+	RespondedAt   *time.Time `json:"responded_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
 }
 
 type PaginationUpdates struct {
@@ -50,14 +93,44 @@ func Jobs(c *gin.Context) {
 		return
 	}
 
+	canView, err := canAccessJobType(c, jobTypeId, false)
+	if err != nil || !canView {
+		logger.LogToLogFile(c, fmt.Sprintf("Jobs: User %s cannot view job type {ID: %s} `%v`", currentUserID(c), jobTypeId, err))
+		c.String(http.StatusNotFound, "Job type not found")
+		return
+	}
+
+	canEdit, err := canAccessJobType(c, jobTypeId, true)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Jobs [SQL]: Error while checking edit access to job type {ID: %s} `%v`", jobTypeId, err))
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeId)
+
 	c.HTML(http.StatusOK, "jobList.html", gin.H{
 		"JobTypeName": jobTypeName,
 		"JobTypeId":   jobTypeId,
+		"ListURL":     "/api/jobs/" + jobTypeId,
+		"CanEdit":     canEdit,
+		"Filters":     newJobFilterForm(c, jobFilter{JobTypeID: jobTypeId}, customFieldDefs),
+		"SavedViews":  savedJobViewList(c, jobTypeId),
 	})
 }
 
 func NewJobModal(c *gin.Context) {
 	jobTypeId := c.Param("id")
+
+	canEdit, err := canAccessJobType(c, jobTypeId, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("New Job Modal: User %s cannot create jobs of job type {ID: %s} `%v`", currentUserID(c), jobTypeId, err))
+		c.Header("HX-Retarget", "#modal-placeholder")
+		c.HTML(http.StatusOK, "addJobModal.html", gin.H{
+			"Error": "You do not have permission to create jobs of this type.",
+		})
+		return
+	}
+
 	jobTypeName, err := getJobTypeName(c, jobTypeId)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("New Job Modal: Error while search for job type name {ID: %s} `%v`", jobTypeId, err))
@@ -72,20 +145,70 @@ func NewJobModal(c *gin.Context) {
 	customFields.fetchCurrentCustomFields(c, jobTypeId)
 
 	formData := gin.H{
-		"title":              "",
-		"primary_contact_id": "",
-		"custom_fields":      make(map[string]string),
+		"title":               "",
+		"primary_contact_id":  "",
+		"assigned_to_user_id": currentUserID(c),
+		"priority":            "normal",
+		"due_date":            "",
+		"custom_fields":       make(map[string]string),
 	}
 
 	c.HTML(http.StatusOK, "addJobModal.html", gin.H{
-		"JobTypeName":     jobTypeName,
-		"CustomFieldDefs": customFields,
-		"FormData":        formData,
-		"JobTypeId":       jobTypeId,
+		"JobTypeName":          jobTypeName,
+		"CustomFieldInputs":    customFields.inputs(c, nil, nil),
+		"FormData":             formData,
+		"Priorities":           jobPriorityChoices("normal"),
+		"SelectedAssigneeName": c.GetString("username"),
+		"JobTypeId":            jobTypeId,
 	})
 
 }
 
+// pickerNames looks up the names shown next to the contact and assignee
+// pickers when a job form is rendered again. Unknown IDs give empty names.
+func pickerNames(c *gin.Context, contactID, assigneeID string) (string, string) {
+	var contactName, assigneeName string
+	query := `
+	SELECT
+	    COALESCE((SELECT name FROM contacts WHERE id = NULLIF($1, '')::int), ''),
+	    COALESCE((SELECT username FROM users WHERE id = NULLIF($2, '')::int), '')`
+	if err := conn.QueryRow(c.Request.Context(), query, contactID, assigneeID).Scan(&contactName, &assigneeName); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Picker Names [SQL]: Error while querying contact %q and user %q `%v`", contactID, assigneeID, err))
+	}
+	return contactName, assigneeName
+}
+
+// renderAddJobForm shows the add job modal again with what was submitted and
+// what is wrong with each custom field.
+func renderAddJobForm(c *gin.Context, jobTypeId, assigneeID string, customFieldDefs CustomFieldDefList, submittedFields, fieldErrors map[string]string) {
+	jobTypeName, err := getJobTypeName(c, jobTypeId)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add New Job: Error while search for job type name {ID: %s} `%v`", jobTypeId, err))
+	}
+
+	contactID := c.PostForm("primary_contact_id")
+	contactName, assigneeName := pickerNames(c, contactID, assigneeID)
+
+	c.Header("HX-Retarget", "#modal-placeholder")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "addJobModal.html", gin.H{
+		"JobTypeName":       jobTypeName,
+		"JobTypeId":         jobTypeId,
+		"CustomFieldInputs": customFieldDefs.inputs(c, submittedFields, fieldErrors),
+		"FormData": gin.H{
+			"title":               c.PostForm("title"),
+			"primary_contact_id":  contactID,
+			"assigned_to_user_id": assigneeID,
+			"priority":            c.PostForm("priority"),
+			"due_date":            c.PostForm("due_date"),
+		},
+		"Priorities":           jobPriorityChoices(c.PostForm("priority")),
+		"SelectedContactName":  contactName,
+		"SelectedAssigneeName": assigneeName,
+		"Error":                customFieldDefs.errorMessage(fieldErrors),
+	})
+}
+
 func AddNewJob(c *gin.Context) {
 	var err error
 	var ticket string
@@ -100,11 +223,54 @@ func AddNewJob(c *gin.Context) {
 
 	}
 	jobTypeId := c.Param("jobTypeId")
+
+	canEdit, err := canAccessJobType(c, jobTypeId, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Add New Job: User %s cannot create jobs of job type {ID: %s} `%v`", loggedInUserID, jobTypeId, err))
+		c.HTML(http.StatusOK, "addJobModal.html", gin.H{
+			"Error": "You do not have permission to create jobs of this type.",
+		})
+		return
+	}
+
 	title := c.PostForm("title")
 
 	contactID := c.PostForm("primary_contact_id")
 
-	customFields := c.PostFormMap("custom_fields")
+	priority, dueDate, _, msg := parseJobSchedule(c)
+	if msg != "" {
+		c.HTML(http.StatusOK, "addJobModal.html", gin.H{
+			"Error": msg,
+		})
+		return
+	}
+	if priority == "" {
+		priority = "normal"
+	}
+
+	// Jobs go to their creator unless the form picks someone else or nobody.
+	assigneeID, ok := c.GetPostForm("assigned_to_user_id")
+	if !ok {
+		assigneeID = loggedInUserID.(string)
+	}
+	if assigneeID != "" {
+		if _, err := findAssignee(c, jobTypeId, assigneeID); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Add New Job: Cannot assign job type {ID: %s} to user %s `%v`", jobTypeId, assigneeID, err))
+			c.HTML(http.StatusOK, "addJobModal.html", gin.H{
+				"Error": "The assigned user does not exist or cannot see jobs of this type.",
+			})
+			return
+		}
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeId)
+
+	submittedFields, customFields, fieldErrors := customFieldDefs.submit(c)
+	if len(fieldErrors) > 0 {
+		renderAddJobForm(c, jobTypeId, assigneeID, customFieldDefs, submittedFields, fieldErrors)
+		return
+	}
 
 	file, err := c.FormFile("thumbnail_image")
 
@@ -193,10 +359,23 @@ func AddNewJob(c *gin.Context) {
 		customFields["thumbnail_url"] = "/uploads/thumbnails/" + newFileName
 	}
 
-	query := `INSERT INTO jobs (ticket_id, title, job_type_id, primary_contact_id, assigned_to_user_id, custom_fields) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	statuses, err := fetchJobStatuses(c, jobTypeId)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Add New Job [SQL]: Error while querying status_workflow `%v`", err))
+		c.HTML(http.StatusOK, "addJobModal.html", gin.H{
+			"Error": "An internal server error occurred. Please try again.",
+		})
+		return
+	}
+
+	initialStatus := statuses.initial()
+	query := `
+	INSERT INTO jobs (ticket_id, title, job_type_id, primary_contact_id, assigned_to_user_id, custom_fields, status, priority, due_date, sla_paused_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CASE WHEN $10 THEN NOW() END)
+	RETURNING id`
 
 	var jobId string
-	err = conn.QueryRow(c.Request.Context(), query, ticket, title, jobTypeId, contactID, loggedInUserID, customFields).Scan(&jobId)
+	err = conn.QueryRow(c.Request.Context(), query, ticket, title, jobTypeId, contactID, nullIfEmpty(assigneeID), customFields, initialStatus, priority, nullIfEmpty(dueDate), statuses.stopsSLA(initialStatus)).Scan(&jobId)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("Add New Job [SQL]: Error while inserting into jobs table `%v`", err))
 		c.HTML(http.StatusOK, "addContactModal.html", gin.H{
@@ -256,8 +435,8 @@ func checkTicketExists(ctx *gin.Context, ticketID string) (bool, error) {
 
 func DeleteJob(c *gin.Context) {
 	jobID := c.Param("id")
-	var assignedToUserId string
-	query := `SELECT assigned_to_user_id FROM jobs WHERE id = $1`
+	var assignedToUserId sql.NullString
+	query := `SELECT assigned_to_user_id::text FROM jobs WHERE id = $1`
 	err := conn.QueryRow(c.Request.Context(), query, jobID).Scan(&assignedToUserId)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("Delete Job [SQL]: Error while getting assigned_to_user_id from jobs where id = %s `%v`", jobID, err))
@@ -282,19 +461,14 @@ func DeleteJob(c *gin.Context) {
 
 	}
 
-	loggedInUserRole, ok := c.Get("role")
-	if !ok {
-		logger.LogToLogFile(c, "Delete Job: Error to get user role")
-		c.Header("HX-Retarget", "#global-notification-placeholder")
-		c.Header("HX-Reswap", "innerHTML")
-		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
-			"Message": "An internal error occurred while creating the job. Please try again.",
-		})
-		return
-
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Job [SQL]: Error while checking job type access for job %s `%v`", jobID, err))
 	}
 
-	if loggedInUserID.(string) != assignedToUserId && loggedInUserRole != "admin" {
+	isAssignee := assignedToUserId.Valid && assignedToUserId.String == loggedInUserID.(string)
+	canDelete := HasPermission(c, "jobs.delete.any") || (isAssignee && HasPermission(c, "jobs.delete.own"))
+	if !canEdit || !canDelete {
 		logger.LogToLogFile(c, fmt.Sprintf("Delete Job: User %s do not have permission to delete this job", loggedInUserID))
 		c.Header("HX-Retarget", "#global-notification-placeholder")
 		c.Header("HX-Reswap", "innerHTML")
@@ -335,28 +509,119 @@ func JobsList(c *gin.Context) {
 		pagination.Limit = 10
 	}
 
-	query := `
-	    WITH latest_updates AS (
-	        SELECT
-	        ranked_updates.id,
-	            ranked_updates.author_user_id,
-	            ranked_updates.content,
-	            ranked_updates.created_at,
-	            ranked_updates.job_id,
-	            u.username AS author_name
-	        FROM (
-	            SELECT
-	                id, author_user_id, content, created_at, job_id,
-	                ROW_NUMBER() OVER(PARTITION BY job_id ORDER BY created_at DESC) as rn
-	            FROM
-	                job_updates
-	        ) ranked_updates
-	        LEFT JOIN users u ON ranked_updates.author_user_id = u.id
-	        WHERE
-	            ranked_updates.rn = 1
-	    )
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeId)
+
+	filter := jobFilter{JobTypeID: jobTypeId}
+	if msg := filter.parse(c.Request.URL.Query(), customFieldDefs); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Jobs List: Invalid filters `%s`", msg))
+		renderJobListError(c, msg)
+		return
+	}
+
+	jobs, err := listJobs(c, filter, pagination)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Jobs List [SQL]: Error while querying items `%v`", err))
+		c.String(http.StatusInternalServerError, "Error reading jobs list.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobCardFragment.html", gin.H{
+		"Jobs":    jobs,
+		"NextURL": nextJobListURL(c, "/api/jobs/"+jobTypeId, jobs),
+	})
+}
+
+// MyJobs is the job list page for the jobs assigned to the logged-in user,
+// across every job type they can see.
+func MyJobs(c *gin.Context) {
+	filter := jobFilter{AssignedUserID: currentUserID(c)}
+	c.HTML(http.StatusOK, "jobList.html", gin.H{
+		"JobTypeName": "My Jobs",
+		"ListURL":     "/api/jobs/mine",
+		"Filters":     newJobFilterForm(c, filter, nil),
+		"SavedViews":  savedJobViewList(c, ""),
+	})
+}
+
+func MyJobsList(c *gin.Context) {
+	var pagination Pagination
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("My Jobs List [Bind Query]: Error while binding query to pagination struct `%v`", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 10
+	}
+
+	filter := jobFilter{AssignedUserID: currentUserID(c)}
+	if msg := filter.parse(c.Request.URL.Query(), nil); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("My Jobs List: Invalid filters `%s`", msg))
+		renderJobListError(c, msg)
+		return
+	}
+
+	jobs, err := listJobs(c, filter, pagination)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("My Jobs List [SQL]: Error while querying items `%v`", err))
+		c.String(http.StatusInternalServerError, "Error reading jobs list.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "jobCardFragment.html", gin.H{
+		"Jobs":    jobs,
+		"NextURL": nextJobListURL(c, "/api/jobs/mine", jobs),
+	})
+}
+
+// renderJobListError shows a message above the job list, e.g. what is wrong
+// with its filters.
+func renderJobListError(c *gin.Context, message string) {
+	c.Header("HX-Retarget", "#global-notification-placeholder")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+		"Message": message,
+	})
+}
+
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// listJobs returns one page of the jobs matching filter that the logged-in
+// user can see, each with its latest update and whether the user may edit it.
+// Pages start at filter.Cursor, or past pagination.After when the list runs
+// by ID.
+func listJobs(c *gin.Context, filter jobFilter, pagination Pagination) ([]Job, error) {
+	args := sqlArgs{currentUserID(c), accessAllJobTypes(c)}
+	conditions := append([]string{"job_type_access(j.job_type_id, $1, false, $2)"}, filter.conditions(&args)...)
+
+	sortExpr, sortType, sortDefault := filter.sortKey(&args)
+	cursor := filter.Cursor
+	if cursor == nil && pagination.After > 0 && filter.sortName() == "id" {
+		cursor = &jobCursor{Sort: "id", Descending: filter.Descending, Value: strconv.Itoa(pagination.After), ID: pagination.After}
+	}
+	if cursor != nil {
+		conditions = append(conditions, filter.keyset(&args, *cursor, sortType))
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	query := fmt.Sprintf(`
 	    SELECT
-	        j.id, j.title, j.status, j.ticket_id, j.custom_fields, -- Campos da 'jobs'
+	        j.id, j.title, j.status, j.ticket_id, j.job_type_id, j.custom_fields,
+	        j.assigned_to_user_id, COALESCE(au.username, '') AS assigned_user_name,
+	        j.priority, j.due_date::text, COALESCE(job_overdue(j), '') AS overdue,
+	        job_type_access(j.job_type_id, $1, true, $2) AS can_edit,
+	        sk.is_null, sk.value::text,
 
 	        lu.id AS last_update_id,
 	        lu.author_user_id AS last_update_author_id,
@@ -366,21 +631,33 @@ func JobsList(c *gin.Context) {
 
 	    FROM
 	        jobs j
+	    CROSS JOIN LATERAL (
+	        SELECT %[1]s IS NULL AS is_null, COALESCE(%[1]s, %[2]s) AS value
+	    ) sk
 	    LEFT JOIN
-	        latest_updates lu ON j.id = lu.job_id
+	        users au ON au.id = j.assigned_to_user_id
+	    LEFT JOIN LATERAL (
+	        SELECT ju.id, ju.author_user_id, ju.content, ju.created_at,
+	            CASE WHEN ju.author_user_id IS NULL THEN 'Momentum' ELSE u.username END AS author_name
+	        FROM job_updates ju
+	        LEFT JOIN users u ON ju.author_user_id = u.id
+	        WHERE ju.job_id = j.id
+	        ORDER BY ju.created_at DESC
+	        LIMIT 1
+	    ) lu ON true
 	    WHERE
-	        j.id > $1 AND j.job_type_id = $2
+	        %[3]s
 	    ORDER BY
-	        j.id ASC
-	    LIMIT $3;`
+	        sk.is_null ASC, sk.value %[4]s, j.id %[4]s
+	    LIMIT %[5]s;`, sortExpr, sortDefault, strings.Join(conditions, "\n\t        AND "), direction, args.add(pagination.Limit))
 
-	rows, err := conn.Query(c.Request.Context(), query, pagination.After, jobTypeId, pagination.Limit)
+	rows, err := conn.Query(c.Request.Context(), query, args...)
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Jobs List [SQL]: Error while querying items `%v`", err))
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
+	sortName := filter.sortName()
 	var jobs []Job
 	for rows.Next() {
 		var job Job
@@ -390,10 +667,12 @@ func JobsList(c *gin.Context) {
 		var lastUpdateContent map[string]any
 		var lastUpdateCreatedAt sql.NullTime
 
-		if err := rows.Scan(&job.ID, &job.Title, &job.Status, &job.Ticket, &job.CustomFields, &lastUpdateID, &lastUpdateAuthorID, &lastUpdateContent, &lastUpdateCreatedAt, &lastUpdateAuthorName); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Jobs List [SQL]: Error while scanning row `%v`", err))
-			return
+		if err := rows.Scan(&job.ID, &job.Title, &job.Status, &job.Ticket, &job.JobTypeID, &job.CustomFields, &job.AssignedUserID, &job.AssignedUserName, &job.Priority, &job.DueDate, &job.Overdue, &job.CanEdit, &job.sortKey.Null, &job.sortKey.Value, &lastUpdateID, &lastUpdateAuthorID, &lastUpdateContent, &lastUpdateCreatedAt, &lastUpdateAuthorName); err != nil {
+			return nil, err
 		}
+		job.sortKey.Sort = sortName
+		job.sortKey.Descending = filter.Descending
+		job.sortKey.ID = job.ID
 
 		if lastUpdateID.Valid {
 			job.LastUpdate = &JobUpdate{
@@ -408,22 +687,7 @@ func JobsList(c *gin.Context) {
 		jobs = append(jobs, job)
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Jobs List [SQL]: Error while iterating rows `%v`", err))
-		c.String(http.StatusInternalServerError, "Error reading jobs list.")
-		return
-	}
-
-	var nextCursor int
-	if len(jobs) > 0 {
-		nextCursor = jobs[len(jobs)-1].ID
-	}
-
-	c.HTML(http.StatusOK, "jobCardFragment.html", gin.H{
-		"Jobs":       jobs,
-		"NextCursor": nextCursor,
-		"JobTypeId":  jobTypeId,
-	})
+	return jobs, rows.Err()
 }
 
 func generateTicketID() (string, error) {
@@ -446,18 +710,34 @@ func generateTicketID() (string, error) {
 	return ticketID, nil
 }
 
+// editJobSubmission is a rejected edit, shown again in the edit modal in place
+// of the stored job.
+type editJobSubmission struct {
+	FormData     gin.H
+	CustomFields map[string]string
+	FieldErrors  map[string]string
+	Error        string
+}
+
 func EditJobModal(c *gin.Context) {
-	jobID := c.Param("id")
+	renderEditJobModal(c, c.Param("id"), nil)
+}
+
+func renderEditJobModal(c *gin.Context, jobID string, submitted *editJobSubmission) {
 	var jobData struct {
-		ID                  int
-		Title               string
-		Status              string
-		Ticket              string
-		JobTypeID           string
-		JobTypeName         string
-		PrimaryContactID    sql.NullInt64
-		CustomFields        []byte
-		SelectedContactName sql.NullString
+		ID                   int
+		Title                string
+		Status               string
+		Ticket               string
+		JobTypeID            string
+		JobTypeName          string
+		PrimaryContactID     sql.NullInt64
+		AssignedUserID       sql.NullInt64
+		Priority             string
+		DueDate              sql.NullString
+		CustomFields         []byte
+		SelectedContactName  sql.NullString
+		SelectedAssigneeName sql.NullString
 	}
 
 	query := `
@@ -465,18 +745,24 @@ func EditJobModal(c *gin.Context) {
             j.id, j.title, j.status, j.ticket_id, j.job_type_id, 
             jt.name AS job_type_name, 
             j.primary_contact_id, 
+            j.assigned_to_user_id,
+            j.priority,
+            j.due_date::text,
             j.custom_fields, 
-            COALESCE(c.name, '') AS selected_contact_name
+            COALESCE(c.name, '') AS selected_contact_name,
+            u.username AS selected_assignee_name
         FROM 
             jobs j
         JOIN 
             job_types jt ON j.job_type_id = jt.id
         LEFT JOIN 
             contacts c ON j.primary_contact_id = c.id
+        LEFT JOIN 
+            users u ON j.assigned_to_user_id = u.id
         WHERE 
-            j.id = $1`
+            j.id = $1 AND job_type_access(j.job_type_id, $2, true, $3)`
 
-	err := conn.QueryRow(c.Request.Context(), query, jobID).Scan(
+	err := conn.QueryRow(c.Request.Context(), query, jobID, currentUserID(c), accessAllJobTypes(c)).Scan(
 		&jobData.ID,
 		&jobData.Title,
 		&jobData.Status,
@@ -484,8 +770,12 @@ func EditJobModal(c *gin.Context) {
 		&jobData.JobTypeID,
 		&jobData.JobTypeName,
 		&jobData.PrimaryContactID,
+		&jobData.AssignedUserID,
+		&jobData.Priority,
+		&jobData.DueDate,
 		&jobData.CustomFields,
 		&jobData.SelectedContactName,
+		&jobData.SelectedAssigneeName,
 	)
 
 	if err != nil {
@@ -497,6 +787,20 @@ func EditJobModal(c *gin.Context) {
 	var customFieldDefs CustomFieldDefList
 	customFieldDefs.fetchCurrentCustomFields(c, jobData.JobTypeID)
 
+	jobContacts, err := listJobContacts(c, jobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job Modal [SQL]: Error while querying job_contacts `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	statuses, err := fetchJobStatuses(c, jobData.JobTypeID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job Modal [SQL]: Error while querying status_workflow `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
 	var customFieldsMap map[string]any
 	if err := json.Unmarshal(jobData.CustomFields, &customFieldsMap); err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("Edit Job Modal [Unmarshal]: Error while unmarshaling custom fields `%v`", err))
@@ -504,11 +808,19 @@ func EditJobModal(c *gin.Context) {
 		return
 	}
 
+	var assignedToUserID string
+	if jobData.AssignedUserID.Valid {
+		assignedToUserID = fmt.Sprint(jobData.AssignedUserID.Int64)
+	}
+
 	formData := gin.H{
-		"title":              jobData.Title,
-		"primary_contact_id": jobData.PrimaryContactID.Int64,
-		"status":             jobData.Status,
-		"custom_fields":      customFieldsMap,
+		"title":               jobData.Title,
+		"primary_contact_id":  jobData.PrimaryContactID.Int64,
+		"assigned_to_user_id": assignedToUserID,
+		"status":              jobData.Status,
+		"priority":            jobData.Priority,
+		"due_date":            jobData.DueDate.String,
+		"custom_fields":       customFieldsMap,
 	}
 
 	jobPayload := gin.H{
@@ -519,13 +831,33 @@ func EditJobModal(c *gin.Context) {
 		"CustomFields": customFieldsMap,
 	}
 
-	c.HTML(http.StatusOK, "editJobModal.html", gin.H{
-		"Job":                 jobPayload,
-		"CustomFieldDefs":     customFieldDefs,
-		"FormData":            formData,
-		"SelectedContactName": jobData.SelectedContactName.String,
-		"Error":               nil,
-	})
+	data := gin.H{
+		"Job":                  jobPayload,
+		"CustomFieldInputs":    customFieldDefs.inputs(c, customFieldFormValues(customFieldsMap), nil),
+		"Statuses":             statuses.next(jobData.Status),
+		"Priorities":           jobPriorityChoices(jobData.Priority),
+		"FormData":             formData,
+		"SelectedContactName":  jobData.SelectedContactName.String,
+		"SelectedAssigneeName": jobData.SelectedAssigneeName.String,
+		"JobID":                jobData.ID,
+		"JobContacts":          jobContacts,
+		"JobContactRoles":      jobContactRoles,
+		"Error":                nil,
+	}
+
+	if submitted != nil {
+		for key, value := range submitted.FormData {
+			formData[key] = value
+		}
+		contactName, assigneeName := pickerNames(c, fmt.Sprint(formData["primary_contact_id"]), fmt.Sprint(formData["assigned_to_user_id"]))
+		data["SelectedContactName"] = contactName
+		data["SelectedAssigneeName"] = assigneeName
+		data["Priorities"] = jobPriorityChoices(fmt.Sprint(formData["priority"]))
+		data["CustomFieldInputs"] = customFieldDefs.inputs(c, submitted.CustomFields, submitted.FieldErrors)
+		data["Error"] = submitted.Error
+	}
+
+	c.HTML(http.StatusOK, "editJobModal.html", data)
 }
 
 func EditJob(c *gin.Context) {
@@ -540,13 +872,32 @@ func EditJob(c *gin.Context) {
 	}
 
 	jobID := c.Param("id")
+
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job: User %s cannot edit job %s `%v`", loggedInUserID, jobID, err))
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "You do not have permission to edit this job.",
+		})
+		return
+	}
+
 	jobTitle := c.PostForm("title")
 	jobStatus := c.PostForm("status")
 	jobThumbnail, err := c.FormFile("thumbnail_image")
 	primaryContactID := c.PostForm("primary_contact_id")
-	customFields := c.PostFormMap("custom_fields")
 	jobUpdateTitle := c.PostForm("update_title")
 	jobUpdateDescription := c.PostForm("update_description")
+	// A missing assignee keeps the current one, an empty one unassigns.
+	assigneeID, reassign := c.GetPostForm("assigned_to_user_id")
+	// So does a missing priority or due date; an empty due date clears it.
+	priority, dueDate, setDueDate, msg := parseJobSchedule(c)
+	if msg != "" {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": msg,
+		})
+		return
+	}
 
 	if jobTitle == "" || primaryContactID == "" || jobUpdateTitle == "" {
 		logger.LogToLogFile(c, "Edit Job: Error to get userID")
@@ -566,6 +917,79 @@ func EditJob(c *gin.Context) {
 		}
 	}
 
+	currentStatus, statuses, err := fetchJobStatusWorkflow(c, jobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while querying status_workflow `%v`", err))
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "An internal error occurred while editing the job. Please try again.",
+		})
+		return
+	}
+
+	if jobStatus == "" {
+		jobStatus = currentStatus
+	}
+
+	if msg := statuses.transitionError(currentStatus, jobStatus); msg != "" {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job: Job %s cannot move from `%s` to `%s`", jobID, currentStatus, jobStatus))
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": msg,
+		})
+		return
+	}
+
+	var jobTypeID string
+	if err := conn.QueryRow(c.Request.Context(), `SELECT job_type_id::text FROM jobs WHERE id = $1`, jobID).Scan(&jobTypeID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while querying job type of job %s `%v`", jobID, err))
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "An internal error occurred while editing the job. Please try again.",
+		})
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, jobTypeID)
+
+	submittedFields, customFields, fieldErrors := customFieldDefs.submit(c)
+	if len(fieldErrors) > 0 {
+		formData := gin.H{
+			"title":              jobTitle,
+			"status":             jobStatus,
+			"primary_contact_id": primaryContactID,
+			"update_title":       jobUpdateTitle,
+			"update_description": jobUpdateDescription,
+		}
+		if priority != "" {
+			formData["priority"] = priority
+		}
+		if setDueDate {
+			formData["due_date"] = dueDate
+		}
+		if reassign {
+			formData["assigned_to_user_id"] = assigneeID
+		}
+
+		c.Header("HX-Retarget", "#modal-placeholder")
+		c.Header("HX-Reswap", "innerHTML")
+		renderEditJobModal(c, jobID, &editJobSubmission{
+			FormData:     formData,
+			CustomFields: submittedFields,
+			FieldErrors:  fieldErrors,
+			Error:        customFieldDefs.errorMessage(fieldErrors),
+		})
+		return
+	}
+
+	if reassign && assigneeID != "" {
+		if _, err := findAssignee(c, jobTypeID, assigneeID); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Edit Job: Cannot assign job %s to user %s `%v`", jobID, assigneeID, err))
+			c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+				"Message": "The assigned user does not exist or cannot see jobs of this type.",
+			})
+			return
+		}
+	}
+
 	if jobThumbnail != nil {
 		var allowedImageTypes = map[string]bool{
 			".jpg":  true,
@@ -612,27 +1036,85 @@ func EditJob(c *gin.Context) {
 		return
 	}
 
+	renderInternalError := func() {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "An internal error occurred while editing the job. Please try again.",
+		})
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while starting transaction `%v`", err))
+		renderInternalError()
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	// The status check makes a concurrent status change fail this edit
+	// instead of silently skipping the workflow. The status itself moves
+	// below, the way the board moves it.
 	query := `
-	WITH updated_job AS (
-	        UPDATE jobs
-	        SET 
-	            title = $2,
-		    status = $3,
-	            primary_contact_id = $4,
-	            custom_fields = custom_fields || $5
-	        WHERE 
-	            id = $1
-	    )
-	    INSERT INTO job_updates (job_id, author_user_id, content)
-	    VALUES ($1, $6, $7); -- Inserção direta
-	`
+	UPDATE jobs j
+	SET
+	    title = $2,
+	    primary_contact_id = $3,
+	    custom_fields = (j.custom_fields - $8::text[]) || $4,
+	    assigned_to_user_id = CASE WHEN $6 THEN $7::int ELSE j.assigned_to_user_id END,
+	    priority = COALESCE($9, j.priority),
+	    due_date = CASE WHEN $10 THEN $11::date ELSE j.due_date END
+	FROM
+	    (SELECT id, assigned_to_user_id FROM jobs WHERE id = $1 FOR UPDATE) old
+	WHERE
+	    j.id = old.id AND j.status = $5
+	RETURNING old.assigned_to_user_id, j.assigned_to_user_id`
 
-	_, err = conn.Exec(c.Request.Context(), query, jobID, jobTitle, jobStatus, primaryContactID, customFields, loggedInUserID, jobUpdateContent)
+	var previousAssignee, newAssignee sql.NullInt64
+	err = tx.QueryRow(c.Request.Context(), query, jobID, jobTitle, primaryContactID, customFields, currentStatus, reassign, nullIfEmpty(assigneeID), customFieldDefs.names(), nullIfEmpty(priority), setDueDate, nullIfEmpty(dueDate)).Scan(&previousAssignee, &newAssignee)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+				"Message": "The job was changed by someone else. Reload it and try again.",
+			})
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while updating jobs table `%v`", err))
+		renderInternalError()
+		return
+	}
+
+	if previousAssignee != newAssignee {
+		if err := recordAssignmentChange(c, tx, jobID, fmt.Sprint(loggedInUserID), previousAssignee, newAssignee); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while recording reassignment `%v`", err))
+			renderInternalError()
+			return
+		}
+	}
+
+	if jobStatus != currentStatus {
+		if err := moveJobStatus(c, tx, jobID, fmt.Sprint(loggedInUserID), currentStatus, jobStatus, statuses); err != nil {
+			if errors.Is(err, errJobStatusWorkflowChanged) {
+				c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+					"Message": "The statuses of this job type were changed meanwhile. Reload the job and try again.",
+				})
+				return
+			}
+			logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while recording status change `%v`", err))
+			renderInternalError()
+			return
+		}
+	}
+
+	query = `INSERT INTO job_updates (job_id, author_user_id, content) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(c.Request.Context(), query, jobID, loggedInUserID, jobUpdateContent)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while inserting into job_updates `%v`", err))
-		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
-			"Message": "An internal error occurred while editing the job. Please try again.",
-		})
+		renderInternalError()
+		return
+	}
+
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Edit Job [SQL]: Error while committing transaction `%v`", err))
+		renderInternalError()
 		return
 	}
 
@@ -643,9 +1125,9 @@ func EditJob(c *gin.Context) {
 func NewJobUpdateModal(c *gin.Context) {
 	jobID := c.Param("id")
 	var job Job
-	query := `SELECT id, ticket_id, title FROM jobs WHERE id = $1;`
+	query := `SELECT id, ticket_id, title FROM jobs WHERE id = $1 AND job_type_access(job_type_id, $2, true, $3);`
 
-	err := conn.QueryRow(c.Request.Context(), query, jobID).Scan(&job.ID, &job.Ticket, &job.Title)
+	err := conn.QueryRow(c.Request.Context(), query, jobID, currentUserID(c), accessAllJobTypes(c)).Scan(&job.ID, &job.Ticket, &job.Title)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("New Job Update Modal [SQL]: Error while querying from jobs where id = %s `%v`", jobID, err))
 		c.String(http.StatusNotFound, "Job not found")
@@ -697,6 +1179,13 @@ func NewJobUpdate(c *gin.Context) {
 		return
 	}
 
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil || !canEdit {
+		logger.LogToLogFile(c, fmt.Sprintf("New Job Update: User %s cannot update job %s `%v`", loggedInUserID, jobID, err))
+		c.String(http.StatusNotFound, "Job not found.")
+		return
+	}
+
 	updateTitle := c.PostForm("update_title")
 	updateDescription := c.PostForm("update_description")
 
@@ -781,8 +1270,7 @@ func NewJobUpdate(c *gin.Context) {
 		return
 	}
 
-	jobUpdateQuery := `INSERT INTO job_updates (job_id, author_user_id, content) VALUES ($1, $2, $3)`
-	_, err = conn.Exec(c.Request.Context(), jobUpdateQuery, jobID, loggedInUserID, jobUpdateContent)
+	_, err = insertJobUpdate(c, jobID, loggedInUserID.(string), jobUpdateContent)
 	if err != nil {
 		logger.LogToLogFile(c, fmt.Sprintf("New Job Update [SQL]: Error while inserting into job_updates `%v`", err))
 		renderError("Failed to save the job update. Please try again.")
@@ -793,21 +1281,21 @@ func NewJobUpdate(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-func JobView(c *gin.Context) {
-	jobID := c.Param("id")
-	var jobData struct {
-		ID               int
-		Title            string
-		Status           string
-		Ticket           string
-		JobTypeName      string
-		ContactName      string
-		AssignedUserName string
-		CustomFields     map[string]any
-		CreatedAt        time.Time
-		UpdatedAt        time.Time
-	}
+func insertJobUpdate(c *gin.Context, jobID, authorUserID string, content []byte) (JobUpdate, error) {
+	var jobUpdate JobUpdate
+	query := `
+	INSERT INTO job_updates (job_id, author_user_id, content) VALUES ($1, $2, $3)
+	RETURNING id, author_user_id, created_at, content`
 
+	err := conn.QueryRow(c.Request.Context(), query, jobID, authorUserID, content).Scan(&jobUpdate.ID, &jobUpdate.AuthorUserID, &jobUpdate.CreatedAt, &jobUpdate.Content)
+	jobUpdate.AuthorName, _ = c.Value("username").(string)
+	return jobUpdate, err
+}
+
+// findJobDetail loads a job with its type, contacts and assignee name, as long
+// as the logged-in user can see its job type.
+func findJobDetail(c *gin.Context, jobID string) (JobDetail, error) {
+	var jobData JobDetail
 	query := `
 	SELECT
 	    j.id,
@@ -815,11 +1303,20 @@ func JobView(c *gin.Context) {
 	    j.ticket_id,
 	    j.status,
 	    j.custom_fields,
+	    j.job_type_id,
 	    jt.name AS job_type_name,
 	    COALESCE(c.name, '') AS contact_name,
+	    j.assigned_to_user_id,
 	    COALESCE(u.username, '') AS assigned_user_name,
+	    j.priority,
+	    j.due_date::text,
+	    COALESCE(job_overdue(j), '') AS overdue,
 	    j.created_at,
-	    j.updated_at
+	    j.updated_at,
+	    job_sla_due(j, sla.response_minutes) AS response_due,
+	    job_sla_due(j, sla.resolution_minutes) AS resolution_due,
+	    j.responded_at,
+	    j.resolved_at
 	FROM
 	    jobs j
 	JOIN
@@ -828,61 +1325,68 @@ func JobView(c *gin.Context) {
 	    contacts c ON j.primary_contact_id = c.id
 	LEFT JOIN
 	    users u ON j.assigned_to_user_id = u.id
+	LEFT JOIN
+	    job_type_slas sla ON sla.job_type_id = j.job_type_id AND sla.priority = j.priority
 	WHERE
-	    j.id = $1;
+	    j.id = $1 AND job_type_access(j.job_type_id, $2, false, $3);
 	`
 
-	err := conn.QueryRow(c.Request.Context(), query, jobID).Scan(&jobData.ID, &jobData.Title, &jobData.Ticket, &jobData.Status, &jobData.CustomFields, &jobData.JobTypeName, &jobData.ContactName, &jobData.AssignedUserName, &jobData.CreatedAt, &jobData.UpdatedAt)
+	err := conn.QueryRow(c.Request.Context(), query, jobID, currentUserID(c), accessAllJobTypes(c)).Scan(&jobData.ID, &jobData.Title, &jobData.Ticket, &jobData.Status, &jobData.CustomFields, &jobData.JobTypeID, &jobData.JobTypeName, &jobData.ContactName, &jobData.AssignedUserID, &jobData.AssignedUserName, &jobData.Priority, &jobData.DueDate, &jobData.Overdue, &jobData.CreatedAt, &jobData.UpdatedAt, &jobData.ResponseDue, &jobData.ResolutionDue, &jobData.RespondedAt, &jobData.ResolvedAt)
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Job View [SQL]: Error while querying `%v`", err))
-		c.String(http.StatusNotFound, "Job not found")
-		return
+		return jobData, err
 	}
 
-	c.HTML(http.StatusOK, "viewJob.html", gin.H{
-		"Job": jobData,
-	})
-
+	contacts, err := listJobContacts(c, jobID)
+	jobData.Contacts = emptyIfNil(contacts)
+	return jobData, err
 }
 
-func JobUpdateHistory(c *gin.Context) {
+func JobView(c *gin.Context) {
 	jobID := c.Param("id")
-	var pagination PaginationUpdates
-	if err := c.ShouldBindQuery(&pagination); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Job Update History [Bind Query]: Error while binding query to pagination struct `%v`", err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	jobData, err := findJobDetail(c, jobID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job View [SQL]: Error while querying `%v`", err))
+		c.String(http.StatusNotFound, "Job not found")
 		return
 	}
 
-	var beforeTimestamp time.Time
-	var err error
-	if pagination.Before == "" || pagination.Before == "now" {
-		beforeTimestamp = time.Now()
-	} else {
-		beforeTimestamp, err = time.Parse(time.RFC3339Nano, pagination.Before)
-		if err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Job Update History: Invalid `before` timestamp format `%s`", pagination.Before))
-			c.String(http.StatusBadRequest, "Invalid 'before' parameter format.")
-			return
-		}
+	canEdit, err := canAccessJob(c, jobID, true)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job View [SQL]: Error while checking edit access to job %s `%v`", jobID, err))
 	}
 
-	if pagination.Limit <= 0 || pagination.Limit > 50 {
-		pagination.Limit = 10
-	}
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchCurrentCustomFields(c, fmt.Sprint(jobData.JobTypeID))
+
+	c.HTML(http.StatusOK, "viewJob.html", gin.H{
+		"Job":          jobData,
+		"CustomFields": customFieldDefs.display(c, jobData.CustomFields),
+		"CanEdit":      canEdit,
+	})
+
+}
 
+// listJobUpdates returns the job's updates created before the cursor, newest
+// first, as long as the logged-in user can see its job type.
+func listJobUpdates(c *gin.Context, jobID string, before time.Time, limit int) ([]JobUpdate, error) {
 	query := `
 	SELECT
 	    ju.id,
-	    COALESCE(u.username, 'Unknown User') AS author_name, -- Return 'Unknown User' if user deleted
+	    COALESCE(ju.author_user_id, 0),
+	    -- Updates without an author are written by Momentum itself
+	    CASE WHEN ju.author_user_id IS NULL THEN 'Momentum' ELSE COALESCE(u.username, 'Unknown User') END AS author_name, -- Return 'Unknown User' if user deleted
 	    ju.created_at,
 	    ju.content
 	FROM
 	    job_updates ju
+	JOIN
+	    jobs j ON ju.job_id = j.id
 	LEFT JOIN
 	    users u ON ju.author_user_id = u.id
 	WHERE
 	    ju.job_id = $1 -- The specific job ID
+	    AND job_type_access(j.job_type_id, $4, false, $5)
 	    AND ju.created_at < $2 -- The 'before' cursor timestamp
 	ORDER BY
 	    ju.created_at DESC -- Newest updates first
@@ -890,29 +1394,49 @@ func JobUpdateHistory(c *gin.Context) {
 	    $3; -- The number of updates per page
 	`
 
-	rows, err := conn.Query(c.Request.Context(), query, jobID, beforeTimestamp, pagination.Limit)
+	rows, err := conn.Query(c.Request.Context(), query, jobID, before, limit, currentUserID(c), accessAllJobTypes(c))
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Job Update History [SQL]: Error while querying items `%v`", err))
-		c.String(http.StatusInternalServerError, "Error fetching updates.")
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var jobUpdates []JobUpdate
 	for rows.Next() {
 		var job JobUpdate
-		if err := rows.Scan(&job.ID, &job.AuthorName, &job.CreatedAt, &job.Content); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Job Update History [SQL]: Error while scanning row `%v`", err))
-			c.String(http.StatusInternalServerError, "Error processing updates.")
-			return
+		if err := rows.Scan(&job.ID, &job.AuthorUserID, &job.AuthorName, &job.CreatedAt, &job.Content); err != nil {
+			return nil, err
 		}
 
 		jobUpdates = append(jobUpdates, job)
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Job Update History [SQL]: Error while iterating rows `%v`", err))
-		c.String(http.StatusInternalServerError, "Error reading updates list.")
+	return jobUpdates, rows.Err()
+}
+
+func JobUpdateHistory(c *gin.Context) {
+	jobID := c.Param("id")
+	var pagination PaginationUpdates
+	if err := c.ShouldBindQuery(&pagination); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Update History [Bind Query]: Error while binding query to pagination struct `%v`", err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	beforeTimestamp, err := parseBeforeCursor(pagination.Before)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Update History: Invalid `before` timestamp format `%s`", pagination.Before))
+		c.String(http.StatusBadRequest, "Invalid 'before' parameter format.")
+		return
+	}
+
+	if pagination.Limit <= 0 || pagination.Limit > 50 {
+		pagination.Limit = 10
+	}
+
+	jobUpdates, err := listJobUpdates(c, jobID, beforeTimestamp, pagination.Limit)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Job Update History [SQL]: Error while querying items `%v`", err))
+		c.String(http.StatusInternalServerError, "Error fetching updates.")
 		return
 	}
 
@@ -930,42 +1454,38 @@ func JobUpdateHistory(c *gin.Context) {
 
 }
 
-func SearchJobFinances(c *gin.Context) {
-	jobQuery := c.Query("q_job")
-	if jobQuery == "" {
-		return
-	}
-
+// searchJobs matches jobs the logged-in user can see by title or ticket.
+func searchJobs(c *gin.Context, jobQuery string) ([]Job, error) {
 	searchValue := "%" + jobQuery + "%"
-	query := `SELECT id, title, ticket_id FROM jobs WHERE title ILIKE $1 OR ticket_id ILIKE $1 ORDER BY title LIMIT 10;`
+	query := `SELECT id, title, ticket_id, status, job_type_id FROM jobs WHERE (title ILIKE $1 OR ticket_id ILIKE $1) AND job_type_access(job_type_id, $2, false, $3) ORDER BY title LIMIT 10;`
 
-	rows, err := conn.Query(c.Request.Context(), query, searchValue)
+	rows, err := conn.Query(c.Request.Context(), query, searchValue, currentUserID(c), accessAllJobTypes(c))
 	if err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Search Job Finances [SQL]: Error while querying jobs table `%v`", err))
-		c.HTML(http.StatusOK, "_jobSearchResultsFinances.html", gin.H{
-			"Error": "An internal error occurred while searching jobs. Please try again.",
-		})
-
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var jobs []Job
 	for rows.Next() {
 		var job Job
-		if err := rows.Scan(&job.ID, &job.Title, &job.Ticket); err != nil {
-			logger.LogToLogFile(c, fmt.Sprintf("Search Job Finances [SQL]: Error while scanning row `%v`", err))
-			c.HTML(http.StatusOK, "_jobSearchResultsFinances.html", gin.H{
-				"Error": "An internal error occurred while searching jobs. Please try again.",
-			})
-
-			return
+		if err := rows.Scan(&job.ID, &job.Title, &job.Ticket, &job.Status, &job.JobTypeID); err != nil {
+			return nil, err
 		}
 		jobs = append(jobs, job)
 	}
 
-	if err := rows.Err(); err != nil {
-		logger.LogToLogFile(c, fmt.Sprintf("Search Job Finances [SQL]: Error while iterating rows `%v`", err))
+	return jobs, rows.Err()
+}
+
+func SearchJobFinances(c *gin.Context) {
+	jobQuery := c.Query("q_job")
+	if jobQuery == "" {
+		return
+	}
+
+	jobs, err := searchJobs(c, jobQuery)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Search Job Finances [SQL]: Error while querying jobs table `%v`", err))
 		c.HTML(http.StatusOK, "_jobSearchResultsFinances.html", gin.H{
 			"Error": "An internal error occurred while searching jobs. Please try again.",
 		})
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// Failed attempts allowed before a username is locked out.
+	userLockoutThreshold = 5
+
+	// Failed attempts allowed from one client IP, across all usernames,
+	// before the IP is blocked.
+	ipBlockThreshold = 20
+
+	// IP failure counters start over after this long without a failure.
+	ipFailureWindow = time.Hour
+
+	// User failure counters start over after this long without a failure,
+	// so typos spread over weeks do not add up to a long lockout.
+	userFailureWindow = 24 * time.Hour
+
+	lockoutBaseDuration = time.Minute
+	lockoutMaxDuration  = time.Hour
+)
+
+// lockoutDuration doubles the lockout for every failure past the threshold.
+func lockoutDuration(failures, threshold int) time.Duration {
+	exponent := failures - threshold
+	if exponent < 0 {
+		return 0
+	}
+	if exponent > 10 {
+		return lockoutMaxDuration
+	}
+
+	duration := lockoutBaseDuration << exponent
+	if duration > lockoutMaxDuration {
+		return lockoutMaxDuration
+	}
+	return duration
+}
+
+func ipBlockedUntil(c *gin.Context) (time.Time, bool, error) {
+	var blockedUntil sql.NullTime
+	query := `SELECT blocked_until FROM login_ip_failures WHERE client_ip = $1 AND blocked_until > NOW()`
+
+	err := conn.QueryRow(c.Request.Context(), query, c.ClientIP()).Scan(&blockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+
+	return blockedUntil.Time, blockedUntil.Valid, nil
+}
+
+// recordIPFailure counts a failed login from the client IP and blocks the IP
+// once it goes over ipBlockThreshold.
+func recordIPFailure(c *gin.Context) {
+	query := `
+	INSERT INTO login_ip_failures (client_ip, failure_count, last_failure_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (client_ip) DO UPDATE SET
+	    failure_count = CASE
+	        WHEN login_ip_failures.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+	        ELSE login_ip_failures.failure_count + 1
+	    END,
+	    last_failure_at = NOW()
+	RETURNING failure_count`
+
+	var failures int
+	err := conn.QueryRow(c.Request.Context(), query, c.ClientIP(), ipFailureWindow.Seconds()).Scan(&failures)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login Throttle [SQL]: Error while recording failure for IP %s `%v`", c.ClientIP(), err))
+		return
+	}
+
+	if failures < ipBlockThreshold {
+		return
+	}
+
+	duration := lockoutDuration(failures, ipBlockThreshold)
+	_, err = conn.Exec(c.Request.Context(), `UPDATE login_ip_failures SET blocked_until = $2 WHERE client_ip = $1`, c.ClientIP(), time.Now().Add(duration))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login Throttle [SQL]: Error while blocking IP %s `%v`", c.ClientIP(), err))
+		return
+	}
+
+	logger.LogToLogFile(c, fmt.Sprintf("Login Throttle: IP %s blocked for %s after %d failed logins", c.ClientIP(), duration, failures))
+}
+
+// recordUserFailure counts a failed login for the user, locks the account once
+// it goes over userLockoutThreshold, and also counts the failure for the IP.
+func recordUserFailure(c *gin.Context, userID, username string) {
+	recordIPFailure(c)
+
+	query := `
+	UPDATE users SET
+	    failed_login_attempts = CASE
+	        WHEN last_failed_login_at IS NULL OR last_failed_login_at < NOW() - make_interval(secs => $2) THEN 1
+	        ELSE failed_login_attempts + 1
+	    END,
+	    last_failed_login_at = NOW()
+	WHERE id = $1
+	RETURNING failed_login_attempts`
+
+	var failures int
+	if err := conn.QueryRow(c.Request.Context(), query, userID, userFailureWindow.Seconds()).Scan(&failures); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login Throttle [SQL]: Error while recording failure for user %s `%v`", username, err))
+		return
+	}
+
+	if failures < userLockoutThreshold {
+		return
+	}
+
+	duration := lockoutDuration(failures, userLockoutThreshold)
+	_, err := conn.Exec(c.Request.Context(), `UPDATE users SET locked_until = $2 WHERE id = $1`, userID, time.Now().Add(duration))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login Throttle [SQL]: Error while locking user %s `%v`", username, err))
+		return
+	}
+
+	logger.LogToLogFile(c, fmt.Sprintf("Login Throttle: User %s locked for %s after %d failed logins", username, duration, failures))
+}
+
+func clearUserFailures(c *gin.Context, userID string) {
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1 AND (failed_login_attempts > 0 OR locked_until IS NOT NULL)`
+	if _, err := conn.Exec(c.Request.Context(), query, userID); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login Throttle [SQL]: Error while clearing failures for user %s `%v`", userID, err))
+	}
+}
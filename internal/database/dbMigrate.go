@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrate/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key passed to pg_advisory_lock so only one
+// instance applies migrations at a time.
+const migrationLockID int64 = 7236512401
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrate")
+	if err != nil {
+		return nil, fmt.Errorf("reading embedded migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		body, err := migrationFiles.ReadFile("migrate/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %06d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func ensureMigrationsTable(ctx context.Context, db *pgxpool.Conn) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+	    version BIGINT PRIMARY KEY,
+	    name TEXT NOT NULL,
+	    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	_, err := db.Exec(ctx, query)
+	return err
+}
+
+func appliedMigrations(ctx context.Context, db *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := db.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration
+// advisory lock, after making sure schema_migrations exists.
+func withMigrationLock(ctx context.Context, fn func(db *pgxpool.Conn) error) error {
+	db, err := conn.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer db.Release()
+
+	if _, err := db.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer db.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+
+	return fn(db)
+}
+
+func applyMigration(ctx context.Context, db *pgxpool.Conn, m migration, up bool) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		if up {
+			if _, err := tx.Exec(ctx, m.Up); err != nil {
+				return fmt.Errorf("applying %06d_%s: %w", m.Version, m.Name, err)
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			return err
+		}
+
+		if m.Down == "" {
+			return fmt.Errorf("migration %06d_%s has no down file", m.Version, m.Name)
+		}
+		if _, err := tx.Exec(ctx, m.Down); err != nil {
+			return fmt.Errorf("reverting %06d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+		return err
+	})
+}
+
+// MigrateTo applies or reverts migrations until the schema is at target.
+// A target of -1 means the latest embedded version.
+func MigrateTo(ctx context.Context, target int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	if target < 0 && len(migrations) > 0 {
+		target = migrations[len(migrations)-1].Version
+	}
+
+	return withMigrationLock(ctx, func(db *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, db)
+		if err != nil {
+			return fmt.Errorf("reading schema_migrations: %w", err)
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok || m.Version > target {
+				continue
+			}
+			if err := applyMigration(ctx, db, m, true); err != nil {
+				return err
+			}
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok || m.Version <= target {
+				continue
+			}
+			if err := applyMigration(ctx, db, m, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// MigrateUp applies every pending migration.
+func MigrateUp(ctx context.Context) error {
+	return MigrateTo(ctx, -1)
+}
+
+// MigrateDown reverts the most recently applied migration.
+func MigrateDown(ctx context.Context) error {
+	statuses, err := Migrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	current := -1
+	for _, s := range statuses {
+		if s.Applied {
+			current = s.Version
+		}
+	}
+	if current < 0 {
+		return fmt.Errorf("no applied migrations to revert")
+	}
+
+	previous := 0
+	for _, s := range statuses {
+		if s.Applied && s.Version < current {
+			previous = s.Version
+		}
+	}
+
+	return MigrateTo(ctx, previous)
+}
+
+// ForceVersion records every migration up to version as applied without
+// running it. Used to adopt databases that were migrated by hand.
+func ForceVersion(ctx context.Context, version int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, func(db *pgxpool.Conn) error {
+		return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+				return err
+			}
+			for _, m := range migrations {
+				if m.Version > version {
+					break
+				}
+				if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Migrations reports every embedded migration and whether it was applied.
+func Migrations(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(ctx, func(db *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, db)
+		if err != nil {
+			return fmt.Errorf("reading schema_migrations: %w", err)
+		}
+
+		for _, m := range migrations {
+			appliedAt, ok := applied[m.Version]
+			statuses = append(statuses, MigrationStatus{
+				Version:   m.Version,
+				Name:      m.Name,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// CheckSchemaCurrent returns an error when an embedded migration has not
+// been applied to the database.
+func CheckSchemaCurrent(ctx context.Context) error {
+	statuses, err := Migrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, fmt.Sprintf("%06d_%s", s.Version, s.Name))
+		}
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind, %d pending migration(s): %v (run `momentum migrate up`)", len(pending), pending)
+	}
+
+	return nil
+}
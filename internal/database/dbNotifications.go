@@ -0,0 +1,70 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Notification tells a user about one of their jobs, such as a missed SLA
+// target.
+type Notification struct {
+	ID        int
+	JobID     *int
+	Message   string
+	CreatedAt time.Time
+	Unread    bool
+}
+
+// listNotifications returns the user's latest notifications, newest first,
+// and marks them read.
+func listNotifications(c *gin.Context, limit int) ([]Notification, error) {
+	query := `
+	WITH latest AS (
+	    SELECT id FROM notifications
+	    WHERE user_id = $1
+	    ORDER BY created_at DESC, id DESC
+	    LIMIT $2
+	),
+	marked AS (
+	    UPDATE notifications n SET read_at = NOW()
+	    FROM latest
+	    WHERE n.id = latest.id AND n.read_at IS NULL
+	)
+	SELECT n.id, n.job_id, n.message, n.created_at, n.read_at IS NULL
+	FROM notifications n
+	JOIN latest ON latest.id = n.id
+	ORDER BY n.created_at DESC, n.id DESC`
+
+	rows, err := conn.Query(c.Request.Context(), query, currentUserID(c), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.JobID, &n.Message, &n.CreatedAt, &n.Unread); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func Notifications(c *gin.Context) {
+	notifications, err := listNotifications(c, 50)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Notifications [SQL]: Error while querying notifications table `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "notifications.html", gin.H{
+		"Notifications": notifications,
+	})
+}
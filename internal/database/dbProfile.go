@@ -25,12 +25,78 @@ func UserProfile(c *gin.Context) {
 		return
 	}
 
+	permissions, err := grantablePermissions(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("User Profile [SQL]: Error while querying permissions `%v`", err))
+	}
+
+	calendarFeed, err := findCalendarFeed(c, id.(string))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("User Profile [SQL]: Error while querying calendar_feeds `%v`", err))
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "user")
+
 	c.HTML(http.StatusOK, "editProfile.html", gin.H{
-		"User": user,
+		"User":              user,
+		"Permissions":       permissions,
+		"APITokenLifetime":  apiTokenLifetimes,
+		"CalendarFeed":      calendarFeed,
+		"CustomFieldInputs": customFieldDefs.inputs(c, customFieldFormValues(user.CustomFields), nil),
 	})
 
 }
 
+// UpdateProfile saves the logged-in user's own details and custom fields.
+// The role stays as it is.
+func UpdateProfile(c *gin.Context) {
+	id := currentUserID(c)
+	fullName := c.PostForm("full_name")
+	locationContact := c.PostForm("location_contact")
+	workPhone := c.PostForm("work_phone")
+	homePhone := c.PostForm("home_phone")
+
+	renderError := func(message string) {
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": message,
+		})
+	}
+
+	if fullName == "" {
+		renderError("Full name cannot be empty.")
+		return
+	}
+
+	var customFieldDefs CustomFieldDefList
+	customFieldDefs.fetchEntityCustomFields(c, "user")
+	_, customFields, fieldErrors := customFieldDefs.submit(c)
+	if len(fieldErrors) > 0 {
+		renderError(customFieldDefs.errorMessage(fieldErrors))
+		return
+	}
+
+	query := `
+		UPDATE users SET full_name = $2, location_contact = $3, work_phone = $4, home_phone = $5,
+		    custom_fields = (custom_fields - $7::text[]) || $6
+		WHERE id = $1`
+
+	cmdTag, err := conn.Exec(c.Request.Context(), query, id, fullName, locationContact, workPhone, homePhone, customFields, customFieldDefs.names())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Profile [SQL]: Error while updating user %s `%v`", id, err))
+		renderError("Error saving changes.")
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		logger.LogToLogFile(c, "Update Profile [SQL]: User not found")
+		renderError("User not found")
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="success">Profile updated successfully!</div>`))
+}
+
 func EditPassword(c *gin.Context) {
 	id, ok := c.Get("userID")
 	if !ok {
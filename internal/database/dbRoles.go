@@ -0,0 +1,346 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+type PermissionGrant struct {
+	Permission
+	Granted bool
+}
+
+type Role struct {
+	ID          int
+	Name        string
+	Description string
+	IsSystem    bool
+	Permissions []string
+	Grants      []PermissionGrant
+
+	CreatedAt time.Time
+}
+
+// rolePermissions loads the permissions of the logged-in user's role once per
+// request and caches them on the context. Requests made with an API token only
+// keep the permissions that are also in the token's scopes.
+func rolePermissions(c *gin.Context) (map[string]bool, error) {
+	if cached, ok := c.Get("permissions"); ok {
+		return cached.(map[string]bool), nil
+	}
+
+	role, _ := c.Get("role")
+	roleName, _ := role.(string)
+
+	query := `
+	SELECT rp.permission
+	FROM role_permissions rp
+	JOIN roles r ON r.id = rp.role_id
+	WHERE r.name = $1`
+
+	rows, err := conn.Query(c.Request.Context(), query, roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := make(map[string]bool)
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions[permission] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if scopes, ok := c.Get("apiTokenScopes"); ok {
+		for permission := range permissions {
+			if !slices.Contains(scopes.([]string), permission) {
+				delete(permissions, permission)
+			}
+		}
+	}
+
+	c.Set("permissions", permissions)
+	return permissions, nil
+}
+
+// HasPermission reports whether the logged-in user's role grants permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	permissions, err := rolePermissions(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Has Permission [SQL]: Error while loading role permissions `%v`", err))
+		return false
+	}
+
+	return permissions[permission]
+}
+
+func roleExists(c *gin.Context, name string) (bool, error) {
+	var exists bool
+	err := conn.QueryRow(c.Request.Context(), `SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)`, name).Scan(&exists)
+	return exists, err
+}
+
+func listPermissions(c *gin.Context) ([]Permission, error) {
+	rows, err := conn.Query(c.Request.Context(), `SELECT name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []Permission
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (r *Role) fillGrants(permissions []Permission) {
+	r.Grants = make([]PermissionGrant, 0, len(permissions))
+	for _, p := range permissions {
+		r.Grants = append(r.Grants, PermissionGrant{
+			Permission: p,
+			Granted:    slices.Contains(r.Permissions, p.Name),
+		})
+	}
+}
+
+const roleSelectQuery = `
+	SELECT r.id, r.name, COALESCE(r.description, ''), r.is_system, r.created_at,
+	    COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id`
+
+func listRoles(c *gin.Context) ([]Role, error) {
+	rows, err := conn.Query(c.Request.Context(), roleSelectQuery+` GROUP BY r.id ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &role.CreatedAt, &role.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *Role) findRoleByID(c *gin.Context, id string) error {
+	err := conn.QueryRow(c.Request.Context(), roleSelectQuery+` WHERE r.id = $1 GROUP BY r.id`, id).Scan(&r.ID, &r.Name, &r.Description, &r.IsSystem, &r.CreatedAt, &r.Permissions)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	return nil
+}
+
+func RoleList(c *gin.Context) {
+	roles, err := listRoles(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Role List [SQL]: Error while querying roles `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	permissions, err := listPermissions(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Role List [SQL]: Error while querying permissions `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	for i := range roles {
+		roles[i].fillGrants(permissions)
+	}
+
+	c.HTML(http.StatusOK, "manageRoles.html", gin.H{
+		"Roles": roles,
+	})
+}
+
+func CreateRole(c *gin.Context) {
+	name := c.PostForm("name")
+	description := c.PostForm("description")
+
+	if name == "" {
+		logger.LogToLogFile(c, "Create Role: Name is empty")
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Name cannot be empty",
+		})
+		return
+	}
+
+	var role Role
+	query := `INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id, name, description, is_system, created_at`
+	err := conn.QueryRow(c.Request.Context(), query, name, description).Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			logger.LogToLogFile(c, fmt.Sprintf("Create Role [SQL]: The `%s` role already exists", name))
+			c.Header("HX-Retarget", "#add-form-feedback")
+			c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+				"Message": "Error: A role with this name already exists.",
+			})
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Create Role [SQL]: Error while inserting `%s` role `%v`", name, err))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "An internal error occurred. Please try again.",
+		})
+		return
+	}
+
+	permissions, err := listPermissions(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Create Role [SQL]: Error while querying permissions `%v`", err))
+	}
+	role.fillGrants(permissions)
+
+	c.HTML(http.StatusOK, "roleItem.html", role)
+}
+
+func UpdateRolePermissions(c *gin.Context) {
+	id := c.Param("id")
+	granted := c.PostFormArray("permissions")
+
+	var role Role
+	if err := role.findRoleByID(c, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Role Permissions: Role {ID: %s} not found `%v`", id, err))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Role not found.",
+		})
+		return
+	}
+
+	currentRole, _ := c.Get("role")
+	if role.Name == currentRole && !slices.Contains(granted, "roles.manage") {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Role Permissions: Refusing to remove roles.manage from own role `%s`", role.Name))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: You cannot remove roles.manage from your own role.",
+		})
+		return
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Role Permissions [SQL]: Error while starting transaction `%v`", err))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "An internal error occurred. Please try again.",
+		})
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	_, err = tx.Exec(c.Request.Context(), `DELETE FROM role_permissions WHERE role_id = $1`, id)
+	if err == nil {
+		_, err = tx.Exec(c.Request.Context(), `INSERT INTO role_permissions (role_id, permission) SELECT $1, unnest($2::text[])`, id, granted)
+	}
+	if err == nil {
+		err = tx.Commit(c.Request.Context())
+	}
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Role Permissions [SQL]: Error while saving permissions for role %s `%v`", role.Name, err))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Cannot save changes.",
+		})
+		return
+	}
+
+	var updatedRole Role
+	if err := updatedRole.findRoleByID(c, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Role Permissions: Role not found after changes `%v`", err))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Role not found after changes.",
+		})
+		return
+	}
+
+	permissions, err := listPermissions(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Update Role Permissions [SQL]: Error while querying permissions `%v`", err))
+	}
+	updatedRole.fillGrants(permissions)
+
+	c.HTML(http.StatusOK, "roleItem.html", updatedRole)
+}
+
+func DeleteRole(c *gin.Context) {
+	id := c.Param("id")
+
+	query := `DELETE FROM roles WHERE id = $1 AND is_system = false`
+	cmdTag, err := conn.Exec(c.Request.Context(), query, id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			logger.LogToLogFile(c, fmt.Sprintf("Delete Role [SQL]: Role {ID: %s} is still assigned to users", id))
+			c.Header("HX-Retarget", "#add-form-feedback")
+			c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+				"Message": "Error: This role is still assigned to users.",
+			})
+			return
+		}
+		logger.LogToLogFile(c, fmt.Sprintf("Delete Role [SQL]: Error while deleting from roles table `%v`", err))
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: An internal error occurred. Please try again.",
+		})
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		c.Header("HX-Retarget", "#add-form-feedback")
+		c.HTML(http.StatusOK, "errorFeedback.html", gin.H{
+			"Message": "Error: Role not found or it is a built-in role.",
+		})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func RegisterPage(c *gin.Context) {
+	roles, err := listRoles(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Register Page [SQL]: Error while querying roles `%v`", err))
+		c.String(http.StatusInternalServerError, "An internal error occurred. Please try again.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "register.html", gin.H{
+		"Roles": roles,
+	})
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"Momentum/internal/logger"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchResult is one hit of the global search, best matches first.
+type SearchResult struct {
+	Kind  string `json:"kind"` // job, job_update, contact or transaction
+	ID    string `json:"id"`
+	Title string `json:"title"`
+
+	// Snippet is the matching text with the matched words in <mark>; the
+	// rest is escaped.
+	Snippet template.HTML `json:"snippet"`
+	URL     string        `json:"url"`
+	Rank    float32       `json:"rank"`
+}
+
+// searchKind is one kind of record the search covers and the permission
+// needed to find it. Jobs and their updates are also limited to the job types
+// the user can view.
+type searchKind struct {
+	Name       string
+	Label      string
+	Permission string
+	query      string
+}
+
+// Each query selects kind, id, title, the text to highlight, url and rank
+// for the records matching q.query; q.user_id is the user searching and
+// q.access_all whether they see every job type.
+var searchKinds = []searchKind{
+	{Name: "job", Label: "Jobs", Permission: "jobs.view", query: `
+	SELECT 'job', j.id::text, j.ticket_id || ' ' || j.title,
+	    concat_ws(' ', j.title, (SELECT string_agg(value, ' ') FROM jsonb_each_text(COALESCE(j.custom_fields, '{}'::jsonb) - 'thumbnail_url'))),
+	    '/jobs/' || j.id, ts_rank(j.search_vector, q.query)
+	FROM jobs j, q
+	WHERE j.search_vector @@ q.query AND job_type_access(j.job_type_id, q.user_id, false, q.access_all)`},
+	{Name: "job_update", Label: "Job updates", Permission: "jobs.view", query: `
+	SELECT 'job_update', ju.id::text, j.ticket_id || ' ' || COALESCE(ju.content->>'title', j.title),
+	    concat_ws(' ', ju.content->>'title', ju.content->>'description'),
+	    '/jobs/' || j.id, ts_rank(ju.search_vector, q.query)
+	FROM job_updates ju
+	JOIN jobs j ON j.id = ju.job_id, q
+	WHERE ju.search_vector @@ q.query AND job_type_access(j.job_type_id, q.user_id, false, q.access_all)`},
+	{Name: "contact", Label: "Contacts", Permission: "contacts.view", query: `
+	SELECT 'contact', ct.id::text, ct.name,
+	    concat_ws(' ', ct.name, ct.email, ct.phone, (SELECT string_agg(value, ' ') FROM jsonb_each_text(ct.custom_fields))),
+	    '/contacts/' || ct.id, ts_rank(ct.search_vector, q.query)
+	FROM contacts ct, q
+	WHERE ct.search_vector @@ q.query`},
+	{Name: "transaction", Label: "Transactions", Permission: "finance.view", query: `
+	SELECT 'transaction', ft.id::text, ft.description,
+	    concat_ws(' ', ft.description, ft.type, ft.amount::text, ft.transaction_date::text),
+	    COALESCE('/jobs/' || ft.related_job_id, '/finance'), ts_rank(ft.search_vector, q.query)
+	FROM financial_transactions ft, q
+	WHERE ft.search_vector @@ q.query`},
+}
+
+// KindLabel names the kind of record the result is.
+func (r SearchResult) KindLabel() string {
+	for _, kind := range searchKinds {
+		if kind.Name == r.Kind {
+			return kind.Label
+		}
+	}
+	return r.Kind
+}
+
+// allowedSearchKinds returns the kinds the user may search, narrowed to one
+// when kind is set.
+func allowedSearchKinds(c *gin.Context, kind string) []searchKind {
+	var allowed []searchKind
+	for _, k := range searchKinds {
+		if (kind == "" || kind == k.Name) && HasPermission(c, k.Permission) {
+			allowed = append(allowed, k)
+		}
+	}
+	return allowed
+}
+
+// searchLimit reads the number of results asked for, 20 by default and at
+// most 50.
+func searchLimit(c *gin.Context) (int, bool) {
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 50 {
+			return 0, false
+		}
+	}
+	return limit, true
+}
+
+// highlightMarks stand for the start and end of a match in ts_headline
+// output, so matches can be marked after the text is escaped.
+var highlightMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// search returns the records of kinds matching terms, best first. Terms use
+// web search syntax: quoted phrases, OR and -excluded words. Words match
+// both stemmed, for prose, and as written, for names and ticket IDs.
+func search(c *gin.Context, terms string, kinds []searchKind, limit int) ([]SearchResult, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	var parts []string
+	for _, kind := range kinds {
+		parts = append(parts, kind.query)
+	}
+
+	query := `
+	WITH q AS (
+	    SELECT websearch_to_tsquery('english', $1) || websearch_to_tsquery('simple', $1) AS query, $2::int AS user_id, $4::boolean AS access_all
+	)
+	SELECT hits.kind, hits.id, hits.title, hits.url, hits.rank,
+	    ts_headline('english', hits.body, q.query, 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=30, MinWords=10, MaxFragments=2')
+	FROM (
+	    SELECT * FROM (` + strings.Join(parts, "\n\tUNION ALL") + `
+	    ) u (kind, id, title, body, url, rank)
+	    ORDER BY rank DESC, kind, id
+	    LIMIT $3
+	) hits, q
+	ORDER BY hits.rank DESC, hits.kind, hits.id`
+
+	rows, err := conn.Query(c.Request.Context(), query, terms, currentUserID(c), limit, accessAllJobTypes(c))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var headline string
+		if err := rows.Scan(&r.Kind, &r.ID, &r.Title, &r.URL, &r.Rank, &headline); err != nil {
+			return nil, err
+		}
+		r.Snippet = template.HTML(highlightMarks.Replace(html.EscapeString(headline)))
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SearchPage is the search page; results are limited to what the user's
+// role and job type access let them see.
+func SearchPage(c *gin.Context) {
+	terms := strings.TrimSpace(c.Query("q"))
+	kind := c.Query("kind")
+
+	var choices []CustomFieldChoice
+	for _, k := range allowedSearchKinds(c, "") {
+		choices = append(choices, CustomFieldChoice{Value: k.Name, Label: k.Label, Selected: k.Name == kind})
+	}
+
+	data := gin.H{
+		"Query": terms,
+		"Kinds": choices,
+	}
+	if terms != "" {
+		results, err := search(c, terms, allowedSearchKinds(c, kind), 20)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Search Page [SQL]: Error while searching `%v`", err))
+			data["Error"] = "An internal error occurred while searching. Please try again."
+		}
+		data["Results"] = results
+		data["Searched"] = true
+	}
+
+	c.HTML(http.StatusOK, "search.html", data)
+}
+
+// SearchResults renders the results of the search page as the user types.
+func SearchResults(c *gin.Context) {
+	terms := strings.TrimSpace(c.Query("q"))
+	if terms == "" {
+		c.HTML(http.StatusOK, "searchResults.html", gin.H{})
+		return
+	}
+
+	limit, ok := searchLimit(c)
+	if !ok {
+		limit = 20
+	}
+
+	results, err := search(c, terms, allowedSearchKinds(c, c.Query("kind")), limit)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Search Results [SQL]: Error while searching `%v`", err))
+		c.HTML(http.StatusOK, "searchResults.html", gin.H{
+			"Searched": true,
+			"Error":    "An internal error occurred while searching. Please try again.",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "searchResults.html", gin.H{
+		"Results":  results,
+		"Searched": true,
+	})
+}
+
+// APISearch searches jobs, job updates, contacts and transactions at once.
+// Kinds the token's permissions do not cover are left out rather than
+// refused.
+func APISearch(c *gin.Context) {
+	terms := strings.TrimSpace(c.Query("q"))
+	if terms == "" {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_query", "`q` is required.")
+		return
+	}
+
+	kind := c.Query("kind")
+	if kind != "" && !isSearchKind(kind) {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_query", "`kind` must be job, job_update, contact or transaction.")
+		return
+	}
+
+	limit, ok := searchLimit(c)
+	if !ok {
+		AbortWithAPIError(c, http.StatusBadRequest, "invalid_pagination", "`limit` must be between 1 and 50.")
+		return
+	}
+
+	results, err := search(c, terms, allowedSearchKinds(c, kind), limit)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("API Search [SQL]: Error while searching `%v`", err))
+		apiInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": emptyIfNil(results)})
+}
+
+func isSearchKind(name string) bool {
+	for _, kind := range searchKinds {
+		if kind.Name == name {
+			return true
+		}
+	}
+	return false
+}
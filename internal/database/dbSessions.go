@@ -0,0 +1,267 @@
+package database
+
+import (
+	"Momentum/internal/jwt"
+	"Momentum/internal/logger"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// refreshTokenTTL is the idle timeout of a session: every rotation pushes
+	// the session expiry forward by this much.
+	refreshTokenTTL = 7 * 24 * time.Hour
+
+	// refreshReuseGrace tolerates parallel requests that were sent with the
+	// refresh token that just got rotated, instead of treating them as theft.
+	refreshReuseGrace = 10 * time.Second
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRefreshToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func insertRefreshToken(ctx context.Context, tx pgx.Tx, sessionID string) (string, error) {
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(ctx, query, sessionID, hashToken(refreshToken), time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+func setAuthCookies(c *gin.Context, accessToken, refreshToken string) {
+	c.SetCookie("token", accessToken, int(jwt.AccessTokenTTL.Seconds()), "/", "localhost", false, true)
+	if refreshToken != "" {
+		c.SetCookie("refresh_token", refreshToken, int(refreshTokenTTL.Seconds()), "/", "localhost", false, true)
+	}
+}
+
+// ClearAuthCookies removes both the access and the refresh token cookies.
+func ClearAuthCookies(c *gin.Context) {
+	c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	c.SetCookie("refresh_token", "", -1, "/", "localhost", false, true)
+}
+
+// startSession creates a new token family for the user and sets the access
+// and refresh token cookies on the response.
+func startSession(c *gin.Context, user userAuthData) error {
+	ctx := c.Request.Context()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var sessionID string
+	query := `INSERT INTO sessions (user_id, user_agent, client_ip, expires_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	err = tx.QueryRow(ctx, query, user.ID, c.Request.UserAgent(), c.ClientIP(), time.Now().Add(refreshTokenTTL)).Scan(&sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	refreshToken, err := insertRefreshToken(ctx, tx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := jwt.CreateToken(user.Username, user.Role, user.ID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to create JWT: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	setAuthCookies(c, accessToken, refreshToken)
+	return nil
+}
+
+// RefreshSession exchanges the refresh token cookie for a new access token and
+// a new refresh token. Presenting a refresh token that was already rotated
+// revokes the whole session, since it means the token was copied.
+func RefreshSession(c *gin.Context) (string, error) {
+	ctx := c.Request.Context()
+
+	refreshToken, err := c.Cookie("refresh_token")
+	if err != nil || refreshToken == "" {
+		return "", errInvalidRefreshToken
+	}
+	tokenHash := hashToken(refreshToken)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var sessionID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := `
+	SELECT rt.session_id, rt.expires_at, rt.used_at
+	FROM refresh_tokens rt
+	JOIN sessions s ON s.id = rt.session_id
+	WHERE rt.token_hash = $1 AND s.revoked_at IS NULL
+	FOR UPDATE OF rt`
+
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&sessionID, &expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errInvalidRefreshToken
+		}
+		return "", err
+	}
+
+	if time.Now().After(expiresAt) {
+		return "", errInvalidRefreshToken
+	}
+
+	var newRefreshToken string
+	if usedAt.Valid {
+		if time.Since(usedAt.Time) > refreshReuseGrace {
+			if _, err := tx.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, sessionID); err != nil {
+				return "", err
+			}
+			if err := tx.Commit(ctx); err != nil {
+				return "", err
+			}
+			logger.LogToLogFile(c, fmt.Sprintf("Refresh Session: Refresh token reused, session %s revoked", sessionID))
+			return "", errRefreshTokenReused
+		}
+	} else {
+		if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`, tokenHash); err != nil {
+			return "", err
+		}
+
+		newRefreshToken, err = insertRefreshToken(ctx, tx, sessionID)
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE sessions SET expires_at = $2 WHERE id = $1`, sessionID, time.Now().Add(refreshTokenTTL)); err != nil {
+			return "", err
+		}
+	}
+
+	var user userAuthData
+	query = `SELECT u.username, u.role, u.id FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id = $1`
+	if err := tx.QueryRow(ctx, query, sessionID).Scan(&user.Username, &user.Role, &user.ID); err != nil {
+		return "", err
+	}
+
+	accessToken, err := jwt.CreateToken(user.Username, user.Role, user.ID, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	setAuthCookies(c, accessToken, newRefreshToken)
+	return accessToken, nil
+}
+
+// SessionActive reports whether the session a token was issued for still exists
+// and has neither expired nor been revoked.
+func SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	var active bool
+	query := `SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW())`
+
+	err := conn.QueryRow(ctx, query, sessionID).Scan(&active)
+	if err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
+
+func revokeSession(ctx context.Context, sessionID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	_, err := conn.Exec(ctx, query, sessionID)
+	return err
+}
+
+func revokeUserSessions(ctx context.Context, userID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := conn.Exec(ctx, query, userID)
+	return err
+}
+
+func Logout(c *gin.Context) {
+	if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+		query := `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE revoked_at IS NULL AND id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1)`
+		if _, err := conn.Exec(c.Request.Context(), query, hashToken(refreshToken)); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Logout [SQL]: Error while revoking session `%v`", err))
+		}
+	}
+
+	if tokenString, err := c.Cookie("token"); err == nil {
+		if claims, err := jwt.VerifyToken(tokenString); err == nil {
+			if sessionID, ok := claims["jti"].(string); ok {
+				if err := revokeSession(c.Request.Context(), sessionID); err != nil {
+					logger.LogToLogFile(c, fmt.Sprintf("Logout [SQL]: Error while revoking session `%v`", err))
+				}
+			}
+		}
+	}
+
+	ClearAuthCookies(c)
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+func LogoutEverywhere(c *gin.Context) {
+	id, ok := c.Get("userID")
+	if !ok {
+		logger.LogToLogFile(c, "Logout Everywhere: Unable to get userID")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">An internal error occurred. Please try again.</div>`))
+		return
+	}
+
+	if err := revokeUserSessions(c.Request.Context(), id.(string)); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Logout Everywhere [SQL]: Error while revoking sessions for user %s `%v`", id, err))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Failed to sign out other sessions. Please try again.</div>`))
+		return
+	}
+
+	ClearAuthCookies(c)
+	c.Header("HX-Redirect", "/login")
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,482 @@
+package database
+
+import (
+	"Momentum/internal/jwt"
+	"Momentum/internal/logger"
+	"Momentum/internal/totp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "Momentum"
+	recoveryCodeCount = 10
+)
+
+// RequireAdmin2FA mirrors config.security.require_admin_2fa: when set, users
+// whose role grants security.require_2fa cannot obtain a session until they
+// have enrolled a TOTP authenticator.
+var RequireAdmin2FA bool
+
+// roleRequires2FA reports whether role grants security.require_2fa. It is used
+// before a session exists, so it cannot go through HasPermission.
+func roleRequires2FA(ctx context.Context, role string) (bool, error) {
+	query := `
+	SELECT EXISTS(
+	    SELECT 1
+	    FROM role_permissions rp
+	    JOIN roles r ON r.id = rp.role_id
+	    WHERE r.name = $1 AND rp.permission = 'security.require_2fa'
+	)`
+
+	var required bool
+	err := conn.QueryRow(ctx, query, role).Scan(&required)
+	return required, err
+}
+
+// continueLogin runs after the password was verified and either starts the
+// session or asks for the second factor.
+func continueLogin(c *gin.Context, user userAuthData) {
+	purpose := ""
+	if user.TOTPEnabled {
+		purpose = "login"
+	} else if RequireAdmin2FA {
+		required, err := roleRequires2FA(c.Request.Context(), user.Role)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Login [SQL]: Error while checking role %s for mandatory 2FA `%v`", user.Role, err))
+			c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+			return
+		}
+		if required {
+			purpose = "enroll"
+		}
+	}
+
+	if purpose == "" {
+		clearUserFailures(c, user.ID)
+		if err := startSession(c, user); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Login: Error while starting session `%v`", err))
+			c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/")
+		return
+	}
+
+	mfaToken, err := jwt.CreateMFAToken(user.ID, purpose)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login [JWT]: Error while creating MFA token `%v`", err))
+		c.String(http.StatusBadRequest, "<div class='error'>Internal server error (JWT)</div>")
+		return
+	}
+
+	templateData := gin.H{"Enroll": purpose == "enroll"}
+	if purpose == "enroll" {
+		secret, err := storePendingTOTPSecret(c.Request.Context(), user.ID)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Login [SQL]: Error while storing pending TOTP secret `%v`", err))
+			c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+			return
+		}
+		templateData["Secret"] = secret
+		templateData["ProvisioningURI"] = totp.ProvisioningURI(totpIssuer, user.Username, secret)
+	}
+
+	c.SetCookie("mfa_token", mfaToken, int(jwt.MFATokenTTL.Seconds()), "/", "localhost", false, true)
+	c.Header("HX-Retarget", ".login-container")
+	c.Header("HX-Reswap", "innerHTML")
+	c.HTML(http.StatusOK, "loginTotp.html", templateData)
+}
+
+func LoginTOTP(c *gin.Context) {
+	mfaToken, err := c.Cookie("mfa_token")
+	if err != nil {
+		c.String(http.StatusBadRequest, "<div class='error'>Your login attempt expired, please start again</div>")
+		return
+	}
+
+	userID, purpose, err := jwt.VerifyMFAToken(mfaToken)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP [JWT]: Invalid MFA token `%v`", err))
+		c.String(http.StatusBadRequest, "<div class='error'>Your login attempt expired, please start again</div>")
+		return
+	}
+
+	code := c.PostForm("code")
+	if code == "" {
+		c.String(http.StatusBadRequest, "<div class='error'>The code is required</div>")
+		return
+	}
+
+	_, blocked, err := ipBlockedUntil(c)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP [SQL]: Error while checking IP block `%v`", err))
+		c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+		return
+	}
+	if blocked {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP: Attempt from blocked IP %s", c.ClientIP()))
+		c.String(http.StatusTooManyRequests, "<div class='error'>Too many failed attempts. Try again later.</div>")
+		return
+	}
+
+	var user userAuthData
+	query := `SELECT username, role, id, totp_enabled, locked_until FROM users WHERE id = $1`
+	err = conn.QueryRow(c.Request.Context(), query, userID).Scan(&user.Username, &user.Role, &user.ID, &user.TOTPEnabled, &user.LockedUntil)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP [SQL]: Error while querying user {ID: %s} `%v`", userID, err))
+		c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+		return
+	}
+
+	if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP: Attempt on locked account %s", user.Username))
+		c.String(http.StatusTooManyRequests, "<div class='error'>Too many failed attempts. Try again later.</div>")
+		return
+	}
+
+	var valid bool
+	if purpose == "enroll" {
+		valid, err = verifyTOTPCode(c.Request.Context(), userID, code)
+	} else {
+		valid, err = verifySecondFactor(c.Request.Context(), userID, code)
+	}
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP [SQL]: Error while verifying code `%v`", err))
+		c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+		return
+	}
+	if !valid {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP: Wrong code for user {ID: %s}", userID))
+		recordUserFailure(c, user.ID, user.Username)
+		c.String(http.StatusBadRequest, "<div class='error'>Invalid code</div>")
+		return
+	}
+
+	var recoveryCodes []string
+	if purpose == "enroll" {
+		recoveryCodes, err = enableTOTP(c.Request.Context(), userID)
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Login TOTP [SQL]: Error while enabling TOTP `%v`", err))
+			c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+			return
+		}
+	}
+
+	clearUserFailures(c, user.ID)
+	if err := startSession(c, user); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Login TOTP: Error while starting session `%v`", err))
+		c.String(http.StatusBadRequest, "<div class='error'>Internal server error</div>")
+		return
+	}
+	c.SetCookie("mfa_token", "", -1, "/", "localhost", false, true)
+
+	if purpose == "enroll" {
+		c.Header("HX-Retarget", ".login-container")
+		c.Header("HX-Reswap", "innerHTML")
+		c.HTML(http.StatusOK, "recoveryCodes.html", gin.H{
+			"RecoveryCodes": recoveryCodes,
+			"ContinueURL":   "/",
+		})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+func storePendingTOTPSecret(ctx context.Context, userID string) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND totp_enabled = false`
+	cmdTag, err := conn.Exec(ctx, query, secret, userID)
+	if err != nil {
+		return "", err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return "", fmt.Errorf("two-factor authentication is already enabled for user %s", userID)
+	}
+
+	return secret, nil
+}
+
+// verifyTOTPCode checks a code against the stored secret and consumes its time
+// step, so the same code cannot be used twice.
+func verifyTOTPCode(ctx context.Context, userID, code string) (bool, error) {
+	var secret *string
+	var lastStep int64
+	query := `SELECT totp_secret, totp_last_step FROM users WHERE id = $1`
+	if err := conn.QueryRow(ctx, query, userID).Scan(&secret, &lastStep); err != nil {
+		return false, err
+	}
+	if secret == nil {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(*secret, code, time.Now(), lastStep)
+	if !ok {
+		return false, nil
+	}
+
+	query = `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+	cmdTag, err := conn.Exec(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func verifySecondFactor(ctx context.Context, userID, code string) (bool, error) {
+	valid, err := verifyTOTPCode(ctx, userID, code)
+	if err != nil || valid {
+		return valid, err
+	}
+
+	return useRecoveryCode(ctx, userID, code)
+}
+
+func generateRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		randomBytes := make([]byte, 5)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := hex.EncodeToString(randomBytes)
+		code = code[:5] + "-" + code[5:]
+
+		codeHash, err := createPasswordHash(code)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, codeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func useRecoveryCode(ctx context.Context, userID, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	rows, err := conn.Query(ctx, `SELECT id, code_hash FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return false, err
+	}
+
+	type recoveryCode struct {
+		ID   int
+		Hash string
+	}
+	var candidates []recoveryCode
+	for rows.Next() {
+		var rc recoveryCode
+		if err := rows.Scan(&rc.ID, &rc.Hash); err != nil {
+			rows.Close()
+			return false, err
+		}
+		candidates = append(candidates, rc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, rc := range candidates {
+		if bcrypt.CompareHashAndPassword([]byte(rc.Hash), []byte(code)) != nil {
+			continue
+		}
+
+		cmdTag, err := conn.Exec(ctx, `UPDATE user_recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, rc.ID)
+		if err != nil {
+			return false, err
+		}
+		return cmdTag.RowsAffected() == 1, nil
+	}
+
+	return false, nil
+}
+
+func enableTOTP(ctx context.Context, userID string) ([]string, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET totp_enabled = true WHERE id = $1 AND totp_secret IS NOT NULL`, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := generateRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit(ctx)
+}
+
+func TOTPSetupModal(c *gin.Context) {
+	id, ok := c.Get("userID")
+	if !ok {
+		logger.LogToLogFile(c, "TOTP Setup Modal: Unable to get userID")
+		c.String(http.StatusNotFound, "Unable to get User ID")
+		return
+	}
+
+	username, _ := c.Get("username")
+
+	secret, err := storePendingTOTPSecret(c.Request.Context(), id.(string))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("TOTP Setup Modal [SQL]: Error while storing pending TOTP secret `%v`", err))
+		c.HTML(http.StatusOK, "totpSetupModal.html", gin.H{
+			"Error": "Two-factor authentication could not be set up. Is it already enabled?",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "totpSetupModal.html", gin.H{
+		"Secret":          secret,
+		"ProvisioningURI": totp.ProvisioningURI(totpIssuer, fmt.Sprint(username), secret),
+	})
+}
+
+func EnableTOTP(c *gin.Context) {
+	id, ok := c.Get("userID")
+	if !ok {
+		logger.LogToLogFile(c, "Enable TOTP: Unable to get userID")
+		c.HTML(http.StatusOK, "totpSetupModal.html", gin.H{
+			"Error": "An internal error occurred. Please try again.",
+		})
+		return
+	}
+
+	valid, err := verifyTOTPCode(c.Request.Context(), id.(string), c.PostForm("code"))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Enable TOTP [SQL]: Error while verifying code `%v`", err))
+		c.HTML(http.StatusOK, "totpSetupModal.html", gin.H{
+			"Error": "An internal error occurred. Please try again.",
+		})
+		return
+	}
+	if !valid {
+		c.Header("HX-Retarget", "#totp-setup-feedback")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Invalid code, check your authenticator app and try again.</div>`))
+		return
+	}
+
+	codes, err := enableTOTP(c.Request.Context(), id.(string))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Enable TOTP [SQL]: Error while enabling TOTP `%v`", err))
+		c.HTML(http.StatusOK, "totpSetupModal.html", gin.H{
+			"Error": "Error saving changes.",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "recoveryCodes.html", gin.H{
+		"RecoveryCodes": codes,
+		"ContinueURL":   "/profile/edit",
+	})
+}
+
+func DisableTOTP(c *gin.Context) {
+	id, ok := c.Get("userID")
+	if !ok {
+		logger.LogToLogFile(c, "Disable TOTP: Unable to get userID")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">An internal error occurred. Please try again.</div>`))
+		return
+	}
+
+	if RequireAdmin2FA && HasPermission(c, "security.require_2fa") {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Two-factor authentication is mandatory for your role.</div>`))
+		return
+	}
+
+	valid, err := verifySecondFactor(c.Request.Context(), id.(string), c.PostForm("code"))
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Disable TOTP [SQL]: Error while verifying code `%v`", err))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">An internal error occurred. Please try again.</div>`))
+		return
+	}
+	if !valid {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Invalid code.</div>`))
+		return
+	}
+
+	query := `
+	WITH deleted_codes AS (
+	    DELETE FROM user_recovery_codes WHERE user_id = $1
+	)
+	UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = 0 WHERE id = $1`
+	if _, err := conn.Exec(c.Request.Context(), query, id); err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Disable TOTP [SQL]: Error while disabling TOTP `%v`", err))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Error saving changes.</div>`))
+		return
+	}
+
+	c.Header("HX-Redirect", "/profile/edit")
+	c.Status(http.StatusOK)
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	id, ok := c.Get("userID")
+	if !ok {
+		logger.LogToLogFile(c, "Regenerate Recovery Codes: Unable to get userID")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">An internal error occurred. Please try again.</div>`))
+		return
+	}
+
+	valid, err := verifyTOTPCode(c.Request.Context(), id.(string), c.PostForm("code"))
+	if err != nil || !valid {
+		if err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Regenerate Recovery Codes [SQL]: Error while verifying code `%v`", err))
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Invalid code.</div>`))
+		return
+	}
+
+	tx, err := conn.Begin(c.Request.Context())
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Regenerate Recovery Codes [SQL]: Error while starting transaction `%v`", err))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">An internal error occurred. Please try again.</div>`))
+		return
+	}
+	defer tx.Rollback(c.Request.Context())
+
+	codes, err := generateRecoveryCodes(c.Request.Context(), tx, id.(string))
+	if err == nil {
+		err = tx.Commit(c.Request.Context())
+	}
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Regenerate Recovery Codes [SQL]: Error while saving recovery codes `%v`", err))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<div class="error">Error saving changes.</div>`))
+		return
+	}
+
+	c.Header("HX-Retarget", "#modal-placeholder")
+	c.HTML(http.StatusOK, "recoveryCodes.html", gin.H{
+		"RecoveryCodes": codes,
+		"ContinueURL":   "/profile/edit",
+	})
+}
@@ -0,0 +1,14 @@
+ALTER TABLE users
+ADD COLUMN totp_secret VARCHAR(64),
+ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE user_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(255) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ON user_recovery_codes (user_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS login_ip_failures;
+
+ALTER TABLE users
+DROP COLUMN failed_login_attempts,
+DROP COLUMN last_failed_login_at,
+DROP COLUMN locked_until;
@@ -0,0 +1,11 @@
+ALTER TABLE users
+ADD COLUMN failed_login_attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN last_failed_login_at TIMESTAMPTZ,
+ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE TABLE login_ip_failures (
+    client_ip VARCHAR(64) PRIMARY KEY,
+    failure_count INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMPTZ
+);
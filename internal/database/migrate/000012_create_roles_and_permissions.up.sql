@@ -0,0 +1,57 @@
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT,
+    is_system BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+CREATE TABLE role_permissions (
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('jobs.view', 'View jobs and their update history'),
+    ('jobs.create', 'Create jobs'),
+    ('jobs.edit', 'Edit jobs'),
+    ('jobs.updates.create', 'Add updates to jobs'),
+    ('jobs.delete.own', 'Delete jobs assigned to yourself'),
+    ('jobs.delete.any', 'Delete any job'),
+    ('contacts.view', 'Search and view contacts'),
+    ('contacts.write', 'Create contacts'),
+    ('finance.view', 'View financial transactions'),
+    ('finance.write', 'Record financial transactions'),
+    ('jobtypes.manage', 'Create, edit and delete job types and their custom fields'),
+    ('users.manage', 'Register, edit, unlock and delete users'),
+    ('roles.manage', 'Create roles and edit their permissions'),
+    ('logs.view', 'View the server log');
+
+INSERT INTO roles (name, description, is_system) VALUES
+    ('admin', 'Full access', true),
+    ('user', 'Day-to-day work on jobs, contacts and finance', true);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.name FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.name
+FROM roles r
+JOIN permissions p ON p.name IN (
+    'jobs.view', 'jobs.create', 'jobs.edit', 'jobs.updates.create', 'jobs.delete.own',
+    'contacts.view', 'contacts.write', 'finance.view', 'finance.write'
+)
+WHERE r.name = 'user';
+
+-- Keep any role already stored on users valid, without permissions.
+INSERT INTO roles (name, description)
+SELECT DISTINCT role, '' FROM users WHERE role NOT IN (SELECT name FROM roles);
+
+ALTER TABLE users
+ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
@@ -0,0 +1,7 @@
+DROP FUNCTION IF EXISTS job_type_access(INT, INT, BOOLEAN);
+
+DELETE FROM permissions WHERE name = 'jobs.access.all';
+
+DROP TABLE IF EXISTS job_type_members;
+
+ALTER TABLE job_types DROP COLUMN restricted;
@@ -0,0 +1,47 @@
+ALTER TABLE job_types ADD COLUMN restricted BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE job_type_members (
+    id SERIAL PRIMARY KEY,
+    job_type_id INT NOT NULL REFERENCES job_types(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    role_id INT REFERENCES roles(id) ON DELETE CASCADE,
+    can_edit BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((user_id IS NULL) <> (role_id IS NULL)),
+    UNIQUE (job_type_id, user_id),
+    UNIQUE (job_type_id, role_id)
+);
+
+CREATE INDEX ON job_type_members (user_id);
+CREATE INDEX ON job_type_members (role_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('jobs.access.all', 'See and edit jobs of restricted job types without being a member');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'jobs.access.all' FROM roles WHERE name = 'admin';
+
+-- Whether a user may see (p_edit = false) or change (p_edit = true) jobs of a
+-- job type. Unrestricted job types are open to everyone.
+CREATE OR REPLACE FUNCTION job_type_access(p_job_type_id INT, p_user_id INT, p_edit BOOLEAN)
+RETURNS BOOLEAN AS $$
+    SELECT NOT jt.restricted
+        OR EXISTS (
+            SELECT 1
+            FROM users u
+            JOIN roles r ON r.name = u.role
+            JOIN role_permissions rp ON rp.role_id = r.id
+            WHERE u.id = p_user_id AND rp.permission = 'jobs.access.all'
+        )
+        OR EXISTS (
+            SELECT 1
+            FROM job_type_members m
+            JOIN users u ON u.id = p_user_id
+            LEFT JOIN roles r ON r.name = u.role
+            WHERE m.job_type_id = jt.id
+                AND (m.user_id = u.id OR m.role_id = r.id)
+                AND (m.can_edit OR NOT p_edit)
+        )
+    FROM job_types jt
+    WHERE jt.id = p_job_type_id
+$$ LANGUAGE sql STABLE;
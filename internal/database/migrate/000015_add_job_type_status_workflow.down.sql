@@ -0,0 +1 @@
+ALTER TABLE job_types DROP COLUMN status_workflow;
@@ -0,0 +1,22 @@
+-- Each job type defines its own statuses and, per status, the statuses a job
+-- may move to next. New and existing job types start with the open/closed
+-- pair the edit form used to hardcode.
+ALTER TABLE job_types ADD COLUMN status_workflow JSONB NOT NULL DEFAULT '[
+    {"name": "open", "label": "Open", "is_initial": true, "is_final": false, "transitions": ["closed"]},
+    {"name": "closed", "label": "Closed", "is_initial": false, "is_final": true, "transitions": ["open"]}
+]'::jsonb;
+
+-- Keep any other status already in use reachable, so those jobs can still be
+-- moved to open or closed.
+UPDATE job_types jt
+SET status_workflow = jt.status_workflow || (
+    SELECT jsonb_agg(jsonb_build_object(
+        'name', s.status,
+        'label', s.status,
+        'is_initial', false,
+        'is_final', false,
+        'transitions', jsonb_build_array('open', 'closed')
+    ))
+    FROM (SELECT DISTINCT status FROM jobs WHERE job_type_id = jt.id AND status NOT IN ('open', 'closed')) s
+)
+WHERE EXISTS (SELECT 1 FROM jobs WHERE job_type_id = jt.id AND status NOT IN ('open', 'closed'));
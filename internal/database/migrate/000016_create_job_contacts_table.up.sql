@@ -0,0 +1,12 @@
+-- Contacts involved in a job besides its primary contact, each linked with
+-- the part they play (site, billing, requester).
+CREATE TABLE job_contacts (
+    id SERIAL PRIMARY KEY,
+    job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    contact_id INT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (job_id, contact_id, role)
+);
+
+CREATE INDEX ON job_contacts (contact_id);
@@ -0,0 +1,9 @@
+DELETE FROM permissions WHERE name = 'contacts.delete';
+UPDATE permissions SET description = 'Create contacts' WHERE name = 'contacts.write';
+
+DROP INDEX IF EXISTS contacts_email_lower_idx;
+DROP INDEX IF EXISTS contacts_phone_digits_idx;
+DROP INDEX IF EXISTS contacts_name_idx;
+
+ALTER TABLE contacts ALTER COLUMN custom_fields DROP NOT NULL;
+ALTER TABLE contacts ALTER COLUMN custom_fields DROP DEFAULT;
@@ -0,0 +1,22 @@
+-- Contacts created without an email stored '' and blocked every other contact
+-- without one through the UNIQUE constraint.
+UPDATE contacts SET email = NULL WHERE email = '';
+UPDATE contacts SET phone = NULL WHERE phone = '';
+
+UPDATE contacts SET custom_fields = '{}'::jsonb WHERE custom_fields IS NULL;
+ALTER TABLE contacts ALTER COLUMN custom_fields SET DEFAULT '{}'::jsonb;
+ALTER TABLE contacts ALTER COLUMN custom_fields SET NOT NULL;
+
+-- Duplicate detection compares emails case-insensitively and phones by their
+-- digits only.
+CREATE INDEX contacts_email_lower_idx ON contacts (LOWER(email));
+CREATE INDEX contacts_phone_digits_idx ON contacts ((regexp_replace(phone, '\D', '', 'g')));
+CREATE INDEX contacts_name_idx ON contacts (name);
+
+UPDATE permissions SET description = 'Create and edit contacts' WHERE name = 'contacts.write';
+
+INSERT INTO permissions (name, description) VALUES
+    ('contacts.delete', 'Merge and delete contacts');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'contacts.delete' FROM roles WHERE name = 'admin';
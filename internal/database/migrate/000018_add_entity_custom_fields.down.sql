@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE name = 'customfields.manage';
+
+ALTER TABLE users ALTER COLUMN custom_fields DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN custom_fields DROP DEFAULT;
+
+DROP TABLE IF EXISTS entity_custom_fields;
@@ -0,0 +1,18 @@
+-- Custom field definitions for records that have no job type to hang them
+-- on. There is one row per entity.
+CREATE TABLE entity_custom_fields (
+    entity TEXT PRIMARY KEY CHECK (entity IN ('contact', 'user')),
+    definitions JSONB NOT NULL DEFAULT '[]'::jsonb
+);
+
+INSERT INTO entity_custom_fields (entity) VALUES ('contact'), ('user');
+
+UPDATE users SET custom_fields = '{}'::jsonb WHERE custom_fields IS NULL;
+ALTER TABLE users ALTER COLUMN custom_fields SET DEFAULT '{}'::jsonb;
+ALTER TABLE users ALTER COLUMN custom_fields SET NOT NULL;
+
+INSERT INTO permissions (name, description) VALUES
+    ('customfields.manage', 'Define custom fields for contacts and users');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'customfields.manage' FROM roles WHERE name = 'admin';
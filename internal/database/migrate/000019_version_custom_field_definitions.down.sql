@@ -0,0 +1,2 @@
+ALTER TABLE entity_custom_fields DROP COLUMN IF EXISTS version;
+ALTER TABLE job_types DROP COLUMN IF EXISTS custom_fields_version;
@@ -0,0 +1,5 @@
+-- Every change to a list of custom field definitions bumps its version, so
+-- an admin saving over a list someone else changed meanwhile is refused
+-- instead of silently undoing the other change.
+ALTER TABLE job_types ADD COLUMN custom_fields_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE entity_custom_fields ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
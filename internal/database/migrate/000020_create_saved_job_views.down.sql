@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS jobs_updated_at_id_idx;
+DROP INDEX IF EXISTS jobs_created_at_id_idx;
+DROP INDEX IF EXISTS jobs_custom_fields_idx;
+DROP TABLE IF EXISTS saved_job_views;
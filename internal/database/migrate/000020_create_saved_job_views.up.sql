@@ -0,0 +1,20 @@
+-- Filters and sort of a job list saved under a name. A view without a job
+-- type belongs to My Jobs; a shared view is listed for everyone who sees its
+-- job list.
+CREATE TABLE saved_job_views (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    job_type_id INT REFERENCES job_types(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    is_shared BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ON saved_job_views (job_type_id);
+CREATE INDEX ON saved_job_views (user_id);
+
+-- Filtering by custom field values and keyset pagination by date.
+CREATE INDEX jobs_custom_fields_idx ON jobs USING GIN (custom_fields jsonb_path_ops);
+CREATE INDEX jobs_created_at_id_idx ON jobs (created_at, id);
+CREATE INDEX jobs_updated_at_id_idx ON jobs (updated_at, id);
@@ -0,0 +1,4 @@
+ALTER TABLE financial_transactions DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE contacts DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE job_updates DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE jobs DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,28 @@
+-- Full-text search over jobs, job updates, contacts and transactions. Names,
+-- ticket IDs, emails and phone numbers are indexed as written; prose is
+-- stemmed. Phone numbers are indexed by their digits as well.
+ALTER TABLE jobs ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', ticket_id), 'A') ||
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(jsonb_to_tsvector('english', COALESCE(custom_fields, '{}'::jsonb) - 'thumbnail_url', '["string", "numeric"]'), 'C')
+) STORED;
+CREATE INDEX jobs_search_idx ON jobs USING GIN (search_vector);
+
+ALTER TABLE job_updates ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(content->>'title', '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(content->>'description', '')), 'B')
+) STORED;
+CREATE INDEX job_updates_search_idx ON job_updates USING GIN (search_vector);
+
+ALTER TABLE contacts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(email, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(phone, '') || ' ' || regexp_replace(COALESCE(phone, ''), '\D', '', 'g')), 'B') ||
+    setweight(jsonb_to_tsvector('english', custom_fields, '["string", "numeric"]'), 'C')
+) STORED;
+CREATE INDEX contacts_search_idx ON contacts USING GIN (search_vector);
+
+ALTER TABLE financial_transactions ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', description), 'A')
+) STORED;
+CREATE INDEX financial_transactions_search_idx ON financial_transactions USING GIN (search_vector);
@@ -0,0 +1,18 @@
+DROP FUNCTION IF EXISTS job_overdue(jobs);
+DROP FUNCTION IF EXISTS job_sla_due(jobs, INT);
+DROP TRIGGER IF EXISTS set_job_responded ON job_updates;
+DROP FUNCTION IF EXISTS trigger_set_job_responded();
+
+DELETE FROM job_updates WHERE author_user_id IS NULL;
+ALTER TABLE job_updates ALTER COLUMN author_user_id SET NOT NULL;
+
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS job_sla_escalations;
+DROP TABLE IF EXISTS job_type_slas;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS sla_paused_seconds;
+ALTER TABLE jobs DROP COLUMN IF EXISTS sla_paused_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS resolved_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS responded_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS due_date;
+ALTER TABLE jobs DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,107 @@
+-- Due dates, priorities and SLA clocks of jobs. The clocks run from creation
+-- and stand still while a job is in a status that pauses them or is final;
+-- sla_paused_seconds adds up the time they stood still before.
+ALTER TABLE jobs ADD COLUMN priority VARCHAR(20) NOT NULL DEFAULT 'normal'
+    CHECK (priority IN ('low', 'normal', 'high', 'urgent'));
+ALTER TABLE jobs ADD COLUMN due_date DATE;
+ALTER TABLE jobs ADD COLUMN responded_at TIMESTAMPTZ;
+ALTER TABLE jobs ADD COLUMN resolved_at TIMESTAMPTZ;
+ALTER TABLE jobs ADD COLUMN sla_paused_at TIMESTAMPTZ;
+ALTER TABLE jobs ADD COLUMN sla_paused_seconds INT NOT NULL DEFAULT 0;
+
+CREATE INDEX jobs_unresolved_idx ON jobs (job_type_id) WHERE resolved_at IS NULL;
+
+-- Jobs already in a final status count as resolved when last changed, and
+-- jobs with more than their creation update as responded to.
+UPDATE jobs j SET resolved_at = j.updated_at, sla_paused_at = j.updated_at
+FROM job_types jt
+WHERE jt.id = j.job_type_id
+    AND EXISTS (
+        SELECT 1 FROM jsonb_array_elements(jt.status_workflow) s
+        WHERE s->>'name' = j.status AND (s->>'is_final')::boolean
+    );
+
+UPDATE jobs j SET responded_at = r.created_at
+FROM (
+    SELECT job_id, created_at
+    FROM (
+        SELECT job_id, created_at, ROW_NUMBER() OVER (PARTITION BY job_id ORDER BY created_at) AS n
+        FROM job_updates
+    ) ranked
+    WHERE n = 2
+) r
+WHERE r.job_id = j.id;
+
+-- Response and resolution targets of a job type per priority, in minutes. A
+-- missing row or target means no SLA.
+CREATE TABLE job_type_slas (
+    job_type_id INT NOT NULL REFERENCES job_types(id) ON DELETE CASCADE,
+    priority VARCHAR(20) NOT NULL CHECK (priority IN ('low', 'normal', 'high', 'urgent')),
+    response_minutes INT CHECK (response_minutes > 0),
+    resolution_minutes INT CHECK (resolution_minutes > 0),
+    PRIMARY KEY (job_type_id, priority)
+);
+
+-- Breaches already escalated, so each is escalated once.
+CREATE TABLE job_sla_escalations (
+    job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    breach VARCHAR(20) NOT NULL,
+    escalated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job_id, breach)
+);
+
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    job_id INT REFERENCES jobs(id) ON DELETE CASCADE,
+    message TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMPTZ
+);
+
+CREATE INDEX ON notifications (user_id, created_at DESC);
+
+-- Escalations are written by Momentum itself, not by a user.
+ALTER TABLE job_updates ALTER COLUMN author_user_id DROP NOT NULL;
+
+-- The first update or status change after a job was added is its response.
+CREATE OR REPLACE FUNCTION trigger_set_job_responded()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF COALESCE(NEW.content->>'type', 'update') IN ('update', 'status_change') THEN
+        UPDATE jobs SET responded_at = NEW.created_at
+        WHERE id = NEW.job_id
+            AND responded_at IS NULL
+            AND EXISTS (SELECT 1 FROM job_updates WHERE job_id = NEW.job_id AND id <> NEW.id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_job_responded
+AFTER INSERT ON job_updates
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_job_responded();
+
+-- When an SLA target of p_minutes falls due for a job, moved back by the
+-- time its clock stood still. NULL without a target.
+CREATE OR REPLACE FUNCTION job_sla_due(j jobs, p_minutes INT)
+RETURNS TIMESTAMPTZ AS $$
+    SELECT j.created_at
+        + make_interval(mins => p_minutes, secs => j.sla_paused_seconds)
+        + COALESCE(NOW() - j.sla_paused_at, interval '0')
+$$ LANGUAGE sql STABLE;
+
+-- What a job is overdue on: its 'resolution' or 'response' SLA target, or its
+-- 'due_date'. NULL while it is on time and once it is resolved.
+CREATE OR REPLACE FUNCTION job_overdue(j jobs)
+RETURNS TEXT AS $$
+    SELECT CASE
+        WHEN j.resolved_at IS NOT NULL THEN NULL
+        WHEN job_sla_due(j, sla.resolution_minutes) < NOW() THEN 'resolution'
+        WHEN j.responded_at IS NULL AND job_sla_due(j, sla.response_minutes) < NOW() THEN 'response'
+        WHEN j.due_date < CURRENT_DATE THEN 'due_date'
+    END
+    FROM (SELECT 1) one
+    LEFT JOIN job_type_slas sla ON sla.job_type_id = j.job_type_id AND sla.priority = j.priority
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,31 @@
+-- Appointment windows of jobs: when a technician is booked to work on a job.
+-- A job can have several, with the same or different technicians.
+CREATE TABLE job_appointments (
+    id SERIAL PRIMARY KEY,
+    job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX job_appointments_user_idx ON job_appointments (user_id, starts_at);
+CREATE INDEX job_appointments_job_idx ON job_appointments (job_id, starts_at);
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON job_appointments
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+-- The secret link of a user's calendar feed. Only a hash of the token is
+-- kept; a new link replaces the old one.
+CREATE TABLE calendar_feeds (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_prefix VARCHAR(20) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
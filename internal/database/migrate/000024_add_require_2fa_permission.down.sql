@@ -0,0 +1 @@
+DELETE FROM permissions WHERE name = 'security.require_2fa';
@@ -0,0 +1,8 @@
+INSERT INTO permissions (name, description) VALUES
+    ('security.require_2fa', 'Must sign in with two-factor authentication when require_admin_2fa is set');
+
+-- Every role that can manage users or roles was an administrator before.
+INSERT INTO role_permissions (role_id, permission)
+SELECT DISTINCT role_id, 'security.require_2fa'
+FROM role_permissions
+WHERE permission IN ('users.manage', 'roles.manage');
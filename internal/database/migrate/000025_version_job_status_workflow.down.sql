@@ -0,0 +1 @@
+ALTER TABLE job_types DROP COLUMN IF EXISTS status_workflow_version;
@@ -0,0 +1,3 @@
+-- Like custom_fields_version: every change to a status workflow bumps it, so
+-- an admin saving over a workflow someone else changed meanwhile is refused.
+ALTER TABLE job_types ADD COLUMN status_workflow_version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,25 @@
+DROP FUNCTION IF EXISTS job_type_access(INT, INT, BOOLEAN, BOOLEAN);
+DROP FUNCTION IF EXISTS role_grants(INT, TEXT);
+
+CREATE OR REPLACE FUNCTION job_type_access(p_job_type_id INT, p_user_id INT, p_edit BOOLEAN)
+RETURNS BOOLEAN AS $$
+    SELECT NOT jt.restricted
+        OR EXISTS (
+            SELECT 1
+            FROM users u
+            JOIN roles r ON r.name = u.role
+            JOIN role_permissions rp ON rp.role_id = r.id
+            WHERE u.id = p_user_id AND rp.permission = 'jobs.access.all'
+        )
+        OR EXISTS (
+            SELECT 1
+            FROM job_type_members m
+            JOIN users u ON u.id = p_user_id
+            LEFT JOIN roles r ON r.name = u.role
+            WHERE m.job_type_id = jt.id
+                AND (m.user_id = u.id OR m.role_id = r.id)
+                AND (m.can_edit OR NOT p_edit)
+        )
+    FROM job_types jt
+    WHERE jt.id = p_job_type_id
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,35 @@
+-- jobs.access.all now comes from the caller, so the scopes of an API token
+-- limit it like every other permission. role_grants keeps the role check for
+-- users other than the one signed in, such as assignees and technicians.
+DROP FUNCTION IF EXISTS job_type_access(INT, INT, BOOLEAN);
+
+CREATE OR REPLACE FUNCTION role_grants(p_user_id INT, p_permission TEXT)
+RETURNS BOOLEAN AS $$
+    SELECT EXISTS (
+        SELECT 1
+        FROM users u
+        JOIN roles r ON r.name = u.role
+        JOIN role_permissions rp ON rp.role_id = r.id
+        WHERE u.id = p_user_id AND rp.permission = p_permission
+    )
+$$ LANGUAGE sql STABLE;
+
+-- Whether a user may see (p_edit = false) or change (p_edit = true) jobs of a
+-- job type. Unrestricted job types are open to everyone, and p_access_all
+-- opens every job type.
+CREATE OR REPLACE FUNCTION job_type_access(p_job_type_id INT, p_user_id INT, p_edit BOOLEAN, p_access_all BOOLEAN)
+RETURNS BOOLEAN AS $$
+    SELECT NOT jt.restricted
+        OR p_access_all
+        OR EXISTS (
+            SELECT 1
+            FROM job_type_members m
+            JOIN users u ON u.id = p_user_id
+            LEFT JOIN roles r ON r.name = u.role
+            WHERE m.job_type_id = jt.id
+                AND (m.user_id = u.id OR m.role_id = r.id)
+                AND (m.can_edit OR NOT p_edit)
+        )
+    FROM job_types jt
+    WHERE jt.id = p_job_type_id
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,100 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can
+// subscribe to.
+package ical
+
+import (
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest a content line may be before it is folded.
+const maxLineOctets = 75
+
+const utcFormat = "20060102T150405Z"
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Event is one VEVENT. Start and End are written in UTC.
+type Event struct {
+	UID         string
+	Stamp       time.Time // when the event last changed
+	Start, End  time.Time
+	Summary     string
+	Description string
+	URL         string
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// foldLine splits a content line into lines of at most maxLineOctets octets,
+// continued with a leading space, without breaking UTF-8 characters.
+func foldLine(line string) string {
+	if len(line) <= maxLineOctets {
+		return line + "\r\n"
+	}
+
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines lose one octet to the leading space.
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// Write writes the calendar as text/calendar.
+func (cal Calendar) Write(w io.Writer) error {
+	var b strings.Builder
+	line := func(name, value string) {
+		b.WriteString(foldLine(name + ":" + value))
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Momentum//Momentum//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+
+	for _, e := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", e.Stamp.UTC().Format(utcFormat))
+		line("DTSTART", e.Start.UTC().Format(utcFormat))
+		line("DTEND", e.End.UTC().Format(utcFormat))
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
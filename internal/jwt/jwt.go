@@ -10,12 +10,17 @@ import (
 
 var jwtSecret = []byte(os.Getenv("JWT_SECRET_KEY"))
 
-func CreateToken(username, role, userID string) (string, error) {
+// AccessTokenTTL is kept short because the token is refreshed transparently
+// with the rotating refresh token.
+const AccessTokenTTL = 15 * time.Minute
+
+func CreateToken(username, role, userID, sessionID string) (string, error) {
 	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": username,
 		"id":  userID,
 		"aud": role,
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
+		"jti": sessionID,
+		"exp": time.Now().Add(AccessTokenTTL).Unix(),
 		"iat": time.Now().Unix(),
 	})
 
@@ -49,3 +54,35 @@ func VerifyToken(tokenString string) (jwt.MapClaims, error) {
 	return nil, fmt.Errorf("invalid token")
 
 }
+
+// MFATokenTTL bounds how long a user has to finish the second login step.
+const MFATokenTTL = 5 * time.Minute
+
+// CreateMFAToken issues the short-lived token that carries a user between the
+// password step and the TOTP step of the login. purpose is either "login" or
+// "enroll".
+func CreateMFAToken(userID, purpose string) (string, error) {
+	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":      userID,
+		"purpose": purpose,
+		"exp":     time.Now().Add(MFATokenTTL).Unix(),
+		"iat":     time.Now().Unix(),
+	})
+
+	return claims.SignedString(jwtSecret)
+}
+
+func VerifyMFAToken(tokenString string) (userID, purpose string, err error) {
+	claims, err := VerifyToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+
+	userID, _ = claims["id"].(string)
+	purpose, _ = claims["purpose"].(string)
+	if userID == "" || (purpose != "login" && purpose != "enroll") {
+		return "", "", fmt.Errorf("invalid MFA token")
+	}
+
+	return userID, purpose, nil
+}
@@ -0,0 +1,291 @@
+// Package openapi builds the OpenAPI 3 document for Momentum from the routes
+// registered on the gin engine and the operation descriptions in Operations.
+package openapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Field describes a query parameter or a request body property.
+type Field struct {
+	Name        string
+	Type        string // string, integer, number, boolean, file, array or object
+	Description string
+	Required    bool
+}
+
+type Operation struct {
+	Summary    string
+	Tag        string
+	Public     bool   // reachable without logging in
+	Permission string // permission checked by web.RequirePermission
+	CookieOnly bool   // refuses API tokens, see web.RejectAPITokens
+
+	Query []Field
+	Form  []Field // form or multipart body, multipart when a field is a file
+	JSON  []Field // JSON body
+
+	// Response is the component schema returned by JSON endpoints. HTML
+	// endpoints leave it empty.
+	Response string
+	List     bool // Response is wrapped in a paginated list
+}
+
+// routeKey matches the key used in Operations, e.g. "GET /jobs/:id".
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// Undocumented lists the registered routes that have no entry in Operations.
+func Undocumented(routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, route := range routes {
+		key := routeKey(route.Method, route.Path)
+		if _, ok := Operations[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// Unrouted lists the entries in Operations that no registered route uses.
+func Unrouted(routes gin.RoutesInfo) []string {
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		registered[routeKey(route.Method, route.Path)] = true
+	}
+
+	var stale []string
+	for key := range Operations {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// openAPIPath turns gin's `:id` and `*filepath` segments into `{id}` and
+// `{filepath}`, and returns the parameter names in order.
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func fieldSchema(f Field) map[string]any {
+	var schema map[string]any
+	switch f.Type {
+	case "file":
+		schema = map[string]any{"type": "string", "format": "binary"}
+	case "array":
+		schema = map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+	case "object":
+		schema = map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}}
+	case "":
+		schema = map[string]any{"type": "string"}
+	default:
+		schema = map[string]any{"type": f.Type}
+	}
+	if f.Description != "" {
+		schema["description"] = f.Description
+	}
+	return schema
+}
+
+func bodySchema(fields []Field) (map[string]any, bool, []string) {
+	properties := map[string]any{}
+	var required []string
+	hasFile := false
+	var objects []string
+	for _, f := range fields {
+		properties[f.Name] = fieldSchema(f)
+		if f.Required {
+			required = append(required, f.Name)
+		}
+		if f.Type == "file" {
+			hasFile = true
+		}
+		if f.Type == "object" {
+			objects = append(objects, f.Name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, hasFile, objects
+}
+
+func buildOperation(route gin.RouteInfo, op Operation) map[string]any {
+	_, pathParams := openAPIPath(route.Path)
+
+	var parameters []any
+	for _, name := range pathParams {
+		parameters = append(parameters, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	for _, f := range op.Query {
+		parameters = append(parameters, map[string]any{
+			"name":     f.Name,
+			"in":       "query",
+			"required": f.Required,
+			"schema":   fieldSchema(f),
+		})
+	}
+
+	operation := map[string]any{
+		"summary":     op.Summary,
+		"operationId": strings.ToLower(route.Method) + strings.NewReplacer("/", "_", ":", "", "*", "", "-", "_", ".", "_").Replace(route.Path),
+		"responses":   responses(op),
+	}
+	if op.Tag != "" {
+		operation["tags"] = []string{op.Tag}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if op.Public {
+		operation["security"] = []any{}
+	}
+	if op.CookieOnly {
+		operation["security"] = []any{map[string]any{"cookieAuth": []string{}}}
+	}
+	if op.Permission != "" {
+		operation["description"] = "Requires the `" + op.Permission + "` permission."
+		operation["x-permission"] = op.Permission
+	}
+
+	switch {
+	case len(op.JSON) > 0:
+		schema, _, _ := bodySchema(op.JSON)
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schema}},
+		}
+	case len(op.Form) > 0:
+		schema, hasFile, objects := bodySchema(op.Form)
+		mediaType := "application/x-www-form-urlencoded"
+		if hasFile {
+			mediaType = "multipart/form-data"
+		}
+		content := map[string]any{"schema": schema}
+		if len(objects) > 0 {
+			// Maps such as custom_fields are sent as custom_fields[name]=value.
+			encoding := map[string]any{}
+			for _, name := range objects {
+				encoding[name] = map[string]any{"style": "deepObject", "explode": true}
+			}
+			content["encoding"] = encoding
+		}
+		operation["requestBody"] = map[string]any{
+			"content": map[string]any{mediaType: content},
+		}
+	}
+
+	return operation
+}
+
+func responses(op Operation) map[string]any {
+	if op.Response == "" {
+		return map[string]any{
+			"200": map[string]any{
+				"description": "HTML page or HTMX fragment",
+				"content":     map[string]any{"text/html": map[string]any{}},
+			},
+		}
+	}
+
+	schema := map[string]any{"$ref": "#/components/schemas/" + op.Response}
+	var body map[string]any
+	if op.List {
+		body = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"data":        map[string]any{"type": "array", "items": schema},
+				"next_cursor": map[string]any{"description": "Pass as `after` or `before` to get the next page. Null on the last page.", "nullable": true},
+			},
+		}
+	} else {
+		body = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"data": schema},
+		}
+	}
+
+	errorResponse := map[string]any{"$ref": "#/components/responses/Error"}
+	return map[string]any{
+		"200": map[string]any{
+			"description": "Success",
+			"content":     map[string]any{"application/json": map[string]any{"schema": body}},
+		},
+		"400": errorResponse,
+		"401": errorResponse,
+		"403": errorResponse,
+		"404": errorResponse,
+		"500": errorResponse,
+	}
+}
+
+// Document builds the OpenAPI document for the given routes. Routes without
+// an entry in Operations are still listed, with only their path parameters.
+func Document(routes gin.RoutesInfo) map[string]any {
+	paths := map[string]any{}
+	for _, route := range routes {
+		path, _ := openAPIPath(route.Path)
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+
+		op := Operations[routeKey(route.Method, route.Path)]
+		item[strings.ToLower(route.Method)] = buildOperation(route, op)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Momentum",
+			"version":     "1",
+			"description": "HTML and HTMX endpoints of the web UI, and the JSON API under /api/v1.",
+		},
+		"security": []any{
+			map[string]any{"cookieAuth": []string{}},
+			map[string]any{"bearerAuth": []string{}},
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+// Handler serves the document for every route registered on engine. It is
+// built on the first request, once all routes are in place.
+func Handler(engine *gin.Engine) gin.HandlerFunc {
+	var once sync.Once
+	var document map[string]any
+	return func(c *gin.Context) {
+		once.Do(func() {
+			document = Document(engine.Routes())
+		})
+		c.JSON(http.StatusOK, document)
+	}
+}
@@ -0,0 +1,507 @@
+package openapi
+
+// Query parameters of the two pagination styles, database.Pagination and
+// database.PaginationUpdates.
+var (
+	afterPagination = []Field{
+		{Name: "limit", Type: "integer", Description: "Page size, at most 50."},
+		{Name: "after", Type: "integer", Description: "ID cursor; returns records with a greater ID."},
+	}
+	beforePagination = []Field{
+		{Name: "limit", Type: "integer", Description: "Page size, at most 50."},
+		{Name: "before", Description: "RFC 3339 timestamp cursor, or `now`."},
+	}
+)
+
+// jobFilterFields filter and sort the job lists and make up saved views.
+var jobFilterFields = []Field{
+	{Name: "status", Type: "array", Description: "Statuses to include, repeated."},
+	{Name: "priority", Type: "array", Description: "`low`, `normal`, `high` or `urgent`, repeated."},
+	{Name: "overdue", Type: "boolean", Description: "`true` for jobs past their due date or an SLA target only."},
+	{Name: "assignee", Description: "Assigned user ID, or `none` for unassigned jobs."},
+	{Name: "contact", Type: "integer", Description: "Primary or linked contact ID."},
+	{Name: "created_from", Description: "YYYY-MM-DD, included."},
+	{Name: "created_to", Description: "YYYY-MM-DD, included."},
+	{Name: "updated_from", Description: "YYYY-MM-DD, included."},
+	{Name: "updated_to", Description: "YYYY-MM-DD, included."},
+	{Name: "cf", Type: "object", Description: "Custom field values the jobs must have, sent as `cf[field_name]`. Job type lists only."},
+	{Name: "cf_from", Type: "object", Description: "Lower end of a number, currency, computed or date custom field, sent as `cf_from[field_name]`."},
+	{Name: "cf_to", Type: "object", Description: "Upper end of a number, currency, computed or date custom field, sent as `cf_to[field_name]`."},
+	{Name: "sort", Description: "`id` (default), `created`, `updated`, `title`, `due`, `priority` or `cf.field_name`. Jobs without a value come last."},
+	{Name: "dir", Description: "`asc` (default) or `desc`."},
+}
+
+// jobListQuery is jobFilterFields for a page of a job list. Past the first
+// page of a list not sorted by ID ascending, pass next_cursor back as
+// `cursor`.
+var jobListQuery = withQuery(jobFilterFields, Field{Name: "cursor", Description: "next_cursor of the previous page when not sorting by ID ascending."})
+
+var (
+	searchTerms = Field{Name: "q", Description: "Words to search for; quoted phrases, OR and -word are understood."}
+	searchKind  = Field{Name: "kind", Description: "`job`, `job_update`, `contact` or `transaction` to search one kind only."}
+	searchLimit = Field{Name: "limit", Type: "integer", Description: "Number of results, 20 by default and at most 50."}
+	searchQuery = []Field{searchTerms, searchKind}
+)
+
+func withQuery(pagination []Field, fields ...Field) []Field {
+	return append(append([]Field{}, pagination...), fields...)
+}
+
+var jobFormFields = []Field{
+	{Name: "title", Required: true},
+	{Name: "primary_contact_id", Type: "integer", Required: true},
+	{Name: "assigned_to_user_id", Type: "integer", Description: "Assignee; empty unassigns. Left out, new jobs go to their creator and edits keep the assignee."},
+	{Name: "priority", Description: "`low`, `normal`, `high` or `urgent`; picks the job type's SLA targets. Left out, new jobs are `normal` and edits keep the priority."},
+	{Name: "due_date", Description: "YYYY-MM-DD; empty clears it. Left out, edits keep the due date."},
+	{Name: "thumbnail_image", Type: "file", Description: "JPG, PNG or WEBP thumbnail."},
+	{Name: "custom_fields", Type: "object", Description: "Values of the job type's custom fields, sent as `custom_fields[field_name]`, once per option for multi-selects. Computed fields are worked out and not sent. Checked against the definitions; unknown fields are rejected."},
+	customFieldFiles,
+}
+
+var userFormFields = []Field{
+	{Name: "full_name", Required: true},
+	{Name: "role", Required: true},
+	{Name: "location_contact"},
+	{Name: "work_phone"},
+	{Name: "home_phone"},
+}
+
+var entityCustomFields = Field{Name: "custom_fields", Type: "object", Description: "Values of the custom fields defined for the entity, sent as `custom_fields[field_name]`."}
+
+var customFieldFiles = Field{Name: "custom_files", Type: "file", Description: "Uploads for file fields, sent as `custom_files[field_name]`. Without one, `custom_fields[field_name]` keeps the current file."}
+
+var customFieldVersion = Field{Name: "version", Type: "integer", Required: true, Description: "Version of the definitions the change was made against; a change against an outdated version is refused."}
+
+var jobStatusVersion = Field{Name: "version", Type: "integer", Required: true, Description: "Version of the status workflow the change was made against; a change against an outdated version is refused."}
+
+var customFieldFormFields = []Field{
+	customFieldVersion,
+	{Name: "field_label", Required: true},
+	{Name: "field_name", Required: true, Description: "Lowercase letters, numbers and underscores."},
+	{Name: "field_type", Required: true},
+	{Name: "is_required", Type: "boolean"},
+	{Name: "select_options", Description: "One option per line, for select and multiselect fields."},
+	{Name: "formula", Description: "For computed fields: number, currency or computed fields as `{field_name}` with + - * / and parentheses."},
+	{Name: "visible_field", Description: "Show the field only when this other field matches `visible_operator` and `visible_value`. Empty for always."},
+	{Name: "visible_operator", Description: "`equals`, `not_equals`, `filled` or `empty`."},
+	{Name: "visible_value"},
+	{Name: "required_field", Description: "Require the field when this other field matches `required_operator` and `required_value`."},
+	{Name: "required_operator", Description: "`equals`, `not_equals`, `filled` or `empty`."},
+	{Name: "required_value"},
+}
+
+var customFieldEditFields = []Field{
+	customFieldVersion,
+	{Name: "field_label", Required: true},
+	{Name: "field_name", Description: "New name; stored values move with it. Defaults to the current name."},
+	{Name: "field_type", Required: true, Description: "Stored values are converted when the type changes."},
+	{Name: "is_required", Type: "boolean"},
+	{Name: "select_options", Description: "One option per line, for select and multiselect fields."},
+	{Name: "formula", Description: "For computed fields: number, currency or computed fields as `{field_name}` with + - * / and parentheses."},
+	{Name: "visible_field", Description: "Show the field only when this other field matches `visible_operator` and `visible_value`. Empty for always."},
+	{Name: "visible_operator", Description: "`equals`, `not_equals`, `filled` or `empty`."},
+	{Name: "visible_value"},
+	{Name: "required_field", Description: "Require the field when this other field matches `required_operator` and `required_value`."},
+	{Name: "required_operator", Description: "`equals`, `not_equals`, `filled` or `empty`."},
+	{Name: "required_value"},
+	{Name: "discard_invalid", Type: "boolean", Description: "Remove stored values the new definition cannot hold instead of refusing the change."},
+}
+
+var customFieldOrderFields = []Field{
+	customFieldVersion,
+	{Name: "order", Required: true, Description: "Every field name once, repeated in the new order."},
+}
+
+var customFieldPreviewQuery = []Field{
+	{Name: "field_type", Required: true},
+	{Name: "select_options", Description: "One option per line, for select and multiselect fields."},
+}
+
+// Operations describes every route registered in registerRoutes, keyed by
+// method and gin path. The route coverage test fails when a route is missing.
+var Operations = map[string]Operation{
+	// Public
+	"GET /login": {Summary: "Login page", Tag: "auth", Public: true},
+	"POST /api/login": {Summary: "Log in with username and password", Tag: "auth", Public: true, Form: []Field{
+		{Name: "username", Required: true},
+		{Name: "password", Required: true},
+	}},
+	"POST /api/login/2fa": {Summary: "Finish logging in with a TOTP or recovery code", Tag: "auth", Public: true, Form: []Field{
+		{Name: "code", Required: true},
+	}},
+	"GET /logout":               {Summary: "Log out and revoke the current session", Tag: "auth", Public: true},
+	"GET /api/openapi.json":     {Summary: "This document", Tag: "meta", Public: true},
+	"GET /uploads/*filepath":    {Summary: "Uploaded thumbnails and update images", Tag: "meta", Public: true},
+	"HEAD /uploads/*filepath":   {Summary: "Uploaded thumbnails and update images", Tag: "meta", Public: true},
+	"GET /calendar/feed/:token": {Summary: "iCalendar feed of the appointments of the feed's owner; the token, optionally ending in .ics, is the credential", Tag: "calendar", Public: true},
+	"GET /log":                  {Summary: "Live log viewer", Tag: "admin", Permission: "logs.view"},
+	"GET /ws/log":               {Summary: "Log viewer WebSocket", Tag: "admin", Permission: "logs.view", Query: []Field{{Name: "lastMod", Description: "Hex nanosecond timestamp of the last seen change."}}},
+
+	// Profile
+	"GET /profile/edit": {Summary: "Profile page", Tag: "profile", CookieOnly: true},
+	"PUT /profile": {Summary: "Update my profile", Tag: "profile", CookieOnly: true, Form: []Field{
+		{Name: "full_name", Required: true},
+		{Name: "location_contact"},
+		{Name: "work_phone"},
+		{Name: "home_phone"},
+		entityCustomFields,
+		customFieldFiles,
+	}},
+	"GET /profile/edit/password": {Summary: "Change password modal", Tag: "profile", CookieOnly: true},
+	"POST /profile/edit/password": {Summary: "Change password", Tag: "profile", CookieOnly: true, Form: []Field{
+		{Name: "current_password", Required: true},
+		{Name: "new_password", Required: true},
+		{Name: "confirm_password", Required: true},
+	}},
+	"POST /profile/sessions/revoke": {Summary: "Log out of every session", Tag: "profile", CookieOnly: true},
+	"GET /profile/2fa/setup":        {Summary: "Two-factor setup modal", Tag: "profile", CookieOnly: true},
+	"POST /profile/2fa/enable":      {Summary: "Enable two-factor authentication", Tag: "profile", CookieOnly: true, Form: []Field{{Name: "code", Required: true}}},
+	"POST /profile/2fa/disable":     {Summary: "Disable two-factor authentication", Tag: "profile", CookieOnly: true, Form: []Field{{Name: "code", Required: true}}},
+	"POST /profile/2fa/recovery-codes": {Summary: "Replace the recovery codes", Tag: "profile", CookieOnly: true, Form: []Field{
+		{Name: "code", Required: true},
+	}},
+	"GET /profile/tokens": {Summary: "Own API tokens", Tag: "profile", CookieOnly: true},
+	"POST /profile/tokens": {Summary: "Create an API token, shown once", Tag: "profile", CookieOnly: true, Form: []Field{
+		{Name: "name", Required: true},
+		{Name: "expires_in_days", Type: "integer", Required: true, Description: "7, 30, 90 or 365."},
+		{Name: "scopes", Type: "array", Required: true, Description: "Permissions of the token; must be granted by the user's role."},
+	}},
+	"DELETE /profile/tokens/:id":    {Summary: "Revoke an own API token", Tag: "profile", CookieOnly: true},
+	"POST /profile/calendar-feed":   {Summary: "Create or replace the calendar feed link, shown once", Tag: "profile", CookieOnly: true},
+	"DELETE /profile/calendar-feed": {Summary: "Turn off the calendar feed", Tag: "profile", CookieOnly: true},
+
+	// Jobs
+	"GET /jobs/type/:jobTypeId":       {Summary: "Job list page of a job type; the filter bar starts from the query", Tag: "jobs", Permission: "jobs.view", Query: jobListQuery},
+	"GET /jobs/type/:jobTypeId/board": {Summary: "Board page of a job type with a column and count per status, filtered like the list page", Tag: "jobs", Permission: "jobs.view", Query: jobFilterFields},
+	"GET /jobs/mine":                  {Summary: "Job list page of the jobs assigned to the user; the filter bar starts from the query", Tag: "jobs", Permission: "jobs.view", Query: jobListQuery},
+	"GET /jobs/new-form/:id":          {Summary: "New job modal for a job type", Tag: "jobs", Permission: "jobs.create"},
+	"POST /jobs/add/:jobTypeId":       {Summary: "Create a job", Tag: "jobs", Permission: "jobs.create", Form: jobFormFields},
+	"GET /jobs/:id":                   {Summary: "Job page", Tag: "jobs", Permission: "jobs.view"},
+	"GET /jobs/edit-form/:id":         {Summary: "Edit job modal", Tag: "jobs", Permission: "jobs.edit"},
+	"GET /jobs/:id/updates/new":       {Summary: "New job update page", Tag: "jobs", Permission: "jobs.updates.create"},
+	"POST /jobs/:id/contacts": {Summary: "Link another contact to a job", Tag: "jobs", Permission: "jobs.edit", Form: []Field{
+		{Name: "job_contact_id", Type: "integer", Required: true},
+		{Name: "job_contact_role", Required: true, Description: "`site`, `billing` or `requester`."},
+	}},
+	"DELETE /jobs/:id/contacts/:jobContactId": {Summary: "Unlink a contact from a job", Tag: "jobs", Permission: "jobs.edit"},
+	"GET /jobs/:id/appointments":              {Summary: "Appointments of a job with a booking form", Tag: "jobs", Permission: "jobs.view"},
+	"POST /jobs/:id/appointments": {Summary: "Book a technician for a job; refused when they are already booked then", Tag: "jobs", Permission: "jobs.edit", Form: []Field{
+		{Name: "user_id", Type: "integer", Required: true, Description: "A user with access to the job's type."},
+		{Name: "starts_at", Required: true, Description: "YYYY-MM-DDTHH:MM in server time."},
+		{Name: "ends_at", Required: true, Description: "YYYY-MM-DDTHH:MM in server time; after starts_at and at most 14 days later."},
+		{Name: "notes"},
+	}},
+	"DELETE /jobs/:id/appointments/:appointmentId": {Summary: "Cancel an appointment", Tag: "jobs", Permission: "jobs.edit"},
+	"GET /calendar": {Summary: "Week or month calendar of appointments and due dates", Tag: "calendar", Permission: "jobs.view", Query: []Field{
+		{Name: "view", Description: "`week` (default) or `month`."},
+		{Name: "date", Description: "YYYY-MM-DD inside the period to show; defaults to today."},
+		{Name: "user", Type: "integer", Description: "Only the appointments of this user."},
+	}},
+	"POST /jobs/views": {Summary: "Save the filters and sort of a job list as a view", Tag: "jobs", Permission: "jobs.view", Form: append([]Field{
+		{Name: "view_name", Required: true, Description: "At most 100 characters."},
+		{Name: "job_type_id", Type: "integer", Description: "Job list the view belongs to; empty for My Jobs."},
+		{Name: "is_shared", Type: "boolean", Description: "List the view for everyone who sees the job list."},
+	}, jobFilterFields...)},
+	"PUT /jobs/views/:id": {Summary: "Share or unshare one of the user's saved views", Tag: "jobs", Permission: "jobs.view", Form: []Field{
+		{Name: "is_shared", Type: "boolean"},
+	}},
+	"DELETE /jobs/views/:id": {Summary: "Delete one of the user's saved views", Tag: "jobs", Permission: "jobs.view"},
+	"POST /jobs/edit/:id": {Summary: "Edit a job and record an update", Tag: "jobs", Permission: "jobs.edit", Form: append([]Field{
+		{Name: "status", Description: "Must be the current status or one it can move to in the job type's workflow."},
+		{Name: "update_title", Required: true},
+		{Name: "update_description"},
+	}, jobFormFields...)},
+	"PUT /jobs/:id/status": {Summary: "Move a job to another status from the board and record the change", Tag: "jobs", Permission: "jobs.edit", Query: jobFilterFields, Form: []Field{
+		{Name: "status", Required: true, Description: "A status the job can move to in the job type's workflow."},
+		{Name: "from", Description: "The status the board showed; the move fails when the job is no longer in it."},
+	}},
+	"GET /api/jobs/search": {Summary: "Job search results for the finance form", Tag: "jobs", Permission: "jobs.view", Query: []Field{
+		{Name: "q_job", Description: "Title or ticket to search for."},
+	}},
+	"GET /api/jobs/mine": {Summary: "Job cards of the jobs assigned to the user", Tag: "jobs", Permission: "jobs.view", Query: withQuery(afterPagination, jobListQuery...)},
+	"GET /api/users/search": {Summary: "User picker results among users sharing a job type with the caller", Tag: "jobs", Permission: "jobs.view", Query: []Field{
+		{Name: "q_user", Description: "Username or full name to search for."},
+		{Name: "picker", Description: "ID of the search box of a user picker the results fill."},
+	}},
+	"GET /api/jobs/:id": {Summary: "Job cards of a job type", Tag: "jobs", Permission: "jobs.view", Query: withQuery(afterPagination, jobListQuery...)},
+	"GET /api/jobs/:id/board": {Summary: "Job cards of one board column", Tag: "jobs", Permission: "jobs.view", Query: withQuery(jobListQuery,
+		Field{Name: "column", Required: true, Description: "Status of the column."},
+		Field{Name: "limit", Type: "integer", Description: "Page size, at most 50."},
+	)},
+	"GET /api/jobs/:id/updates": {Summary: "Update history of a job", Tag: "jobs", Permission: "jobs.view", Query: beforePagination},
+	"POST /api/jobs/:id/updates": {Summary: "Add an update to a job", Tag: "jobs", Permission: "jobs.updates.create", Form: []Field{
+		{Name: "update_title", Required: true},
+		{Name: "update_description"},
+		{Name: "update_image", Type: "file"},
+	}},
+	"DELETE /api/jobs/:id": {Summary: "Delete a job; needs `jobs.delete.any`, or `jobs.delete.own` when the job is assigned to the user", Tag: "jobs"},
+
+	// Finance
+	"GET /finance":                  {Summary: "Finance page", Tag: "finance", Permission: "finance.view"},
+	"GET /finance/new":              {Summary: "New financial record form", Tag: "finance", Permission: "finance.write"},
+	"GET /api/finance/transactions": {Summary: "Financial transactions", Tag: "finance", Permission: "finance.view", Query: beforePagination},
+	"POST /api/finance/transactions": {Summary: "Record a financial transaction", Tag: "finance", Permission: "finance.write", Form: []Field{
+		{Name: "description", Required: true},
+		{Name: "amount", Type: "number", Required: true},
+		{Name: "type", Required: true, Description: "`income` or `expense`."},
+		{Name: "transaction_date", Description: "YYYY-MM-DD, defaults to today."},
+		{Name: "related_job_id", Type: "integer"},
+	}},
+
+	// Contacts
+	"GET /contacts":     {Summary: "Contact list page", Tag: "contacts", Permission: "contacts.view"},
+	"GET /contacts/new": {Summary: "New contact modal", Tag: "contacts", Permission: "contacts.write"},
+	"POST /contacts": {Summary: "Create a contact", Tag: "contacts", Permission: "contacts.write", Form: []Field{
+		{Name: "name", Required: true},
+		{Name: "email"},
+		{Name: "phone"},
+		{Name: "confirm_duplicate", Description: "`true` to create the contact even though others share its phone number."},
+		entityCustomFields,
+		customFieldFiles,
+	}},
+	"GET /contacts/:id":      {Summary: "Contact page with jobs and transactions", Tag: "contacts", Permission: "contacts.view"},
+	"GET /contacts/:id/edit": {Summary: "Edit contact modal", Tag: "contacts", Permission: "contacts.write"},
+	"PUT /contacts/:id": {Summary: "Update a contact", Tag: "contacts", Permission: "contacts.write", Form: []Field{
+		{Name: "name", Required: true},
+		{Name: "email"},
+		{Name: "phone"},
+		entityCustomFields,
+		customFieldFiles,
+	}},
+	"POST /contacts/:id/merge": {Summary: "Merge a duplicate into the contact", Tag: "contacts", Permission: "contacts.delete", Form: []Field{
+		{Name: "duplicate_id", Type: "integer", Required: true, Description: "Contact to merge and delete."},
+	}},
+	"DELETE /contacts/:id": {Summary: "Delete a contact that is on no job", Tag: "contacts", Permission: "contacts.delete"},
+	"GET /api/contacts": {Summary: "Contact list rows", Tag: "contacts", Permission: "contacts.view", Query: withQuery(afterPagination,
+		Field{Name: "q", Description: "Name, email or phone to search for."},
+	)},
+	"GET /api/contacts/search": {Summary: "Contact search results", Tag: "contacts", Permission: "contacts.view", Query: []Field{
+		{Name: "q_contact", Description: "Name or email to search for."},
+		{Name: "for", Description: "`job_contact` when picking one of a job's other contacts."},
+		{Name: "picker", Description: "ID of the search box of a contact picker the results fill."},
+	}},
+
+	// Search
+	"GET /search":     {Summary: "Search page over jobs, job updates, contacts and transactions the user may see", Tag: "search", Query: searchQuery},
+	"GET /api/search": {Summary: "Search results", Tag: "search", Query: withQuery(searchQuery, searchLimit)},
+
+	"GET /notifications": {Summary: "Notifications page of the user, such as missed SLA targets of their jobs; marks them read", Tag: "notifications"},
+
+	// Admin pages
+	"GET /admin/register":       {Summary: "Register user page", Tag: "admin", Permission: "users.manage"},
+	"GET /admin/users":          {Summary: "User list page", Tag: "admin", Permission: "users.manage"},
+	"GET /admin/users/edit/:id": {Summary: "Edit user modal", Tag: "admin", Permission: "users.manage"},
+	"GET /admin/job-types":      {Summary: "Job types page", Tag: "admin", Permission: "jobtypes.manage"},
+	"GET /admin/job-types/:id":  {Summary: "Job type list item", Tag: "admin", Permission: "jobtypes.manage"},
+	"POST /admin/job-types": {Summary: "Create a job type", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		{Name: "name", Required: true},
+		{Name: "description"},
+	}},
+	"GET /admin/job-types/edit/:id": {Summary: "Edit job type form", Tag: "admin", Permission: "jobtypes.manage"},
+	"PUT /admin/job-types/:id": {Summary: "Edit a job type", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		{Name: "name", Required: true},
+		{Name: "description"},
+	}},
+	"DELETE /admin/job-types/:id":                         {Summary: "Delete a job type", Tag: "admin", Permission: "jobtypes.manage"},
+	"GET /admin/job-types/:id/fields":                     {Summary: "Custom fields modal", Tag: "admin", Permission: "jobtypes.manage"},
+	"POST /admin/job-types/:id/fields":                    {Summary: "Add a custom field", Tag: "admin", Permission: "jobtypes.manage", Form: customFieldFormFields},
+	"DELETE /admin/job-types/:id/fields/:fieldName":       {Summary: "Delete a custom field and its stored values", Tag: "admin", Permission: "jobtypes.manage", Query: []Field{customFieldVersion}},
+	"PUT /admin/job-types/:id/fields/:fieldName":          {Summary: "Edit, rename or retype a custom field, migrating stored values", Tag: "admin", Permission: "jobtypes.manage", Form: customFieldEditFields},
+	"GET /admin/job-types/:id/fields/:fieldName/preview":  {Summary: "Preview how stored values convert to a new field type", Tag: "admin", Permission: "jobtypes.manage", Query: customFieldPreviewQuery},
+	"PUT /admin/job-types/:id/fields/order":               {Summary: "Reorder custom fields", Tag: "admin", Permission: "jobtypes.manage", Form: customFieldOrderFields},
+	"GET /admin/job-types/:id/fields/report":              {Summary: "Jobs whose stored values do not fit the custom fields", Tag: "admin", Permission: "jobtypes.manage"},
+	"GET /admin/custom-fields/:entity":                    {Summary: "Contact or user custom fields modal; entity is `contacts` or `users`", Tag: "admin", Permission: "customfields.manage"},
+	"POST /admin/custom-fields/:entity":                   {Summary: "Add a contact or user custom field", Tag: "admin", Permission: "customfields.manage", Form: customFieldFormFields},
+	"DELETE /admin/custom-fields/:entity/:fieldName":      {Summary: "Delete a contact or user custom field and its stored values", Tag: "admin", Permission: "customfields.manage", Query: []Field{customFieldVersion}},
+	"PUT /admin/custom-fields/:entity/:fieldName":         {Summary: "Edit, rename or retype a contact or user custom field, migrating stored values", Tag: "admin", Permission: "customfields.manage", Form: customFieldEditFields},
+	"GET /admin/custom-fields/:entity/:fieldName/preview": {Summary: "Preview how stored values convert to a new field type", Tag: "admin", Permission: "customfields.manage", Query: customFieldPreviewQuery},
+	"PUT /admin/custom-fields/:entity/order":              {Summary: "Reorder contact or user custom fields", Tag: "admin", Permission: "customfields.manage", Form: customFieldOrderFields},
+	"GET /admin/custom-fields/:entity/report":             {Summary: "Contacts or users whose stored values do not fit the custom fields", Tag: "admin", Permission: "customfields.manage"},
+	"GET /admin/job-types/:id/statuses":                   {Summary: "Status workflow modal", Tag: "admin", Permission: "jobtypes.manage"},
+	"POST /admin/job-types/:id/statuses": {Summary: "Add a status", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		jobStatusVersion,
+		{Name: "label", Required: true},
+		{Name: "name", Required: true, Description: "Lowercase letters, numbers and underscores."},
+		{Name: "is_initial", Type: "boolean", Description: "New jobs start in this status."},
+		{Name: "is_final", Type: "boolean"},
+		{Name: "pauses_sla", Type: "boolean", Description: "SLA clocks stand still while a job is in this status."},
+		{Name: "transitions", Type: "array", Description: "Names of the statuses a job may move to from this one."},
+	}},
+	"PUT /admin/job-types/:id/statuses/:statusName": {Summary: "Edit a status and its transitions", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		jobStatusVersion,
+		{Name: "label", Required: true},
+		{Name: "is_initial", Type: "boolean"},
+		{Name: "is_final", Type: "boolean"},
+		{Name: "pauses_sla", Type: "boolean", Description: "SLA clocks stand still while a job is in this status."},
+		{Name: "transitions", Type: "array", Description: "Names of the statuses a job may move to from this one."},
+	}},
+	"DELETE /admin/job-types/:id/statuses/:statusName": {Summary: "Delete a status no job is in", Tag: "admin", Permission: "jobtypes.manage", Query: []Field{jobStatusVersion}},
+	"GET /admin/job-types/:id/access":                  {Summary: "Job type access modal", Tag: "admin", Permission: "jobtypes.manage"},
+	"GET /admin/job-types/:id/sla":                     {Summary: "Job type SLA targets modal", Tag: "admin", Permission: "jobtypes.manage"},
+	"PUT /admin/job-types/:id/sla": {Summary: "Set a job type's response and resolution targets per priority", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		{Name: "response_hours", Type: "object", Description: "Hours to respond, sent as `response_hours[priority]`; empty is no target."},
+		{Name: "resolution_hours", Type: "object", Description: "Hours to resolve, sent as `resolution_hours[priority]`; empty is no target."},
+	}},
+	"PUT /admin/job-types/:id/access": {Summary: "Restrict a job type to its members", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		{Name: "restricted", Type: "boolean"},
+	}},
+	"POST /admin/job-types/:id/members": {Summary: "Add or update a job type member", Tag: "admin", Permission: "jobtypes.manage", Form: []Field{
+		{Name: "member_type", Required: true, Description: "`user` or `role`."},
+		{Name: "username", Description: "For user members."},
+		{Name: "role_id", Type: "integer", Description: "For role members."},
+		{Name: "can_edit", Type: "boolean"},
+	}},
+	"DELETE /admin/job-types/:id/members/:memberId": {Summary: "Remove a job type member", Tag: "admin", Permission: "jobtypes.manage"},
+	"GET /admin/roles": {Summary: "Roles page", Tag: "admin", Permission: "roles.manage"},
+	"POST /admin/roles": {Summary: "Create a role", Tag: "admin", Permission: "roles.manage", Form: []Field{
+		{Name: "name", Required: true},
+		{Name: "description"},
+	}},
+	"PUT /admin/roles/:id": {Summary: "Replace the permissions of a role", Tag: "admin", Permission: "roles.manage", Form: []Field{
+		{Name: "permissions", Type: "array"},
+	}},
+	"DELETE /admin/roles/:id": {Summary: "Delete a role", Tag: "admin", Permission: "roles.manage"},
+	"GET /admin/tokens":       {Summary: "Every user's API tokens", Tag: "admin", Permission: "users.manage"},
+
+	// Admin API
+	"GET /api/admin/userslist": {Summary: "User list rows", Tag: "admin", Permission: "users.manage", Query: withQuery(afterPagination,
+		Field{Name: "q", Description: "Username or full name to search for."},
+	)},
+	"POST /api/admin/register": {Summary: "Register a user", Tag: "admin", Permission: "users.manage", Form: append([]Field{
+		{Name: "username", Required: true},
+		{Name: "password", Required: true},
+	}, userFormFields...)},
+	"PUT /api/admin/users/:id":         {Summary: "Edit a user", Tag: "admin", Permission: "users.manage", Form: append(append([]Field{}, userFormFields...), entityCustomFields, customFieldFiles)},
+	"DELETE /api/admin/users/:id":      {Summary: "Delete a user", Tag: "admin", Permission: "users.manage"},
+	"POST /api/admin/users/:id/unlock": {Summary: "Clear a login lockout", Tag: "admin", Permission: "users.manage"},
+	"DELETE /api/admin/tokens/:id":     {Summary: "Revoke any API token", Tag: "admin", Permission: "users.manage"},
+
+	// JSON API
+	"GET /api/v1/job-types":              {Summary: "Job types the user can see", Tag: "api", Permission: "jobs.view", Response: "JobType", List: true},
+	"GET /api/v1/job-types/:id":          {Summary: "A job type", Tag: "api", Permission: "jobs.view", Response: "JobType"},
+	"GET /api/v1/job-types/:id/fields":   {Summary: "Custom field definitions of a job type", Tag: "api", Permission: "jobs.view", Response: "CustomField", List: true},
+	"GET /api/v1/job-types/:id/statuses": {Summary: "Status workflow of a job type", Tag: "api", Permission: "jobs.view", Response: "JobStatus", List: true},
+	"GET /api/v1/job-types/:id/jobs":     {Summary: "Jobs of a job type", Tag: "api", Permission: "jobs.view", Query: withQuery(afterPagination, jobListQuery...), Response: "Job", List: true},
+	"GET /api/v1/jobs/search": {Summary: "Search jobs by title or ticket", Tag: "api", Permission: "jobs.view", Response: "Job", List: true, Query: []Field{
+		{Name: "q", Required: true},
+	}},
+	"GET /api/v1/jobs/mine":        {Summary: "Jobs assigned to the caller", Tag: "api", Permission: "jobs.view", Query: withQuery(afterPagination, jobListQuery...), Response: "Job", List: true},
+	"GET /api/v1/jobs/:id":         {Summary: "A job", Tag: "api", Permission: "jobs.view", Response: "JobDetail"},
+	"GET /api/v1/jobs/:id/updates": {Summary: "Update history of a job", Tag: "api", Permission: "jobs.view", Query: beforePagination, Response: "JobUpdate", List: true},
+	"POST /api/v1/jobs/:id/updates": {Summary: "Add an update to a job", Tag: "api", Permission: "jobs.updates.create", Response: "JobUpdate", JSON: []Field{
+		{Name: "title", Required: true},
+		{Name: "description"},
+	}},
+	"GET /api/v1/contacts": {Summary: "Contacts", Tag: "api", Permission: "contacts.view", Response: "Contact", List: true, Query: withQuery(afterPagination,
+		Field{Name: "q", Description: "Name, email or phone to search for."},
+	)},
+	"POST /api/v1/contacts": {Summary: "Create a contact", Tag: "api", Permission: "contacts.write", Response: "Contact", JSON: []Field{
+		{Name: "name", Required: true},
+		{Name: "email"},
+		{Name: "phone"},
+		{Name: "custom_fields", Type: "object", Description: "Values of the contact custom fields, keyed by field name."},
+	}},
+	"GET /api/v1/contacts/:id":         {Summary: "A contact", Tag: "api", Permission: "contacts.view", Response: "Contact"},
+	"GET /api/v1/finance/transactions": {Summary: "Financial transactions", Tag: "api", Permission: "finance.view", Query: beforePagination, Response: "FinanceTransaction", List: true},
+	"POST /api/v1/finance/transactions": {Summary: "Record a financial transaction", Tag: "api", Permission: "finance.write", Response: "FinanceTransaction", JSON: []Field{
+		{Name: "description", Required: true},
+		{Name: "amount", Type: "number", Required: true},
+		{Name: "type", Required: true, Description: "`income` or `expense`."},
+		{Name: "transaction_date", Description: "YYYY-MM-DD, defaults to today."},
+		{Name: "related_job_id", Type: "integer"},
+	}},
+	"GET /api/v1/users": {Summary: "Users", Tag: "api", Permission: "users.manage", Response: "User", List: true, Query: withQuery(afterPagination,
+		Field{Name: "q", Description: "Username or full name to search for."},
+	)},
+	"GET /api/v1/users/:id": {Summary: "A user", Tag: "api", Permission: "users.manage", Response: "User"},
+	"GET /api/v1/search": {Summary: "Ranked search over jobs, job updates, contacts and transactions; kinds the token cannot view are left out", Tag: "api", Response: "SearchResult", List: true, Query: []Field{
+		{Name: "q", Required: true, Description: searchTerms.Description}, searchKind, searchLimit,
+	}},
+}
+
+func object(properties map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+var (
+	str      = map[string]any{"type": "string"}
+	integer  = map[string]any{"type": "integer"}
+	boolean  = map[string]any{"type": "boolean"}
+	dateTime = map[string]any{"type": "string", "format": "date-time"}
+	date     = map[string]any{"type": "string", "format": "date", "nullable": true}
+	anyMap   = map[string]any{"type": "object", "additionalProperties": true}
+
+	nullableDateTime = map[string]any{"type": "string", "format": "date-time", "nullable": true}
+	overdue          = map[string]any{"type": "string", "description": "What the job missed: `resolution` or `response` SLA target, or `due_date`. Left out while it is on time."}
+
+	customFieldRule = object(map[string]any{"field": str, "operator": str, "value": str})
+)
+
+var components = map[string]any{
+	"securitySchemes": map[string]any{
+		"cookieAuth": map[string]any{"type": "apiKey", "in": "cookie", "name": "token"},
+		"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "description": "Personal API token from the profile page."},
+	},
+	"responses": map[string]any{
+		"Error": map[string]any{
+			"description": "Error",
+			"content": map[string]any{"application/json": map[string]any{"schema": object(map[string]any{
+				"error": map[string]any{"$ref": "#/components/schemas/Error"},
+			})}},
+		},
+	},
+	"schemas": map[string]any{
+		"Error": object(map[string]any{"code": str, "message": str}),
+		"JobType": object(map[string]any{
+			"id": integer, "name": str, "description": str, "restricted": boolean, "created_at": dateTime,
+		}),
+		"CustomField": object(map[string]any{
+			"field_name": str, "field_label": str, "field_type": str, "is_required": boolean,
+			"options": map[string]any{"type": "array", "items": str}, "formula": str,
+			"visible_when": customFieldRule, "required_when": customFieldRule,
+		}),
+		"JobStatus": object(map[string]any{
+			"name": str, "label": str, "is_initial": boolean, "is_final": boolean, "pauses_sla": boolean,
+			"transitions": map[string]any{"type": "array", "items": str},
+		}),
+		"JobUpdate": object(map[string]any{
+			"id": str, "author_user_id": integer, "author_name": str, "created_at": dateTime, "content": anyMap,
+		}),
+		"Job": object(map[string]any{
+			"id": integer, "status": str, "ticket_id": str, "title": str, "job_type_id": integer,
+			"assigned_to_user_id": map[string]any{"type": "integer", "nullable": true}, "assigned_user_name": str,
+			"priority": str, "due_date": date, "overdue": overdue,
+			"custom_fields": anyMap, "last_update": map[string]any{"$ref": "#/components/schemas/JobUpdate"},
+		}),
+		"JobDetail": object(map[string]any{
+			"id": integer, "title": str, "status": str, "ticket_id": str, "job_type_id": integer, "job_type_name": str,
+			"contact_name": str, "assigned_to_user_id": map[string]any{"type": "integer", "nullable": true}, "assigned_user_name": str,
+			"contacts":      map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/JobContact"}},
+			"custom_fields": anyMap, "created_at": dateTime, "updated_at": dateTime,
+			"priority": str, "due_date": date, "overdue": overdue,
+			"response_due": nullableDateTime, "resolution_due": nullableDateTime,
+			"responded_at": nullableDateTime, "resolved_at": nullableDateTime,
+		}),
+		"JobContact": object(map[string]any{
+			"id": integer, "job_id": integer, "contact_id": integer, "role": str, "name": str, "email": str, "phone": str,
+		}),
+		"Contact": object(map[string]any{
+			"id": integer, "name": str, "email": str, "phone": str, "custom_fields": anyMap, "created_at": dateTime,
+		}),
+		"FinanceTransaction": object(map[string]any{
+			"id": integer, "description": str, "transaction_date": dateTime, "type": str,
+			"amount":         map[string]any{"type": "string", "description": "Decimal amount."},
+			"related_job_id": map[string]any{"type": "integer", "nullable": true},
+			"created_at":     dateTime,
+		}),
+		"SearchResult": object(map[string]any{
+			"kind": str, "id": str, "title": str, "url": str, "rank": map[string]any{"type": "number"},
+			"snippet": map[string]any{"type": "string", "description": "HTML; matched words are in <mark>, the rest is escaped."},
+		}),
+		"User": object(map[string]any{
+			"id": integer, "username": str, "full_name": str, "role": str, "location_contact": str,
+			"work_phone": str, "home_phone": str, "custom_fields": anyMap, "totp_enabled": boolean,
+			"created_at": dateTime, "updated_at": dateTime,
+		}),
+	},
+}
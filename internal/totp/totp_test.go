@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestGenerateCodeRFC6238 checks the SHA-1 vectors of RFC 6238 Appendix B.
+// The RFC lists 8-digit codes; 6-digit codes are their last six digits.
+func TestGenerateCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		want := tt.want[len(tt.want)-Digits:]
+		if got := generateCode(key, tt.unix/Period); got != want {
+			t.Errorf("generateCode at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key, err := encoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / Period
+	codeAt := func(step int64) string { return generateCode(key, step) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, codeAt(current), 0, current, true},
+		{"spaces and lowercase are tolerated", " gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", codeAt(current)[:3] + " " + codeAt(current)[3:], 0, current, true},
+		{"previous step within skew", rfcSecret, codeAt(current - Skew), 0, current - Skew, true},
+		{"next step within skew", rfcSecret, codeAt(current + Skew), 0, current + Skew, true},
+		{"before the skew window", rfcSecret, codeAt(current - Skew - 1), 0, 0, false},
+		{"after the skew window", rfcSecret, codeAt(current + Skew + 1), 0, 0, false},
+		{"replay of the last step", rfcSecret, codeAt(current), current, 0, false},
+		{"step before the last step", rfcSecret, codeAt(current - 1), current, 0, false},
+		{"step after the last step", rfcSecret, codeAt(current + 1), current, current + 1, true},
+		{"wrong length", rfcSecret, codeAt(current)[:Digits-1], 0, 0, false},
+		{"wrong code", rfcSecret, "000000", 0, 0, false},
+		{"secret is not base32", "not base32!", codeAt(current), 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		step, ok := Validate(tt.secret, tt.code, now, tt.lastStep)
+		if ok != tt.wantOK || step != tt.wantStep {
+			t.Errorf("%s: Validate = (%d, %v), want (%d, %v)", tt.name, step, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+}
@@ -1,15 +1,18 @@
 package web
 
 import (
+	"Momentum/internal/database"
 	"Momentum/internal/jwt"
 	"Momentum/internal/logger"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
 )
 
 func WsLog(c *gin.Context) {
@@ -68,36 +71,126 @@ func RedirectToHTTPS(httpsPort string) func(http.ResponseWriter, *http.Request)
 }
 
 func AuthenticateMiddleware(c *gin.Context) {
-	tokenString, err := c.Cookie("token")
-	if err != nil {
+	if !authenticate(c) {
 		c.Redirect(http.StatusSeeOther, "/login")
 		c.Abort()
 		return
 	}
 
-	claims, err := jwt.VerifyToken(tokenString)
-	if err != nil {
-		c.Redirect(http.StatusSeeOther, "/login")
-		c.Abort()
+	c.Next()
+
+}
+
+// APIAuthenticateMiddleware is AuthenticateMiddleware for /api/v1, answering
+// with a JSON error instead of redirecting to the login page.
+func APIAuthenticateMiddleware(c *gin.Context) {
+	if !authenticate(c) {
+		database.AbortWithAPIError(c, http.StatusUnauthorized, "unauthenticated", "Authentication required.")
 		return
 	}
 
+	c.Next()
+}
+
+// authenticate verifies the access token, rotating the refresh token when the
+// access token has expired, and stores the user's claims on the context.
+// Requests with an `Authorization: Bearer` header are authenticated by API
+// token alone and never fall back to the cookies.
+func authenticate(c *gin.Context) bool {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		if err := database.AuthenticateAPIToken(c, strings.TrimSpace(token)); err != nil {
+			logger.LogToLogFile(c, fmt.Sprintf("Authenticate Middleware: Rejected API token `%v`", err))
+			return false
+		}
+		return true
+	}
+
+	claims, err := accessTokenClaims(c)
+	if err != nil {
+		// The access token is short-lived; try to rotate the refresh token
+		// before sending the user back to the login page.
+		tokenString, refreshErr := database.RefreshSession(c)
+		if refreshErr == nil {
+			claims, err = jwt.VerifyToken(tokenString)
+		}
+		if refreshErr != nil || err != nil {
+			database.ClearAuthCookies(c)
+			return false
+		}
+	}
+
 	c.Set("username", claims["sub"])
 	c.Set("role", claims["aud"])
 	c.Set("userID", claims["id"])
 
-	c.Next()
+	return true
+}
+
+func accessTokenClaims(c *gin.Context) (gojwt.MapClaims, error) {
+	tokenString, err := c.Cookie("token")
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := jwt.VerifyToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, _ := claims["jti"].(string)
+	active, err := database.SessionActive(c.Request.Context(), sessionID)
+	if err != nil {
+		logger.LogToLogFile(c, fmt.Sprintf("Authenticate Middleware [SQL]: Error while checking session `%v`", err))
+		return nil, err
+	}
+	if !active {
+		return nil, fmt.Errorf("session %s is not active", sessionID)
+	}
 
+	return claims, nil
 }
 
-func IsAdmin(c *gin.Context) {
-	role, ok := c.Get("role")
-	if role != "admin" && !ok {
-		c.Redirect(http.StatusForbidden, "/")
+// RequirePermission only lets the request through when the logged-in user's
+// role grants permission. It must run after AuthenticateMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !database.HasPermission(c, permission) {
+			username, _ := c.Get("username")
+			logger.LogToLogFile(c, fmt.Sprintf("Require Permission: User %v is missing `%s`", username, permission))
+			c.String(http.StatusForbidden, "You do not have permission to access this page.")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RejectAPITokens keeps API tokens away from routes that manage the account
+// itself (sessions, 2FA, tokens, profile), which no token scope covers. It
+// checks the header because authenticate never falls back to the cookies when
+// one is sent, and so it also works on routes outside AuthenticateMiddleware.
+func RejectAPITokens(c *gin.Context) {
+	if strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+		logger.LogToLogFile(c, fmt.Sprintf("Reject API Tokens: Refused token request to %s %s", c.Request.Method, c.FullPath()))
+		c.String(http.StatusForbidden, "API tokens cannot be used for this page.")
 		c.Abort()
 		return
 	}
 
 	c.Next()
+}
 
+// RequireAPIPermission is RequirePermission for /api/v1 routes.
+func RequireAPIPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !database.HasPermission(c, permission) {
+			username, _ := c.Get("username")
+			logger.LogToLogFile(c, fmt.Sprintf("Require API Permission: User %v is missing `%s`", username, permission))
+			database.AbortWithAPIError(c, http.StatusForbidden, "forbidden", fmt.Sprintf("Missing the `%s` permission.", permission))
+			return
+		}
+
+		c.Next()
+	}
 }
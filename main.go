@@ -1,32 +1,53 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"Momentum/internal/config"
 	"Momentum/internal/database"
 	"Momentum/internal/logger"
+	"Momentum/internal/openapi"
 	"Momentum/internal/web"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		conn := database.ConnectDB()
+		defer conn.Close()
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
 	c := config.Config{}
 	c.LoadConfig()
 	conn := database.ConnectDB()
 	defer conn.Close()
 
+	if err := database.CheckSchemaCurrent(context.Background()); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
 	logger.LogFileWriter = setupLogging()
+	database.RequireAdmin2FA = c.Security.RequireAdmin2FA
 
 	ginRouter := setupGin()
 	serverHTTPS := config.LoadServerHTTPSConfig(c, ginRouter)
 
 	registerRoutes(ginRouter, c)
 
+	go database.RunSLAWorker(context.Background(), time.Minute)
+
 	if c.Server.RedirectToHttps {
 		go config.LoadHTTPServer(c)
 	}
@@ -38,6 +59,49 @@ func main() {
 
 }
 
+func runMigrate(args []string) error {
+	ctx := context.Background()
+	usage := fmt.Errorf("usage: momentum migrate up|down|status|to N|force N")
+
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "up":
+		return database.MigrateUp(ctx)
+	case "down":
+		return database.MigrateDown(ctx)
+	case "status":
+		statuses, err := database.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("%06d %-45s applied %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%06d %-45s pending\n", s.Version, s.Name)
+			}
+		}
+		return nil
+	case "to", "force":
+		if len(args) != 2 {
+			return usage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if args[0] == "force" {
+			return database.ForceVersion(ctx, version)
+		}
+		return database.MigrateTo(ctx, version)
+	default:
+		return usage
+	}
+}
+
 func setupLogging() io.Writer {
 	gin.DisableConsoleColor()
 	f, _ := os.OpenFile("var/log/gin.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -54,16 +118,18 @@ func setupGin() *gin.Engine {
 }
 
 func registerRoutes(ginRouter *gin.Engine, c config.Config) {
+	perm := web.RequirePermission
 
 	// --- Public Routes (Login/Logout) ---
 	ginRouter.GET("/login", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "login.html", nil)
 	})
 	ginRouter.POST("/api/login", database.Login)
-	ginRouter.GET("/logout", func(c *gin.Context) {
-		c.SetCookie("token", "", -1, "/", "localhost", false, true)
-		c.Redirect(http.StatusSeeOther, "/")
-	})
+	ginRouter.POST("/api/login/2fa", database.LoginTOTP)
+	ginRouter.GET("/logout", web.RejectAPITokens, database.Logout)
+	ginRouter.GET("/api/openapi.json", openapi.Handler(ginRouter))
+	// Calendar apps cannot log in; the secret token in the path stands in.
+	ginRouter.GET("/calendar/feed/:token", database.CalendarFeed)
 
 	// --- Authenticated Routes (for logged-in users) ---
 	auth := ginRouter.Group("/")
@@ -71,34 +137,62 @@ func registerRoutes(ginRouter *gin.Engine, c config.Config) {
 	{
 		// User Profile
 		profile := auth.Group("/profile")
+		profile.Use(web.RejectAPITokens)
 		{
 			profile.GET("/edit", database.UserProfile)
+			profile.PUT("", database.UpdateProfile)
 			profile.GET("/edit/password", func(c *gin.Context) {
 				c.HTML(http.StatusOK, "changePasswordModal.html", nil)
 			})
 			profile.POST("/edit/password", database.EditPassword)
+			profile.POST("/sessions/revoke", database.LogoutEverywhere)
+			profile.GET("/2fa/setup", database.TOTPSetupModal)
+			profile.POST("/2fa/enable", database.EnableTOTP)
+			profile.POST("/2fa/disable", database.DisableTOTP)
+			profile.POST("/2fa/recovery-codes", database.RegenerateRecoveryCodes)
+			profile.GET("/tokens", database.APITokenList)
+			profile.POST("/tokens", database.CreateAPIToken)
+			profile.DELETE("/tokens/:id", database.RevokeAPIToken)
+			profile.POST("/calendar-feed", database.CreateCalendarFeed)
+			profile.DELETE("/calendar-feed", database.DeleteCalendarFeed)
 		}
 
 		// Jobs (Web Pages and API)
-		auth.GET("/jobs/type/:jobTypeId", database.Jobs)
-		auth.GET("/jobs/new-form/:id", database.NewJobModal)
-		auth.POST("/jobs/add/:jobTypeId", database.AddNewJob)
-		auth.POST("/jobs/edit/:id", database.EditJob)
-		auth.GET("/jobs/:id", database.JobView)
-		auth.GET("/jobs/edit-form/:id", database.EditJobModal)
-		auth.GET("/jobs/:id/updates/new", database.NewJobUpdateModal)
-
-		auth.GET("/api/jobs/search", database.SearchJobFinances)
-		auth.GET("/api/jobs/:id", database.JobsList)
-		auth.GET("/api/jobs/:id/updates", database.JobUpdateHistory)
-		auth.POST("/api/jobs/:id/updates", database.NewJobUpdate)
+		auth.GET("/jobs/type/:jobTypeId", perm("jobs.view"), database.Jobs)
+		auth.GET("/jobs/type/:jobTypeId/board", perm("jobs.view"), database.JobBoard)
+		auth.GET("/jobs/mine", perm("jobs.view"), database.MyJobs)
+		auth.GET("/jobs/new-form/:id", perm("jobs.create"), database.NewJobModal)
+		auth.POST("/jobs/add/:jobTypeId", perm("jobs.create"), database.AddNewJob)
+		auth.POST("/jobs/edit/:id", perm("jobs.edit"), database.EditJob)
+		auth.PUT("/jobs/:id/status", perm("jobs.edit"), database.MoveJob)
+		auth.GET("/jobs/:id", perm("jobs.view"), database.JobView)
+		auth.GET("/jobs/edit-form/:id", perm("jobs.edit"), database.EditJobModal)
+		auth.GET("/jobs/:id/updates/new", perm("jobs.updates.create"), database.NewJobUpdateModal)
+		auth.POST("/jobs/:id/contacts", perm("jobs.edit"), database.AddJobContact)
+		auth.DELETE("/jobs/:id/contacts/:jobContactId", perm("jobs.edit"), database.DeleteJobContact)
+		auth.GET("/jobs/:id/appointments", perm("jobs.view"), database.JobAppointments)
+		auth.POST("/jobs/:id/appointments", perm("jobs.edit"), database.AddJobAppointment)
+		auth.DELETE("/jobs/:id/appointments/:appointmentId", perm("jobs.edit"), database.DeleteJobAppointment)
+		auth.GET("/calendar", perm("jobs.view"), database.CalendarPage)
+		auth.POST("/jobs/views", perm("jobs.view"), database.SaveJobView)
+		auth.PUT("/jobs/views/:id", perm("jobs.view"), database.ShareJobView)
+		auth.DELETE("/jobs/views/:id", perm("jobs.view"), database.DeleteJobView)
+
+		auth.GET("/api/jobs/search", perm("jobs.view"), database.SearchJobFinances)
+		auth.GET("/api/jobs/mine", perm("jobs.view"), database.MyJobsList)
+		auth.GET("/api/users/search", perm("jobs.view"), database.SearchAssignees)
+		auth.GET("/api/jobs/:id", perm("jobs.view"), database.JobsList)
+		auth.GET("/api/jobs/:id/board", perm("jobs.view"), database.JobBoardCards)
+		auth.GET("/api/jobs/:id/updates", perm("jobs.view"), database.JobUpdateHistory)
+		auth.POST("/api/jobs/:id/updates", perm("jobs.updates.create"), database.NewJobUpdate)
+		// DeleteJob decides between jobs.delete.own and jobs.delete.any itself.
 		auth.DELETE("/api/jobs/:id", database.DeleteJob)
 
 		// Finance (Web Pages and API)
-		auth.GET("/finance", func(c *gin.Context) {
+		auth.GET("/finance", perm("finance.view"), func(c *gin.Context) {
 			c.HTML(http.StatusOK, "finance.html", nil)
 		})
-		auth.GET("/finance/new", func(c *gin.Context) {
+		auth.GET("/finance/new", perm("finance.write"), func(c *gin.Context) {
 			formData := gin.H{
 				"description":      "",
 				"amount":           "",
@@ -114,51 +208,132 @@ func registerRoutes(ginRouter *gin.Engine, c config.Config) {
 			})
 		})
 
-		auth.GET("/api/finance/transactions", database.FinanceList)
-		auth.POST("/api/finance/transactions", database.AddNewFinancialRecord)
+		auth.GET("/api/finance/transactions", perm("finance.view"), database.FinanceList)
+		auth.POST("/api/finance/transactions", perm("finance.write"), database.AddNewFinancialRecord)
 
 		// Contacts (Web Pages and API)
-		auth.GET("/contacts/new", database.HandleNewContactModal)
-		auth.POST("/contacts", database.CreateContact)
-		auth.GET("/api/contacts/search", database.SearchContact)
+		auth.GET("/contacts", perm("contacts.view"), func(c *gin.Context) {
+			c.HTML(http.StatusOK, "contactList.html", gin.H{
+				"CanManageFields": database.HasPermission(c, "customfields.manage"),
+			})
+		})
+		auth.GET("/contacts/new", perm("contacts.write"), database.HandleNewContactModal)
+		auth.POST("/contacts", perm("contacts.write"), database.CreateContact)
+		auth.GET("/contacts/:id", perm("contacts.view"), database.ContactView)
+		auth.GET("/contacts/:id/edit", perm("contacts.write"), database.EditContactModal)
+		auth.PUT("/contacts/:id", perm("contacts.write"), database.UpdateContact)
+		auth.POST("/contacts/:id/merge", perm("contacts.delete"), database.MergeContact)
+		auth.DELETE("/contacts/:id", perm("contacts.delete"), database.DeleteContact)
+		auth.GET("/api/contacts", perm("contacts.view"), database.ContactList)
+		auth.GET("/api/contacts/search", perm("contacts.view"), database.SearchContact)
+
+		// Search (results are filtered by permission, not the route)
+		auth.GET("/search", database.SearchPage)
+		auth.GET("/api/search", database.SearchResults)
+
+		// Notifications of the logged-in user
+		auth.GET("/notifications", database.Notifications)
 	}
 
 	// --- Admin Routes (Web Pages) ---
 	adminRoutes := ginRouter.Group("/admin")
-	adminRoutes.Use(web.AuthenticateMiddleware, web.IsAdmin)
+	adminRoutes.Use(web.AuthenticateMiddleware)
 	{
-		adminRoutes.GET("/register", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "register.html", nil)
-		})
-		adminRoutes.GET("/users", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "userList.html", nil)
+		adminRoutes.GET("/register", perm("users.manage"), database.RegisterPage)
+		adminRoutes.GET("/users", perm("users.manage"), func(c *gin.Context) {
+			c.HTML(http.StatusOK, "userList.html", gin.H{
+				"CanManageFields": database.HasPermission(c, "customfields.manage"),
+			})
 		})
-		adminRoutes.GET("/users/edit/:id", database.EditUserPage)
+		adminRoutes.GET("/users/edit/:id", perm("users.manage"), database.EditUserPage)
 
 		// Job Types
-		adminRoutes.GET("/job-types/:id", database.GetJobTypeHandler)
-		adminRoutes.GET("/job-types", database.JobTypeList)
-		adminRoutes.POST("/job-types", database.CreateJobType)
-		adminRoutes.GET("/job-types/edit/:id", database.JobTypeEditForm)
-		adminRoutes.PUT("/job-types/:id", database.EditJobTypeDB)
-		adminRoutes.GET("/job-types/:id/fields", database.GetCustomFieldsHandler)
-		adminRoutes.POST("/job-types/:id/fields", database.AddNewCustomFields)
-		adminRoutes.DELETE("/job-types/:id/fields/:fieldName", database.DeleteCustomFields)
+		adminRoutes.GET("/job-types/:id", perm("jobtypes.manage"), database.GetJobTypeHandler)
+		adminRoutes.GET("/job-types", perm("jobtypes.manage"), database.JobTypeList)
+		adminRoutes.POST("/job-types", perm("jobtypes.manage"), database.CreateJobType)
+		adminRoutes.GET("/job-types/edit/:id", perm("jobtypes.manage"), database.JobTypeEditForm)
+		adminRoutes.PUT("/job-types/:id", perm("jobtypes.manage"), database.EditJobTypeDB)
+		adminRoutes.DELETE("/job-types/:id", perm("jobtypes.manage"), database.DeleteJobType)
+		adminRoutes.GET("/job-types/:id/fields", perm("jobtypes.manage"), database.GetCustomFieldsHandler)
+		adminRoutes.POST("/job-types/:id/fields", perm("jobtypes.manage"), database.AddNewCustomFields)
+		adminRoutes.DELETE("/job-types/:id/fields/:fieldName", perm("jobtypes.manage"), database.DeleteCustomFields)
+		adminRoutes.PUT("/job-types/:id/fields/order", perm("jobtypes.manage"), database.ReorderCustomFields)
+		adminRoutes.GET("/job-types/:id/fields/report", perm("jobtypes.manage"), database.CustomFieldReport)
+		adminRoutes.PUT("/job-types/:id/fields/:fieldName", perm("jobtypes.manage"), database.UpdateCustomField)
+		adminRoutes.GET("/job-types/:id/fields/:fieldName/preview", perm("jobtypes.manage"), database.PreviewCustomFieldChange)
+		adminRoutes.GET("/custom-fields/:entity", perm("customfields.manage"), database.GetCustomFieldsHandler)
+		adminRoutes.POST("/custom-fields/:entity", perm("customfields.manage"), database.AddNewCustomFields)
+		adminRoutes.DELETE("/custom-fields/:entity/:fieldName", perm("customfields.manage"), database.DeleteCustomFields)
+		adminRoutes.PUT("/custom-fields/:entity/order", perm("customfields.manage"), database.ReorderCustomFields)
+		adminRoutes.GET("/custom-fields/:entity/report", perm("customfields.manage"), database.CustomFieldReport)
+		adminRoutes.PUT("/custom-fields/:entity/:fieldName", perm("customfields.manage"), database.UpdateCustomField)
+		adminRoutes.GET("/custom-fields/:entity/:fieldName/preview", perm("customfields.manage"), database.PreviewCustomFieldChange)
+		adminRoutes.GET("/job-types/:id/statuses", perm("jobtypes.manage"), database.JobStatusesModal)
+		adminRoutes.POST("/job-types/:id/statuses", perm("jobtypes.manage"), database.AddJobStatus)
+		adminRoutes.PUT("/job-types/:id/statuses/:statusName", perm("jobtypes.manage"), database.UpdateJobStatus)
+		adminRoutes.DELETE("/job-types/:id/statuses/:statusName", perm("jobtypes.manage"), database.DeleteJobStatus)
+		adminRoutes.GET("/job-types/:id/access", perm("jobtypes.manage"), database.JobTypeAccessModal)
+		adminRoutes.PUT("/job-types/:id/access", perm("jobtypes.manage"), database.SetJobTypeRestricted)
+		adminRoutes.POST("/job-types/:id/members", perm("jobtypes.manage"), database.AddJobTypeMember)
+		adminRoutes.DELETE("/job-types/:id/members/:memberId", perm("jobtypes.manage"), database.DeleteJobTypeMember)
+		adminRoutes.GET("/job-types/:id/sla", perm("jobtypes.manage"), database.JobSLAModal)
+		adminRoutes.PUT("/job-types/:id/sla", perm("jobtypes.manage"), database.UpdateJobSLAs)
+
+		// Roles
+		adminRoutes.GET("/roles", perm("roles.manage"), database.RoleList)
+		adminRoutes.POST("/roles", perm("roles.manage"), database.CreateRole)
+		adminRoutes.PUT("/roles/:id", perm("roles.manage"), database.UpdateRolePermissions)
+		adminRoutes.DELETE("/roles/:id", perm("roles.manage"), database.DeleteRole)
+
+		// API Tokens
+		adminRoutes.GET("/tokens", perm("users.manage"), database.AdminAPITokenList)
 	}
 
 	// --- API Admin Routes ---
 	apiAdminRoutes := ginRouter.Group("/api/admin")
-	apiAdminRoutes.Use(web.AuthenticateMiddleware, web.IsAdmin)
+	apiAdminRoutes.Use(web.AuthenticateMiddleware, perm("users.manage"))
 	{
 		apiAdminRoutes.GET("/userslist", database.UserList)
 		apiAdminRoutes.POST("/register", database.Register)
 		apiAdminRoutes.DELETE("/users/:id", database.DeleteUser)
 		apiAdminRoutes.PUT("users/:id", database.EditUserDB)
+		apiAdminRoutes.POST("/users/:id/unlock", database.UnlockUser)
+		apiAdminRoutes.DELETE("/tokens/:id", database.AdminRevokeAPIToken)
+	}
+
+	// --- JSON API ---
+	apiPerm := web.RequireAPIPermission
+	apiV1 := ginRouter.Group("/api/v1")
+	apiV1.Use(web.APIAuthenticateMiddleware)
+	{
+		apiV1.GET("/job-types", apiPerm("jobs.view"), database.APIJobTypes)
+		apiV1.GET("/job-types/:id", apiPerm("jobs.view"), database.APIJobType)
+		apiV1.GET("/job-types/:id/fields", apiPerm("jobs.view"), database.APICustomFields)
+		apiV1.GET("/job-types/:id/statuses", apiPerm("jobs.view"), database.APIJobStatuses)
+		apiV1.GET("/job-types/:id/jobs", apiPerm("jobs.view"), database.APIJobs)
+
+		apiV1.GET("/jobs/search", apiPerm("jobs.view"), database.APISearchJobs)
+		apiV1.GET("/jobs/mine", apiPerm("jobs.view"), database.APIMyJobs)
+		apiV1.GET("/jobs/:id", apiPerm("jobs.view"), database.APIJob)
+		apiV1.GET("/jobs/:id/updates", apiPerm("jobs.view"), database.APIJobUpdates)
+		apiV1.POST("/jobs/:id/updates", apiPerm("jobs.updates.create"), database.APICreateJobUpdate)
+
+		apiV1.GET("/contacts", apiPerm("contacts.view"), database.APIContacts)
+		apiV1.POST("/contacts", apiPerm("contacts.write"), database.APICreateContact)
+		apiV1.GET("/contacts/:id", apiPerm("contacts.view"), database.APIContact)
+
+		apiV1.GET("/finance/transactions", apiPerm("finance.view"), database.APIFinanceTransactions)
+		apiV1.POST("/finance/transactions", apiPerm("finance.write"), database.APICreateFinanceTransaction)
+
+		apiV1.GET("/users", apiPerm("users.manage"), database.APIUsers)
+		apiV1.GET("/users/:id", apiPerm("users.manage"), database.APIUser)
+
+		apiV1.GET("/search", database.APISearch)
 	}
 
 	// --- Condicional Routes (Logs) ---
 	if c.Server.LogEndpoint {
-		ginRouter.GET("/log", web.AuthenticateMiddleware, web.IsAdmin, web.Log)
-		ginRouter.GET("/ws/log", web.WsLog)
+		ginRouter.GET("/log", web.AuthenticateMiddleware, perm("logs.view"), web.Log)
+		ginRouter.GET("/ws/log", web.AuthenticateMiddleware, perm("logs.view"), web.WsLog)
 	}
 }
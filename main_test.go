@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"Momentum/internal/config"
+	"Momentum/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestOpenAPICoversEveryRoute keeps internal/openapi in step with
+// registerRoutes.
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var c config.Config
+	c.Server.LogEndpoint = true
+
+	ginRouter := setupGin()
+	registerRoutes(ginRouter, c)
+	routes := ginRouter.Routes()
+
+	for _, route := range openapi.Undocumented(routes) {
+		t.Errorf("%s is registered but missing from openapi.Operations", route)
+	}
+	for _, route := range openapi.Unrouted(routes) {
+		t.Errorf("%s is in openapi.Operations but not registered", route)
+	}
+
+	paths, _ := openapi.Document(routes)["paths"].(map[string]any)
+	if _, ok := paths["/jobs/type/{jobTypeId}"]; !ok {
+		t.Errorf("path parameters are not converted to OpenAPI syntax")
+	}
+}